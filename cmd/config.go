@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+	"io"
+
+	"person-enricher/internal/config"
+)
+
+const configUsage = "usage: person-enricher [flags] config print"
+
+// runConfig implements the config subcommand:
+//
+//	config print  print the effective configuration as YAML, secrets redacted
+func runConfig(w io.Writer, cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+	return cfg.Print(w)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"person-enricher/internal/exporter"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+)
+
+const exportUsage = "usage: person-enricher export [-format csv|ndjson|parquet] [-gzip] [-filter TEXT] [-match substring|fuzzy] [-o FILE]"
+
+// runExport implements the export subcommand: it writes every person matching the
+// filter, from one consistent snapshot, to a file or to the standard output.
+//
+//	-o       output file, the standard output by default; the format and gzip
+//	         are taken from its extension, e.g. people.parquet or people.csv.gz
+//	-format  csv, ndjson or parquet, csv by default
+//	-gzip    compress the output with gzip
+//	-filter  text to search in name, surname and patronymic, like GET /people
+//	-match   substring (default) or fuzzy
+func runExport(ctx context.Context, svc service.PersonService, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	output := fs.String("o", "", "")
+	format := fs.String("format", "", "")
+	gz := fs.Bool("gzip", false, "")
+	filter := fs.String("filter", "", "")
+	match := fs.String("match", "substring", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errors.New(exportUsage)
+	}
+
+	opts := exporter.Options{Format: exporter.FormatCSV, Gzip: *gz}
+	var err error
+	if *output != "" && *format == "" {
+		var gzExt bool
+		if opts.Format, gzExt, err = exporter.FormatFromPath(*output); err != nil {
+			return err
+		}
+		opts.Gzip = opts.Gzip || gzExt
+	}
+	if *format != "" {
+		if opts.Format, err = exporter.ParseFormat(*format); err != nil {
+			return err
+		}
+	}
+	pf := models.PeopleFilter{Filter: strings.TrimSpace(*filter)}
+	switch *match {
+	case "substring":
+	case "fuzzy":
+		pf.Fuzzy = true
+	default:
+		return fmt.Errorf("invalid match %q, expected substring or fuzzy", *match)
+	}
+
+	if *output == "" {
+		_, err := exporter.Export(ctx, svc, pf, os.Stdout, opts)
+		return err
+	}
+	// write to a temporary file first, so that a failed export does not leave
+	// a truncated file behind that looks complete
+	tmp, err := os.CreateTemp(filepath.Dir(*output), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := exporter.Export(ctx, svc, pf, tmp, opts)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), *output); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d people to %s\n", n, *output)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"person-enricher/internal/importer"
+	"person-enricher/internal/service"
+)
+
+const importUsage = "usage: person-enricher import [-format csv|ndjson] [-map field=column,...] [-batch N] [-checkpoint FILE] [-rejects FILE] FILE"
+
+// runImport implements the import subcommand: it creates people from a CSV or NDJSON
+// file and writes the lines that could not be imported to the reject file.
+//
+//	-format      csv or ndjson, by default taken from the file extension
+//	-map         columns the fields are read from, e.g. name=first_name,surname=last_name
+//	-batch       number of people created at once, up to service.MaxBatchSize
+//	-checkpoint  progress file, FILE.checkpoint by default; an interrupted import
+//	             started again with it resumes after the last completed batch
+//	-rejects     reject file, FILE.rejects.ndjson by default, truncated by a new import
+//	             and appended to by a resumed one
+func runImport(ctx context.Context, svc service.PersonService, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", "", "")
+	mapping := fs.String("map", "", "")
+	batch := fs.Int("batch", importer.DefaultBatchSize, "")
+	checkpoint := fs.String("checkpoint", "", "")
+	rejects := fs.String("rejects", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 || *batch < 1 || *batch > service.MaxBatchSize {
+		return errors.New(importUsage)
+	}
+	path := fs.Arg(0)
+
+	opts := importer.Options{BatchSize: *batch, Checkpoint: *checkpoint}
+	var err error
+	if *format != "" {
+		opts.Format, err = importer.ParseFormat(*format)
+	} else {
+		opts.Format, err = importer.FormatFromPath(path)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Mapping, err = importer.ParseMapping(*mapping); err != nil {
+		return err
+	}
+	if opts.Checkpoint == "" {
+		opts.Checkpoint = path + ".checkpoint"
+	}
+	if *rejects == "" {
+		*rejects = path + ".rejects.ndjson"
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	// A resumed import keeps the rejects of the lines it skips, a new one starts afresh
+	rejectFlag := os.O_TRUNC
+	if _, err := os.Stat(opts.Checkpoint); err == nil {
+		rejectFlag = os.O_APPEND
+	}
+	rejectFile, err := os.OpenFile(*rejects, os.O_WRONLY|os.O_CREATE|rejectFlag, 0o644)
+	if err != nil {
+		return err
+	}
+	defer rejectFile.Close()
+	opts.Rejects = rejectFile
+
+	result, err := importer.New(svc, opts).Run(ctx, src)
+	fmt.Printf("processed up to line %d: %d people created, %d lines rejected\n", result.LastLine, result.Created, result.Rejected)
+	if result.Rejected > 0 {
+		fmt.Printf("rejected lines are in %s\n", *rejects)
+	}
+	if err != nil {
+		return fmt.Errorf("%w (run the same command again to resume from %s)", err, opts.Checkpoint)
+	}
+	return nil
+}
@@ -2,132 +2,298 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"person-enricher/internal/audit"
+	"person-enricher/internal/config"
 	"person-enricher/internal/externalapi"
 	"person-enricher/internal/handlers"
+	"person-enricher/internal/health"
+	"person-enricher/internal/lifecycle"
+	"person-enricher/internal/logging"
 	"person-enricher/internal/metrics"
+	"person-enricher/internal/migrations"
 	"person-enricher/internal/repository"
 	"person-enricher/internal/service"
+	"person-enricher/internal/tracing"
 )
 
 func main() {
 
 	// 1) Load environment variables from .env file
-	log.Printf("main: Starting person-enricher")
-	if err := godotenv.Load(); err != nil {
-		log.Printf("No .env file found, reading environment variables directly")
-	}
+	dotenvErr := godotenv.Load()
+
+	// Log JSON lines, the standard logger included, at info until the level is known
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
 
-	// 2) Get environment variables from .env
-	log.Printf("main: Loading environment variables")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort, err := strconv.Atoi(os.Getenv("DB_PORT"))
+	// 2) Load the configuration from the defaults, CONFIG_FILE, the environment and the flags
+	cfg, args, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stderr)
+		return
+	}
 	if err != nil {
-		log.Fatalf("invalid DB_PORT: %v", err)
+		fatal("main: invalid configuration", "error", err)
 	}
-	dbUser := os.Getenv("DB_USER")
-	dbPass := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbSSL := os.Getenv("DB_SSLMODE")
 
-	httpPort := os.Getenv("HTTP_PORT")
-	if httpPort == "" {
-		httpPort = ":8080"
+	// Run a subcommand instead of the server if one is given; config prints to stdout
+	// before anything is logged
+	command := "serve"
+	if len(args) > 0 {
+		command = args[0]
+		args = args[1:]
+	}
+	switch command {
+	case "serve", "migrate", "import", "export":
+	case "config":
+		if err := runConfig(os.Stdout, cfg, args); err != nil {
+			fatal("main: config failed", "error", err)
+		}
+		return
+	default:
+		fatal("main: unknown command, expected serve, migrate, import, export or config", "command", command)
 	}
 
-	metricsPort := os.Getenv("METRICS_PORT")
-	if metricsPort == "" {
-		metricsPort = ":8081"
+	slog.SetDefault(logging.New(os.Stdout, cfg.Log.SlogLevel()))
+	slog.Info("main: Starting person-enricher")
+	if dotenvErr != nil {
+		slog.Info("main: No .env file found, reading environment variables directly")
+	}
+
+	// Personal data is hashed in the logs; log.unredacted shows it, in local development only
+	if cfg.Log.Unredacted {
+		logging.SetUnredacted(true)
+		slog.Warn("main: Unredacted logging is on, personal data and payloads are logged as they are")
+	}
+	slog.Info("main: Configuration", "config", cfg)
+
+	// Trace requests, service calls, queries and external API calls
+	slog.Info("main: Setting up tracing")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		fatal("main: failed to set up tracing", "error", err)
 	}
-	log.Printf("DB_HOST: %s", dbHost)
-	log.Printf("DB_PORT: %d", dbPort)
-	log.Printf("DB_USER: %s", dbUser)
-	log.Printf("DB_PASSWORD: %s", dbPass)
-	log.Printf("DB_NAME: %s", dbName)
-	log.Printf("DB_SSLMODE: %s", dbSSL)
-	log.Printf("HTTP_PORT: %s", httpPort)
-	log.Printf("METRICS_PORT: %s", metricsPort)
 
 	// 3) Connect to DB and initialize repository
-	log.Printf("main: Connecting to DB")
-	db, err := repository.NewDB(dbHost, dbPort, dbUser, dbPass, dbName, dbSSL)
+	slog.Info("main: Connecting to DB")
+	db, err := repository.NewDB(repository.DBOptions{
+		URL:          string(cfg.DB.URL),
+		URLFile:      cfg.DB.URLFile,
+		Host:         cfg.DB.Host,
+		Port:         cfg.DB.Port,
+		User:         cfg.DB.User,
+		Name:         cfg.DB.Name,
+		SSLMode:      cfg.DB.SSLMode,
+		Password:     string(cfg.DB.Password),
+		PasswordFile: cfg.DB.PasswordFile,
+		SSLRootCert:  cfg.DB.SSLRootCert,
+		SSLCert:      cfg.DB.SSLCert,
+		SSLKey:       cfg.DB.SSLKey,
+		SlowQuery:    cfg.DB.SlowQueryThreshold,
+	})
 	if err != nil {
-		log.Fatalf("failed to connect to DB: %v", err)
+		fatal("main: failed to connect to DB", "error", err)
 	}
 
-	// Initialize handlers metrics
-	metrics.InitMetrics()
+	if command == "migrate" {
+		err := runMigrate(context.Background(), db, args)
+		flushTracing(shutdownTracing)
+		if err != nil {
+			fatal("main: migrate failed", "error", err)
+		}
+		return
+	}
+
+	// Refuse to start on a schema this binary was not built for
+	slog.Info("main: Checking schema version")
+	migrator, err := migrations.New(db)
+	if err != nil {
+		fatal("main: failed to load migrations", "error", err)
+	}
+	if err := migrator.CheckVersion(context.Background()); err != nil {
+		fatal("main: refusing to start", "error", err)
+	}
+
+	// Initialize metrics on a registry of their own, next to the Go runtime, process
+	// and connection pool metrics, which keep their standard names
+	registry := prometheus.NewRegistry()
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("main: failed to get the connection pool", "error", err)
+	}
+	prometheus.WrapRegistererWith(cfg.Metrics.Labels(), registry).MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(sqlDB, db.Migrator().CurrentDatabase()),
+	)
+	appMetrics, err := metrics.New(registry, metrics.Options{
+		Namespace:   cfg.Metrics.Namespace,
+		ConstLabels: cfg.Metrics.Labels(),
+	})
+	if err != nil {
+		fatal("main: failed to register metrics", "error", err)
+	}
+	registry.MustRegister(repository.NewTableRowsCollector(db, appMetrics))
+	if err := db.Use(repository.NewSlowQueryPlugin(appMetrics, cfg.DB.SlowQueryThreshold)); err != nil {
+		fatal("main: failed to install the slow query counter", "error", err)
+	}
 
 	// 4) Initialize services and handlers
-	log.Printf("main: Initializing services")
+	slog.Info("main: Initializing services")
 	repo := repository.NewPersonRepository(db)
-	metricsRepo := repository.NewMetricsRepository(repo)
+	metricsRepo := repository.NewMetricsRepository(repo, appMetrics)
 
-	enricher := externalapi.NewPersonalDataEnricher()
-	metricsEnricher := externalapi.NewMetricsEnricher(enricher)
+	enricher := externalapi.NewPersonalDataEnricher(cfg.Enricher.Timeout)
+	metricsEnricher := externalapi.NewMetricsEnricher(enricher, appMetrics)
 
 	svc := service.NewPersonService(metricsRepo, metricsEnricher)
-	instrumentedSvc := service.NewInstrumentedService(svc)
+	tracedSvc := service.NewTracedService(svc)
+	instrumentedSvc := service.NewInstrumentedService(tracedSvc, appMetrics)
+
+	if command == "import" {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := runImport(ctx, instrumentedSvc, args)
+		cancel()
+		flushTracing(shutdownTracing)
+		if err != nil {
+			fatal("main: import failed", "error", err)
+		}
+		return
+	}
+	if command == "export" {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := runExport(ctx, instrumentedSvc, args)
+		cancel()
+		flushTracing(shutdownTracing)
+		if err != nil {
+			fatal("main: export failed", "error", err)
+		}
+		return
+	}
+
+	// Components start in order and stop in reverse: readiness fails first, then the
+	// servers drain, the workers return, the pool closes and the spans are flushed
+	lm := lifecycle.New(cfg.HTTP.ShutdownTimeout)
+	lm.Add(lifecycle.Component{Name: "tracing", Stop: shutdownTracing})
+	lm.Add(lifecycle.Component{Name: "database", Stop: func(context.Context) error { return sqlDB.Close() }})
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	// Trash retention job
+	if cfg.Trash.RetentionDays > 0 {
+		retention := time.Duration(cfg.Trash.RetentionDays) * 24 * time.Hour
+		lm.AddWorker("trash retention", service.NewRetentionJob(instrumentedSvc, retention, cfg.Trash.PurgeInterval).Run)
+	}
+
+	// Removal of expired idempotency keys
+	idempotency := repository.NewIdempotencyRepository(db, cfg.HTTP.IdempotencyTTL)
+	lm.AddWorker("idempotency purge", func(ctx context.Context) {
+		purgeIdempotencyKeys(ctx, idempotency, cfg.HTTP.IdempotencyPurgeInterval)
+	})
 
 	// 5) Initialize router
-	log.Printf("main: Initializing router")
+	slog.Info("main: Initializing router")
 	handler := handlers.NewHandler(instrumentedSvc)
-	router := handlers.NewRouter(handler)
-
-	// 6) Start HTTP server
-	log.Printf("main: Starting HTTP server")
-	httpServer := &http.Server{
-		Addr:    httpPort,
-		Handler: router,
-	}
-	go func() {
-		log.Printf("Server listening on %s …", httpPort)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server failed: %v", err)
+	router := handlers.NewRouter(handler, idempotency, appMetrics)
+	if cfg.Auth.TokensFile != "" {
+		tokens, err := audit.LoadTokens(cfg.Auth.TokensFile)
+		if err != nil {
+			fatal("main: could not load the API tokens", "error", err)
 		}
-	}()
+		router.Use(handlers.AuthMiddleware(tokens))
+	}
+
+	// The probes bypass the middlewares of the router, so they are neither
+	// measured, traced nor audited. The enricher APIs are not critical: the
+	// people can still be read while they are down. Migrations newer than the
+	// binary are accepted, so that a rolling deploy does not fail the old replicas.
+	probes := health.New(
+		health.Check{Name: "database", Critical: true, Run: sqlDB.PingContext},
+		health.Check{Name: "migrations", Critical: true, Run: migrator.CheckApplied},
+		health.Check{Name: "enricher", Run: externalapi.NewReachabilityCheck(externalapi.ReachabilityTTL)},
+	)
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", probes.Liveness)
+	root.HandleFunc("GET /readyz", probes.Readiness)
+	root.Handle("/", router)
+
+	// 6) HTTP and metrics servers
+	lm.AddServer("http server", &http.Server{
+		Addr:    cfg.HTTP.Addr,
+		Handler: root,
+	})
 
-	log.Printf("main: Starting metrics server")
 	metricsRouter := http.NewServeMux()
-	metricsRouter.Handle("/metrics", promhttp.Handler())
-	metricsServer := &http.Server{
-		Addr:    metricsPort,
+	// OpenMetrics exposes the trace ids attached to the histograms as exemplars
+	metricsRouter.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		registry,
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true, Registry: registry}),
+	))
+	lm.AddServer("metrics server", &http.Server{
+		Addr:    cfg.Metrics.Addr,
 		Handler: metricsRouter,
-	}
-	// Metrics server
-	go func() {
-		log.Printf("Metrics server listening on %s", metricsPort)
+	})
 
-		if err := metricsServer.ListenAndServe(); err != nil {
-			log.Fatalf("Metrics server failed: %v", err)
+	// Readiness fails while the servers still accept, for the load balancer to notice
+	lm.Add(lifecycle.Component{Name: "readiness", Stop: func(ctx context.Context) error {
+		slog.Info("main: Failing readiness before shutdown", "delay", cfg.HTTP.ReadinessDelay)
+		probes.Drain()
+		select {
+		case <-time.After(cfg.HTTP.ReadinessDelay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-	}()
+	}})
 
-	// 7) Wait for termination signal
-	<-stop
-
-	// 8) Gracefully shutdown servers
-	log.Printf("main: Stopping http servers")
-	ctx := context.Background()
+	// 7) Run until the termination signal, then gracefully shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := lm.Run(ctx); err != nil {
+		fatal("main: stopped with errors", "error", err)
+	}
+	slog.Info("main: Stopped")
+}
 
-	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+// purgeIdempotencyKeys removes expired idempotency keys every interval, until ctx is canceled.
+func purgeIdempotencyKeys(ctx context.Context, store *repository.GormIdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		purged, err := store.PurgeExpired(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "main: could not purge idempotency keys", "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "main: expired idempotency keys purged", "purged", purged)
 	}
+}
 
-	if err := metricsServer.Shutdown(ctx); err != nil {
-		log.Printf("Metrics server shutdown error: %v", err)
+// flushTracing exports the spans of a subcommand before it exits. The server flushes
+// them as the last of its components instead.
+func flushTracing(shutdown func(context.Context) error) {
+	if err := shutdown(context.Background()); err != nil {
+		slog.Error("main: tracing shutdown error", "error", err)
 	}
+}
 
+// fatal logs msg with args as an error and exits with status 1.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
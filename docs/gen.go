@@ -0,0 +1,94 @@
+//go:build ignore
+
+// gen writes swagger.json from swagger.yaml, keeping the order of the keys.
+// Run it with go generate ./docs after editing swagger.yaml.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	data, err := os.ReadFile("swagger.yaml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		log.Fatalf("parse swagger.yaml: %v", err)
+	}
+
+	var compact bytes.Buffer
+	if err := writeJSON(&compact, &doc); err != nil {
+		log.Fatalf("convert swagger.yaml: %v", err)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact.Bytes(), "  ", "  "); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("swagger.json", out.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeJSON writes n as compact JSON, mappings keeping the order of their keys.
+func writeJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return writeJSON(buf, n.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeValue(buf, n.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		return writeValue(buf, v)
+	default:
+		return fmt.Errorf("line %d: unexpected node", n.Line)
+	}
+	return nil
+}
+
+// writeValue writes v as JSON without escaping <, > and &.
+func writeValue(buf *bytes.Buffer, v any) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // the newline of Encode
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package audit carries the metadata recorded with every change of a person:
+// who made the change, in which request and through which channel.
+package audit
+
+import "context"
+
+// Source is the channel a change came through.
+type Source string
+
+const (
+	// SourceAPI — a change made through the HTTP API
+	SourceAPI Source = "api"
+	// SourceEnrichment — data filled in by the external enrichment APIs
+	SourceEnrichment Source = "enrichment"
+	// SourceImport — a change made by a bulk import
+	SourceImport Source = "import"
+	// SourceSystem — a change made by a background job, e.g. the trash retention
+	SourceSystem Source = "system"
+)
+
+// Meta describes the origin of a change.
+type Meta struct {
+	Actor     string
+	RequestID string
+	Source    Source
+	// Enriched lists the fields of the change filled in by the enrichment APIs, whose
+	// values are recorded with SourceEnrichment whatever the source of the change.
+	Enriched []string
+}
+
+type metaKey struct{}
+
+// WithMeta returns a copy of ctx carrying m.
+func WithMeta(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, metaKey{}, m)
+}
+
+// WithSource returns a copy of ctx whose metadata has the given source,
+// keeping the actor and request id already stored in ctx.
+func WithSource(ctx context.Context, s Source) context.Context {
+	m := FromContext(ctx)
+	m.Source = s
+	return WithMeta(ctx, m)
+}
+
+// WithEnriched returns a copy of ctx whose metadata marks fields as filled in by the
+// enrichment APIs, keeping the rest of the metadata already stored in ctx.
+func WithEnriched(ctx context.Context, fields ...string) context.Context {
+	m := FromContext(ctx)
+	m.Enriched = fields
+	return WithMeta(ctx, m)
+}
+
+// FromContext returns the metadata stored in ctx.
+// Changes without metadata are attributed to SourceSystem.
+func FromContext(ctx context.Context) Meta {
+	m, _ := ctx.Value(metaKey{}).(Meta)
+	if m.Source == "" {
+		m.Source = SourceSystem
+	}
+	return m
+}
@@ -0,0 +1,54 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, Meta{Source: SourceSystem}, FromContext(context.Background()))
+
+	ctx := WithMeta(context.Background(), Meta{Actor: "alice", RequestID: "req-1", Source: SourceAPI})
+	assert.Equal(t, Meta{Actor: "alice", RequestID: "req-1", Source: SourceAPI}, FromContext(ctx))
+
+	ctx = WithSource(ctx, SourceImport)
+	assert.Equal(t, Meta{Actor: "alice", RequestID: "req-1", Source: SourceImport}, FromContext(ctx))
+
+	ctx = WithEnriched(ctx, "age")
+	assert.Equal(t, Meta{Actor: "alice", RequestID: "req-1", Source: SourceImport, Enriched: []string{"age"}}, FromContext(ctx))
+}
+
+func TestLoadTokens(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens")
+	assert.NoError(t, os.WriteFile(path, []byte("# CI and support\ns3cret-ci ci\n\n  s3cret-alice   alice\n"), 0o600))
+
+	tokens, err := LoadTokens(path)
+	assert.NoError(t, err)
+	actor, ok := tokens.Actor("s3cret-alice")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", actor)
+	_, ok = tokens.Actor("alice")
+	assert.False(t, ok)
+
+	for name, content := range map[string]string{
+		"missing actor": "s3cret-ci\n",
+		"duplicate":     "s3cret-ci ci\ns3cret-ci other\n",
+		"empty":         "# nothing yet\n",
+	} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := LoadTokens(path)
+		assert.Error(t, err, name)
+		if err != nil {
+			assert.NotContains(t, err.Error(), "s3cret", name)
+		}
+	}
+
+	_, err = LoadTokens(filepath.Join(dir, "absent"))
+	assert.Error(t, err)
+}
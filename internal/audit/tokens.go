@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Tokens maps the bearer tokens of the API clients to their actors. The tokens are
+// kept as SHA-256 hashes, so that they do not stay in memory as they are.
+type Tokens map[[sha256.Size]byte]string
+
+// LoadTokens reads a tokens file: one "token actor" pair per line, separated by
+// spaces. Empty lines and lines starting with # are ignored. The errors name the
+// line, never the token.
+func LoadTokens(path string) (Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tokens: %w", err)
+	}
+	defer f.Close()
+
+	tokens := Tokens{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("parse tokens %s: line %d: expected a token and an actor", path, line)
+		}
+		key := sha256.Sum256([]byte(fields[0]))
+		if _, ok := tokens[key]; ok {
+			return nil, fmt.Errorf("parse tokens %s: line %d: token already listed", path, line)
+		}
+		tokens[key] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("parse tokens %s: no tokens", path)
+	}
+	return tokens, nil
+}
+
+// Actor returns the actor of token, and false if token is not listed.
+func (t Tokens) Actor(token string) (string, bool) {
+	actor, ok := t[sha256.Sum256([]byte(token))]
+	return actor, ok
+}
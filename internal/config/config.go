@@ -0,0 +1,484 @@
+// Package config loads the settings of the server from, in increasing precedence, the
+// defaults, a YAML file, the environment and the command line flags, and validates them.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+
+	"person-enricher/internal/audit"
+	"person-enricher/internal/logging"
+	"person-enricher/internal/metrics"
+	"person-enricher/internal/tracing"
+)
+
+// Config is the configuration of the server.
+type Config struct {
+	// Env is the environment the server runs in; only development allows Log.Unredacted.
+	Env      string   `yaml:"env"`
+	DB       DB       `yaml:"db"`
+	HTTP     HTTP     `yaml:"http"`
+	Auth     Auth     `yaml:"auth"`
+	Metrics  Metrics  `yaml:"metrics"`
+	Enricher Enricher `yaml:"enricher"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Trash    Trash    `yaml:"trash"`
+}
+
+// DB is the PostgreSQL connection. A URL replaces Host, Port, User, Name and SSLMode.
+// The files are read again for every new connection, so that credentials can be rotated.
+type DB struct {
+	URL      Secret `yaml:"url"`
+	URLFile  string `yaml:"url_file"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password Secret `yaml:"password"`
+	// PasswordFile is a file holding the password, such as a Docker or Kubernetes secret;
+	// it takes precedence over Password.
+	PasswordFile string `yaml:"password_file"`
+	Name         string `yaml:"name"`
+	SSLMode      string `yaml:"sslmode"`
+	// SSLRootCert, SSLCert and SSLKey are the files of the CA certificate and of the
+	// client certificate and key, e.g. for sslmode verify-full.
+	SSLRootCert string `yaml:"sslrootcert"`
+	SSLCert     string `yaml:"sslcert"`
+	SSLKey      string `yaml:"sslkey"`
+	// SlowQueryThreshold is the duration from which queries are logged as warnings and counted as slow.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+}
+
+// HTTP is the API server.
+type HTTP struct {
+	Addr string `yaml:"addr"`
+	// IdempotencyTTL is how long responses are kept for retries with the same Idempotency-Key.
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"`
+	// IdempotencyPurgeInterval is how often the expired idempotency keys are removed.
+	IdempotencyPurgeInterval time.Duration `yaml:"idempotency_purge_interval"`
+	// ReadinessDelay is how long /readyz fails before the servers stop.
+	ReadinessDelay time.Duration `yaml:"shutdown_readiness_delay"`
+	// ShutdownTimeout bounds the whole graceful shutdown, ReadinessDelay included.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Auth is the authentication of the API clients.
+type Auth struct {
+	// TokensFile lists the bearer tokens of the clients with their actors, see
+	// audit.LoadTokens. Empty accepts every request and trusts its X-Actor header.
+	TokensFile string `yaml:"tokens_file"`
+}
+
+// Metrics is the Prometheus metrics server.
+type Metrics struct {
+	Addr string `yaml:"addr"`
+	// Namespace prefixes the names of the metrics of the service.
+	Namespace string `yaml:"namespace"`
+	// ConstLabels are added to every metric, as name=value pairs separated by commas.
+	ConstLabels string `yaml:"const_labels"`
+}
+
+// Labels returns the parsed ConstLabels, which are valid once the configuration is loaded.
+func (m Metrics) Labels() prometheus.Labels {
+	labels, _ := metrics.ParseLabels(m.ConstLabels)
+	return labels
+}
+
+// Enricher is the client of the agify, genderize and nationalize APIs.
+type Enricher struct {
+	// Timeout bounds each call to an API.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Log is the logging.
+type Log struct {
+	Level string `yaml:"level"`
+	// Unredacted logs personal data and payloads as they are.
+	Unredacted bool `yaml:"unredacted"`
+}
+
+// SlogLevel returns the parsed Level, which is valid once the configuration is loaded.
+func (l Log) SlogLevel() slog.Level {
+	level, _ := logging.ParseLevel(l.Level)
+	return level
+}
+
+// Tracing is the OpenTelemetry tracing.
+type Tracing struct {
+	Exporter tracing.Exporter `yaml:"exporter"`
+}
+
+// Trash is the hard deletion of soft-deleted people.
+type Trash struct {
+	// RetentionDays is how long soft-deleted people are kept; 0 keeps them forever.
+	RetentionDays int           `yaml:"retention_days"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// Secret is a setting that is never printed nor logged as it is.
+type Secret string
+
+// String returns logging.Redacted unless the secret is empty.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return logging.Redacted
+}
+
+// LogValue implements slog.LogValuer, see String.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// MarshalYAML implements yaml.Marshaler, see String.
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// Default returns the configuration before any file, environment variable or flag.
+func Default() Config {
+	return Config{
+		Env: "production",
+		DB: DB{
+			Host:               "localhost",
+			Port:               5432,
+			User:               "postgres",
+			Name:               "person_enricher",
+			SSLMode:            "disable",
+			SlowQueryThreshold: logging.SlowQueryThreshold,
+		},
+		HTTP: HTTP{
+			Addr:                     ":8080",
+			IdempotencyTTL:           24 * time.Hour,
+			IdempotencyPurgeInterval: time.Hour,
+			ReadinessDelay:           5 * time.Second,
+			ShutdownTimeout:          30 * time.Second,
+		},
+		Metrics:  Metrics{Addr: ":8081"},
+		Enricher: Enricher{Timeout: 10 * time.Second},
+		Log:      Log{Level: "info"},
+		Tracing:  Tracing{Exporter: tracing.ExporterNone},
+		Trash:    Trash{PurgeInterval: time.Hour},
+	}
+}
+
+// field binds a setting to its YAML key, environment variable and flag.
+type field struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	// value points to the setting in a Config
+	value any
+}
+
+// fields returns the settings of c. The environment variables keep the names they had
+// before the configuration file existed.
+func (c *Config) fields() []field {
+	return []field{
+		{"env", "APP_ENV", "env", "environment, development allows unredacted logs", &c.Env},
+		{"db.url", "DATABASE_URL", "db-url", "PostgreSQL URL, replacing host, port, user, name and sslmode", &c.DB.URL},
+		{"db.url_file", "DATABASE_URL_FILE", "db-url-file", "file holding the PostgreSQL URL", &c.DB.URLFile},
+		{"db.host", "DB_HOST", "db-host", "PostgreSQL host", &c.DB.Host},
+		{"db.port", "DB_PORT", "db-port", "PostgreSQL port", &c.DB.Port},
+		{"db.user", "DB_USER", "db-user", "PostgreSQL user", &c.DB.User},
+		{"db.password", "DB_PASSWORD", "db-password", "PostgreSQL password", &c.DB.Password},
+		{"db.password_file", "DB_PASSWORD_FILE", "db-password-file", "file holding the PostgreSQL password", &c.DB.PasswordFile},
+		{"db.name", "DB_NAME", "db-name", "PostgreSQL database", &c.DB.Name},
+		{"db.sslmode", "DB_SSLMODE", "db-sslmode", "PostgreSQL sslmode", &c.DB.SSLMode},
+		{"db.sslrootcert", "DB_SSLROOTCERT", "db-sslrootcert", "file of the CA certificate of PostgreSQL", &c.DB.SSLRootCert},
+		{"db.sslcert", "DB_SSLCERT", "db-sslcert", "file of the client certificate", &c.DB.SSLCert},
+		{"db.sslkey", "DB_SSLKEY", "db-sslkey", "file of the client key", &c.DB.SSLKey},
+		{"db.slow_query_threshold", "DB_SLOW_QUERY_THRESHOLD", "db-slow-query-threshold", "duration from which queries are slow", &c.DB.SlowQueryThreshold},
+		{"http.addr", "HTTP_PORT", "http-addr", "address of the API server", &c.HTTP.Addr},
+		{"http.idempotency_ttl", "IDEMPOTENCY_TTL", "idempotency-ttl", "how long responses are kept for Idempotency-Key retries", &c.HTTP.IdempotencyTTL},
+		{"http.idempotency_purge_interval", "IDEMPOTENCY_PURGE_INTERVAL", "idempotency-purge-interval", "interval of the expired idempotency key purge", &c.HTTP.IdempotencyPurgeInterval},
+		{"http.shutdown_readiness_delay", "SHUTDOWN_READINESS_DELAY", "shutdown-readiness-delay", "how long /readyz fails before the servers stop", &c.HTTP.ReadinessDelay},
+		{"http.shutdown_timeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout", "bound of the graceful shutdown", &c.HTTP.ShutdownTimeout},
+		{"auth.tokens_file", "AUTH_TOKENS_FILE", "auth-tokens-file", "file of bearer tokens and their actors, empty trusts X-Actor", &c.Auth.TokensFile},
+		{"metrics.addr", "METRICS_PORT", "metrics-addr", "address of the metrics server", &c.Metrics.Addr},
+		{"metrics.namespace", "METRICS_NAMESPACE", "metrics-namespace", "prefix of the metric names", &c.Metrics.Namespace},
+		{"metrics.const_labels", "METRICS_CONST_LABELS", "metrics-const-labels", "labels of every metric, e.g. region=eu,replica=a", &c.Metrics.ConstLabels},
+		{"enricher.timeout", "ENRICHER_TIMEOUT", "enricher-timeout", "bound of each call to the enricher APIs", &c.Enricher.Timeout},
+		{"log.level", "LOG_LEVEL", "log-level", "debug, info, warn or error", &c.Log.Level},
+		{"log.unredacted", "LOG_UNREDACTED", "log-unredacted", "log personal data and payloads as they are", &c.Log.Unredacted},
+		{"tracing.exporter", "TRACING_EXPORTER", "tracing-exporter", "none, stdout (written to stderr) or otlp", &c.Tracing.Exporter},
+		{"trash.retention_days", "TRASH_RETENTION_DAYS", "trash-retention-days", "days soft-deleted people are kept, 0 forever", &c.Trash.RetentionDays},
+		{"trash.purge_interval", "TRASH_PURGE_INTERVAL", "trash-purge-interval", "interval of the trash purge", &c.Trash.PurgeInterval},
+	}
+}
+
+// set parses s into the setting value points to, which keeps its value if s is invalid.
+func set(value any, s string) error {
+	s = strings.TrimSpace(s)
+	switch v := value.(type) {
+	case *string:
+		*v = s
+	case *Secret:
+		*v = Secret(s)
+	case *tracing.Exporter:
+		*v = tracing.Exporter(s)
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected an integer", s)
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected true or false", s)
+		}
+		*v = b
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected a duration such as 5s or 1h", s)
+		}
+		*v = d
+	default:
+		panic(fmt.Sprintf("config: unsupported setting type %T", value))
+	}
+	return nil
+}
+
+// FileEnv and FileFlag name the configuration file; the flag takes precedence.
+const (
+	FileEnv  = "CONFIG_FILE"
+	FileFlag = "config"
+)
+
+// Load returns the configuration from the defaults, the YAML file named by the -config
+// flag or CONFIG_FILE, the environment variables read with getenv and the flags in args,
+// each overriding the previous ones, and validated. It also returns the arguments after
+// the flags. -h or -help in args returns flag.ErrHelp, see Usage.
+func Load(args []string, getenv func(string) string) (*Config, []string, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	// The flags are applied last, but parsed first since they may name the file
+	fs := flag.NewFlagSet("person-enricher", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String(FileFlag, "", "")
+	type flagValue struct {
+		field field
+		value string
+	}
+	var flags []flagValue
+	for _, f := range fields {
+		record := func(v string) error {
+			flags = append(flags, flagValue{f, v})
+			return nil
+		}
+		if _, ok := f.value.(*bool); ok {
+			fs.BoolFunc(f.flag, f.usage, record)
+		} else {
+			fs.Func(f.flag, f.usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	path := *file
+	if path == "" {
+		path = getenv(FileEnv)
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	for _, f := range fields {
+		if v := getenv(f.env); v != "" {
+			if err := set(f.value, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+	for _, fv := range flags {
+		if err := set(fv.field.value, fv.value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", fv.field.flag, err))
+		}
+	}
+	// A setting that cannot be parsed keeps its previous value, so the others are still validated
+	if err := errors.Join(append(errs, cfg.Validate())...); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, fs.Args(), nil
+}
+
+// loadFile overrides c with the settings of the YAML file at path. Unknown keys are errors,
+// so that a misspelled setting does not silently keep its default.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// sslModes are the sslmode values of libpq.
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate checks every setting and returns the problems of all the invalid ones, each
+// naming the setting by its YAML key, environment variable and flag. It normalizes the
+// log level and the tracing exporter.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(value any, ok bool, format string, args ...any) {
+		if ok {
+			return
+		}
+		for _, f := range c.fields() {
+			if f.value == value {
+				errs = append(errs, fmt.Errorf("%s (%s, -%s): %s", f.key, f.env, f.flag, fmt.Sprintf(format, args...)))
+				return
+			}
+		}
+		panic("config: check of an unknown setting")
+	}
+	positive := func(d *time.Duration) {
+		check(d, *d > 0, "must be positive, got %s", *d)
+	}
+	addr := func(a *string) {
+		_, port, err := net.SplitHostPort(*a)
+		check(a, err == nil && port != "", "must be host:port or :port, got %q", *a)
+	}
+
+	readable := func(path *string) {
+		if *path == "" {
+			return
+		}
+		f, err := os.Open(*path)
+		if err == nil {
+			f.Close()
+		}
+		check(path, err == nil, "%v", err)
+	}
+
+	check(&c.DB.URLFile, c.DB.URL == "" || c.DB.URLFile == "", "cannot be set with db.url")
+	if c.DB.URL != "" {
+		// The URL holds the password, so it is not repeated in the message
+		u, err := url.Parse(string(c.DB.URL))
+		check(&c.DB.URL, err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql"), "must be a postgres:// URL")
+	} else if c.DB.URLFile == "" {
+		check(&c.DB.Host, c.DB.Host != "", "is required")
+		check(&c.DB.Port, c.DB.Port > 0 && c.DB.Port <= 65535, "must be between 1 and 65535, got %d", c.DB.Port)
+		check(&c.DB.User, c.DB.User != "", "is required")
+		check(&c.DB.Name, c.DB.Name != "", "is required")
+		check(&c.DB.SSLMode, contains(sslModes, c.DB.SSLMode), "must be one of %s, got %q", strings.Join(sslModes, ", "), c.DB.SSLMode)
+	}
+	for _, path := range []*string{&c.DB.URLFile, &c.DB.PasswordFile, &c.DB.SSLRootCert, &c.DB.SSLCert, &c.DB.SSLKey} {
+		readable(path)
+	}
+	check(&c.DB.SSLKey, (c.DB.SSLCert == "") == (c.DB.SSLKey == ""), "must be set with db.sslcert")
+	positive(&c.DB.SlowQueryThreshold)
+
+	addr(&c.HTTP.Addr)
+	addr(&c.Metrics.Addr)
+	check(&c.Metrics.Addr, c.Metrics.Addr != c.HTTP.Addr, "must differ from http.addr, both are %q", c.Metrics.Addr)
+	positive(&c.HTTP.IdempotencyTTL)
+	positive(&c.HTTP.IdempotencyPurgeInterval)
+	positive(&c.HTTP.ShutdownTimeout)
+	check(&c.HTTP.ReadinessDelay, c.HTTP.ReadinessDelay >= 0 && c.HTTP.ReadinessDelay < c.HTTP.ShutdownTimeout,
+		"must be at least 0 and shorter than http.shutdown_timeout (%s), got %s", c.HTTP.ShutdownTimeout, c.HTTP.ReadinessDelay)
+
+	if c.Auth.TokensFile != "" {
+		_, err := audit.LoadTokens(c.Auth.TokensFile)
+		check(&c.Auth.TokensFile, err == nil, "%v", err)
+	}
+
+	_, err := metrics.ParseLabels(c.Metrics.ConstLabels)
+	check(&c.Metrics.ConstLabels, err == nil, "%v", err)
+
+	positive(&c.Enricher.Timeout)
+
+	level, err := logging.ParseLevel(c.Log.Level)
+	check(&c.Log.Level, err == nil, "%v", err)
+	if err == nil {
+		c.Log.Level = strings.ToLower(level.String())
+	}
+	check(&c.Log.Unredacted, !c.Log.Unredacted || c.Env == "development", "is only allowed with env development, got %q", c.Env)
+
+	exporter, err := tracing.ParseExporter(string(c.Tracing.Exporter))
+	check(&c.Tracing.Exporter, err == nil, "%v", err)
+	if err == nil {
+		c.Tracing.Exporter = exporter
+	}
+
+	check(&c.Trash.RetentionDays, c.Trash.RetentionDays >= 0, "must be at least 0, got %d", c.Trash.RetentionDays)
+	positive(&c.Trash.PurgeInterval)
+
+	return errors.Join(errs...)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// LogValue implements slog.LogValuer: the settings by YAML key, secrets redacted.
+func (c *Config) LogValue() slog.Value {
+	fields := c.fields()
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.key, reflect.ValueOf(f.value).Elem().Interface()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Print writes c to w as YAML, secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Usage writes the flags, their environment variables and defaults to w.
+func Usage(w io.Writer) {
+	def := Default()
+	fmt.Fprintln(w, "usage: person-enricher [flags] [serve | migrate ... | import ... | export ... | config print]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  -%s FILE\t%s\tYAML configuration file\n", FileFlag, FileEnv)
+	for _, f := range def.fields() {
+		usage := f.usage
+		if v := fmt.Sprint(reflect.ValueOf(f.value).Elem().Interface()); v != "" && v != "0" && v != "false" {
+			usage += fmt.Sprintf(" (default %s)", v)
+		}
+		fmt.Fprintf(tw, "  -%s\t%s\t%s\n", f.flag, f.env, usage)
+	}
+	tw.Flush()
+}
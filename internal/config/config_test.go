@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"person-enricher/internal/tracing"
+)
+
+// env returns a getenv reading vars.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// writeFile writes a configuration file for the test and returns its path.
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, args, err := Load(nil, env(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Equal(t, Default(), *cfg)
+	assert.Equal(t, slog.LevelInfo, cfg.Log.SlogLevel())
+	assert.Nil(t, cfg.Metrics.Labels())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+db:
+  host: file-host
+  port: 5433
+  name: file-db
+http:
+  addr: ":9000"
+metrics:
+  const_labels: region=eu
+`)
+	vars := map[string]string{
+		FileEnv:   path,
+		"DB_PORT": "5434",
+		"DB_NAME": "env-db",
+	}
+
+	cfg, args, err := Load([]string{"-db-name", "flag-db", "-log-level=WARN", "migrate", "up"}, env(vars))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"migrate", "up"}, args)
+	assert.Equal(t, "file-host", cfg.DB.Host, "the file overrides the default")
+	assert.Equal(t, 5434, cfg.DB.Port, "the environment overrides the file")
+	assert.Equal(t, "flag-db", cfg.DB.Name, "the flags override the environment")
+	assert.Equal(t, ":9000", cfg.HTTP.Addr)
+	assert.Equal(t, "postgres", cfg.DB.User, "the default is kept")
+	assert.Equal(t, "warn", cfg.Log.Level, "the level is normalized")
+	assert.Equal(t, slog.LevelWarn, cfg.Log.SlogLevel())
+	assert.Equal(t, "eu", cfg.Metrics.Labels()["region"])
+
+	other := writeFile(t, "db:\n  host: other-host\n")
+	cfg, _, err = Load([]string{"-config", other}, env(vars))
+	assert.NoError(t, err)
+	assert.Equal(t, "other-host", cfg.DB.Host, "the flag names the file over CONFIG_FILE")
+}
+
+func TestLoadFlags(t *testing.T) {
+	cfg, _, err := Load([]string{"-env", "development", "-log-unredacted", "-tracing-exporter", " STDOUT ", "-enricher-timeout", "3s"}, env(nil))
+	assert.NoError(t, err)
+	assert.True(t, cfg.Log.Unredacted)
+	assert.Equal(t, tracing.ExporterStdout, cfg.Tracing.Exporter)
+	assert.Equal(t, 3*time.Second, cfg.Enricher.Timeout)
+
+	_, _, err = Load([]string{"-h"}, env(nil))
+	assert.ErrorIs(t, err, flag.ErrHelp)
+
+	_, _, err = Load([]string{"-unknown"}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		vars map[string]string
+		want []string
+	}{
+		{
+			name: "unparsable values",
+			vars: map[string]string{"DB_PORT": "x", "TRASH_PURGE_INTERVAL": "hourly"},
+			args: []string{"-log-unredacted=maybe"},
+			want: []string{
+				`DB_PORT: invalid value "x", expected an integer`,
+				`TRASH_PURGE_INTERVAL: invalid value "hourly", expected a duration`,
+				`-log-unredacted: invalid value "maybe", expected true or false`,
+			},
+		},
+		{
+			name: "invalid values",
+			vars: map[string]string{
+				"DB_PORT":                    "70000",
+				"DB_SSLMODE":                 "sometimes",
+				"HTTP_PORT":                  "8080",
+				"LOG_LEVEL":                  "loud",
+				"TRACING_EXPORTER":           "jaeger",
+				"METRICS_CONST_LABELS":       "__name=x",
+				"TRASH_RETENTION_DAYS":       "-1",
+				"ENRICHER_TIMEOUT":           "0s",
+				"IDEMPOTENCY_PURGE_INTERVAL": "-1h",
+			},
+			want: []string{
+				"db.port (DB_PORT, -db-port): must be between 1 and 65535, got 70000",
+				"db.sslmode (DB_SSLMODE, -db-sslmode): must be one of disable",
+				`http.addr (HTTP_PORT, -http-addr): must be host:port or :port, got "8080"`,
+				"log.level (LOG_LEVEL, -log-level):",
+				"tracing.exporter (TRACING_EXPORTER, -tracing-exporter):",
+				"metrics.const_labels (METRICS_CONST_LABELS, -metrics-const-labels):",
+				"trash.retention_days (TRASH_RETENTION_DAYS, -trash-retention-days): must be at least 0, got -1",
+				"enricher.timeout (ENRICHER_TIMEOUT, -enricher-timeout): must be positive, got 0s",
+				"http.idempotency_purge_interval (IDEMPOTENCY_PURGE_INTERVAL, -idempotency-purge-interval): must be positive, got -1h0m0s",
+			},
+		},
+		{
+			name: "inconsistent values",
+			vars: map[string]string{"METRICS_PORT": ":8080", "LOG_UNREDACTED": "true", "SHUTDOWN_READINESS_DELAY": "1m"},
+			want: []string{
+				`metrics.addr (METRICS_PORT, -metrics-addr): must differ from http.addr, both are ":8080"`,
+				`log.unredacted (LOG_UNREDACTED, -log-unredacted): is only allowed with env development, got "production"`,
+				"http.shutdown_readiness_delay (SHUTDOWN_READINESS_DELAY, -shutdown-readiness-delay): must be at least 0 and shorter than http.shutdown_timeout (30s), got 1m0s",
+			},
+		},
+		{
+			name: "database secrets",
+			vars: map[string]string{
+				"DATABASE_URL":      "mysql://app:s3cret@db/people",
+				"DATABASE_URL_FILE": "/run/secrets/url",
+				"DB_PASSWORD":       "pw",
+				"DB_PASSWORD_FILE":  "/nonexistent/password",
+				"DB_SSLCERT":        "/nonexistent/cert.pem",
+			},
+			want: []string{
+				"db.url (DATABASE_URL, -db-url): must be a postgres:// URL",
+				"db.url_file (DATABASE_URL_FILE, -db-url-file): cannot be set with db.url",
+				"db.password_file (DB_PASSWORD_FILE, -db-password-file): open /nonexistent/password",
+				"db.sslkey (DB_SSLKEY, -db-sslkey): must be set with db.sslcert",
+			},
+		},
+		{
+			name: "missing tokens file",
+			vars: map[string]string{"AUTH_TOKENS_FILE": "/nonexistent/tokens"},
+			want: []string{"auth.tokens_file (AUTH_TOKENS_FILE, -auth-tokens-file): read tokens: open /nonexistent/tokens"},
+		},
+		{
+			name: "unknown file key",
+			vars: map[string]string{FileEnv: "FILE"},
+			want: []string{"field hostname not found"},
+		},
+		{
+			name: "missing file",
+			args: []string{"-config", "/nonexistent/config.yaml"},
+			want: []string{"config file:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.vars[FileEnv] == "FILE" {
+				tt.vars[FileEnv] = writeFile(t, "db:\n  hostname: typo\n")
+			}
+			cfg, _, err := Load(tt.args, env(tt.vars))
+			assert.Nil(t, cfg)
+			for _, want := range tt.want {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestLoadDatabaseURL(t *testing.T) {
+	secret := writeFile(t, "s3cret\n")
+	cfg, _, err := Load(nil, env(map[string]string{
+		"DATABASE_URL":     "postgresql://app@db.internal/people",
+		"DB_PORT":          "0",
+		"DB_PASSWORD_FILE": secret,
+	}))
+	assert.NoError(t, err, "the host, port, user, name and sslmode are not required with a URL")
+	assert.Equal(t, Secret("postgresql://app@db.internal/people"), cfg.DB.URL)
+	assert.Equal(t, secret, cfg.DB.PasswordFile)
+
+	var printed bytes.Buffer
+	assert.NoError(t, cfg.Print(&printed))
+	assert.Contains(t, printed.String(), "url: '[REDACTED]'")
+}
+
+func TestSecretRedacted(t *testing.T) {
+	cfg, _, err := Load([]string{"-db-password", "s3cret"}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, Secret("s3cret"), cfg.DB.Password)
+
+	var printed bytes.Buffer
+	assert.NoError(t, cfg.Print(&printed))
+	assert.NotContains(t, printed.String(), "s3cret")
+	assert.Contains(t, printed.String(), "password: '[REDACTED]'")
+
+	var logged bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logged, nil)).Info("config", "config", cfg)
+	assert.NotContains(t, logged.String(), "s3cret")
+	var line struct {
+		Config map[string]any `json:"config"`
+	}
+	assert.NoError(t, json.Unmarshal(logged.Bytes(), &line))
+	assert.Equal(t, "[REDACTED]", line.Config["db.password"])
+	assert.Equal(t, "localhost", line.Config["db.host"])
+}
+
+func TestPrintRoundTrip(t *testing.T) {
+	cfg, _, err := Load([]string{"-db-host", "db.internal", "-trash-retention-days", "30"}, env(nil))
+	assert.NoError(t, err)
+	var printed bytes.Buffer
+	assert.NoError(t, cfg.Print(&printed))
+
+	loaded, _, err := Load([]string{"-config", writeFile(t, printed.String())}, env(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, loaded, "the printed configuration loads back as it is")
+}
+
+func TestUsage(t *testing.T) {
+	var buf bytes.Buffer
+	Usage(&buf)
+	assert.Contains(t, buf.String(), "-db-port")
+	assert.Contains(t, buf.String(), "DB_PORT")
+	assert.Contains(t, buf.String(), "(default 5432)")
+}
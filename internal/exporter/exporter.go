@@ -0,0 +1,231 @@
+// Package exporter writes people as CSV, NDJSON or Parquet, for the export
+// subcommand and GET /people/export.
+//
+// People are written one by one as the service streams them, so an export of the
+// whole table needs memory for one Parquet row group at most.
+package exporter
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is the format of an export.
+type Format string
+
+const (
+	// FormatCSV — comma-separated values with a header row
+	FormatCSV Format = "csv"
+	// FormatNDJSON — one JSON object per line
+	FormatNDJSON Format = "ndjson"
+	// FormatParquet — Apache Parquet, columns compressed with Snappy
+	FormatParquet Format = "parquet"
+)
+
+// parquetRowGroupSize is the number of people buffered into each Parquet row group.
+const parquetRowGroupSize = 64 * 1024
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatNDJSON, FormatParquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected csv, ndjson or parquet", s)
+}
+
+// FormatFromPath returns the format of a file by its extension, and whether it
+// is compressed with gzip (a .gz suffix).
+func FormatFromPath(path string) (Format, bool, error) {
+	gz := strings.EqualFold(filepath.Ext(path), ".gz")
+	if gz {
+		path = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, gz, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, gz, nil
+	case ".parquet":
+		return FormatParquet, gz, nil
+	}
+	return "", false, fmt.Errorf("can not tell the format of %q, expected .csv, .ndjson, .jsonl or .parquet", path)
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Options configures an export.
+type Options struct {
+	Format Format
+	// Gzip compresses the whole output with gzip
+	Gzip bool
+}
+
+// Export writes every person matching the filter to w and returns how many
+// were written. The paging fields of the filter are ignored.
+func Export(ctx context.Context, s service.PersonService, filter models.PeopleFilter, w io.Writer, opts Options) (int, error) {
+	var gz *gzip.Writer
+	if opts.Gzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	enc, err := newEncoder(w, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	if err := s.ExportPeople(ctx, filter, func(p models.Person) error {
+		if err := enc.encode(p); err != nil {
+			return fmt.Errorf("write %s: %w", opts.Format, err)
+		}
+		n++
+		return nil
+	}); err != nil {
+		return n, err
+	}
+
+	if err := enc.close(); err != nil {
+		return n, fmt.Errorf("write %s: %w", opts.Format, err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return n, fmt.Errorf("write gzip: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// encoder writes people in one format. close writes what is still buffered,
+// e.g. the Parquet footer, and must be called after the last person.
+type encoder interface {
+	encode(p models.Person) error
+	close() error
+}
+
+func newEncoder(w io.Writer, format Format) (encoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w)
+	case FormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		return &parquetEncoder{w: parquet.NewGenericWriter[row](w, parquet.Compression(&parquet.Snappy))}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// csvHeader is the header row of a CSV export.
+var csvHeader = []string{"id", "name", "surname", "patronymic", "age", "gender", "nationality", "version", "created_at", "updated_at"}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) (*csvEncoder, error) {
+	c := &csvEncoder{w: csv.NewWriter(w)}
+	if err := c.w.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("write csv: %w", err)
+	}
+	return c, nil
+}
+
+func (c *csvEncoder) encode(p models.Person) error {
+	return c.w.Write([]string{
+		p.ID,
+		p.Name,
+		p.Surname,
+		p.Patronymic,
+		strconv.Itoa(p.Age),
+		p.Gender,
+		p.Nationality,
+		strconv.FormatInt(p.Version, 10),
+		p.CreatedAt.UTC().Format(time.RFC3339Nano),
+		p.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (c *csvEncoder) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonEncoder) encode(p models.Person) error {
+	return n.enc.Encode(p)
+}
+
+func (n *ndjsonEncoder) close() error {
+	return nil
+}
+
+// row is a person in a Parquet export.
+type row struct {
+	ID          string    `parquet:"id"`
+	Name        string    `parquet:"name"`
+	Surname     string    `parquet:"surname"`
+	Patronymic  string    `parquet:"patronymic,optional"`
+	Age         int32     `parquet:"age"`
+	Gender      string    `parquet:"gender,optional"`
+	Nationality string    `parquet:"nationality,optional"`
+	Version     int64     `parquet:"version"`
+	CreatedAt   time.Time `parquet:"created_at,timestamp(microsecond)"`
+	UpdatedAt   time.Time `parquet:"updated_at,timestamp(microsecond)"`
+}
+
+type parquetEncoder struct {
+	w        *parquet.GenericWriter[row]
+	buffered int
+}
+
+func (e *parquetEncoder) encode(p models.Person) error {
+	if _, err := e.w.Write([]row{{
+		ID:          p.ID,
+		Name:        p.Name,
+		Surname:     p.Surname,
+		Patronymic:  p.Patronymic,
+		Age:         int32(p.Age),
+		Gender:      p.Gender,
+		Nationality: p.Nationality,
+		Version:     p.Version,
+		CreatedAt:   p.CreatedAt.UTC(),
+		UpdatedAt:   p.UpdatedAt.UTC(),
+	}}); err != nil {
+		return err
+	}
+	e.buffered++
+	if e.buffered < parquetRowGroupSize {
+		return nil
+	}
+	e.buffered = 0
+	return e.w.Flush()
+}
+
+func (e *parquetEncoder) close() error {
+	return e.w.Close()
+}
@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var created = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeService exports people, failing with err after them if it is set.
+type fakeService struct {
+	service.PersonService
+	people []models.Person
+	err    error
+}
+
+func (f *fakeService) ExportPeople(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error {
+	for _, p := range f.people {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+func testPeople() []models.Person {
+	return []models.Person{
+		{ID: "1", Name: "Ivan", Surname: "Ivanov", Patronymic: "Ivanovich", Age: 30, Gender: "male", Nationality: "RU", Version: 2, CreatedAt: created, UpdatedAt: created},
+		{ID: "2", Name: "Anna", Surname: "Petrova", Version: 1, CreatedAt: created, UpdatedAt: created},
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		format  Format
+		gzip    bool
+		wantErr bool
+	}{
+		{"people.csv", FormatCSV, false, false},
+		{"out/people.jsonl.gz", FormatNDJSON, true, false},
+		{"people.PARQUET", FormatParquet, false, false},
+		{"people.txt", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			format, gz, err := FormatFromPath(tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.format, format)
+			assert.Equal(t, tt.gzip, gz)
+		})
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	var out bytes.Buffer
+	n, err := Export(context.Background(), &fakeService{people: testPeople()}, models.PeopleFilter{}, &out, Options{Format: FormatCSV})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "id,name,surname,patronymic,age,gender,nationality,version,created_at,updated_at\n"+
+		"1,Ivan,Ivanov,Ivanovich,30,male,RU,2,2024-05-01T12:00:00Z,2024-05-01T12:00:00Z\n"+
+		"2,Anna,Petrova,,0,,,1,2024-05-01T12:00:00Z,2024-05-01T12:00:00Z\n", out.String())
+}
+
+func TestExport_NDJSONGzip(t *testing.T) {
+	var out bytes.Buffer
+	n, err := Export(context.Background(), &fakeService{people: testPeople()}, models.PeopleFilter{}, &out, Options{Format: FormatNDJSON, Gzip: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	gz, err := gzip.NewReader(&out)
+	assert.NoError(t, err)
+	dec := json.NewDecoder(gz)
+	var got []models.Person
+	for {
+		var p models.Person
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else {
+			assert.NoError(t, err)
+		}
+		got = append(got, p)
+	}
+	assert.Equal(t, testPeople(), got)
+}
+
+func TestExport_Parquet(t *testing.T) {
+	var out bytes.Buffer
+	n, err := Export(context.Background(), &fakeService{people: testPeople()}, models.PeopleFilter{}, &out, Options{Format: FormatParquet})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	r := parquet.NewGenericReader[row](bytes.NewReader(out.Bytes()))
+	rows := make([]row, 3)
+	read, err := r.Read(rows)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 2, read)
+	assert.Equal(t, row{
+		ID: "1", Name: "Ivan", Surname: "Ivanov", Patronymic: "Ivanovich", Age: 30, Gender: "male",
+		Nationality: "RU", Version: 2, CreatedAt: created, UpdatedAt: created,
+	}, rows[0])
+	assert.Equal(t, "Anna", rows[1].Name)
+	assert.Equal(t, "", rows[1].Patronymic)
+}
+
+func TestExport_Error(t *testing.T) {
+	var out bytes.Buffer
+	svc := &fakeService{people: testPeople()[:1], err: errors.New("db error")}
+	n, err := Export(context.Background(), svc, models.PeopleFilter{}, &out, Options{Format: FormatNDJSON})
+
+	assert.EqualError(t, err, "db error")
+	assert.Equal(t, 1, n)
+}
@@ -3,12 +3,16 @@ package externalapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"time"
+	"person-enricher/internal/logging"
 	"person-enricher/internal/models"
+	"person-enricher/internal/tracing"
 )
 
 // EnrichPersonalData is an interface for enriching personal data
@@ -34,55 +38,67 @@ type personalDataEnricher struct {
 // NewPersonalDataEnricher creates a new instance of personalDataEnricher with a default HTTP client.
 // It returns an EnrichPersonalData interface, which provides methods for enriching personal data
 // such as age, gender, and nationality using external APIs.
-func NewPersonalDataEnricher() EnrichPersonalData {
+// Each call gets a client span and sends the trace context in the traceparent header,
+// and gives up after timeout.
+func NewPersonalDataEnricher(timeout time.Duration) EnrichPersonalData {
 	return &personalDataEnricher{
-		client: &http.Client{},
+		client: &http.Client{Transport: tracing.NewTransport(nil), Timeout: timeout},
 	}
 }
 
+// do sends req with the client of p. The query of the request holds the name of
+// the person, so the URL of a *url.Error it returns is redacted by logging.URL.
+func (p *personalDataEnricher) do(req *http.Request) (*http.Response, error) {
+	resp, err := p.client.Do(req)
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL = logging.URL(req.URL)
+	}
+	return resp, err
+}
+
 // GetPersonAge returns person age by name
 //
 // It calls the Agify API (https://agify.io/) and returns person age.
 // If the API returns an error or empty age field, it returns an error.
 func (p *personalDataEnricher) GetPersonAge(ctx context.Context, name string) (int, error) {
 	// Create endpoint
-	log.Printf("personalDataEnricher.GetPersonAge: getting person age by name: %s", name)
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonAge: getting person age by name", "name", logging.PII(name))
 	endpoint := fmt.Sprintf("https://api.agify.io/?name=%s", url.QueryEscape(name))
-	log.Printf("personalDataEnricher.GetPersonAge: endpoint: %s", endpoint)
 
 	// Create request
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	log.Printf("personalDataEnricher.GetPersonAge: request created: %v", req)
+	slog.DebugContext(ctx, "personalDataEnricher.GetPersonAge: request created", "url", logging.URL(req.URL))
 
 	// Send request
-	log.Printf("personalDataEnricher.GetPersonAge: sending request")
-	resp, err := p.client.Do(req)
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonAge: sending request")
+	resp, err := p.do(req)
 	if err != nil {
-		log.Printf("personalDataEnricher.GetPersonAge: could not send request: %v", err)
+		slog.ErrorContext(ctx, "personalDataEnricher.GetPersonAge: could not send request", "error", err)
 		return 0, fmt.Errorf("could not send agify request: %w", err)
 	}
-	log.Printf("personalDataEnricher.GetPersonAge: request sent: %v", resp)
+	slog.DebugContext(ctx, "personalDataEnricher.GetPersonAge: request sent", "status", resp.Status)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("personalDataEnricher.GetPersonAge: agify returned non-200 status code %d: %s", resp.StatusCode, string(body))
-		return 0, fmt.Errorf("agify returned non-200 status code %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+		slog.WarnContext(ctx, "personalDataEnricher.GetPersonAge: agify returned non-200 status code", "status_code", resp.StatusCode, "body", logging.Sensitive{Value: string(body)})
+		return 0, &StatusError{API: "agify", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	log.Printf("personalDataEnricher.GetPersonAge: decoding agify response")
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonAge: decoding agify response")
 	var ar models.AgifyResponse
 	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
-		log.Printf("personalDataEnricher.GetPersonAge: could not decode agify response: %v", err)
-		return 0, fmt.Errorf("could not decode agify response: %w", err)
+		slog.ErrorContext(ctx, "personalDataEnricher.GetPersonAge: could not decode agify response", "error", err)
+		return 0, fmt.Errorf("%w: could not decode agify response: %w", ErrDecode, err)
 	}
 
 	if ar.Age != nil {
-		log.Printf("personalDataEnricher.GetPersonAge: age: %d", *ar.Age)
+		slog.InfoContext(ctx, "personalDataEnricher.GetPersonAge: age found", "age", *ar.Age)
 		return *ar.Age, nil
 	} else {
-		log.Printf("personalDataEnricher.GetPersonAge: agify returned empty age field")
-		return 0, fmt.Errorf("agify returned empty age field")
+		slog.InfoContext(ctx, "personalDataEnricher.GetPersonAge: agify returned empty age field")
+		return 0, fmt.Errorf("%w: agify returned empty age field", ErrEmptyResult)
 	}
 }
 
@@ -92,43 +108,43 @@ func (p *personalDataEnricher) GetPersonAge(ctx context.Context, name string) (i
 // If the API request fails, the response cannot be decoded, or the gender field is empty, an error is returned.
 func (p *personalDataEnricher) GetPersonGender(ctx context.Context, name string) (string, error) {
 	// Create endpoint
-	log.Printf("personalDataEnricher.GetPersonGender: getting person gender by name: %s", name)
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonGender: getting person gender by name", "name", logging.PII(name))
 	endpoint := fmt.Sprintf("https://api.genderize.io/?name=%s", url.QueryEscape(name))
 
 	// Create request
-	log.Printf("personalDataEnricher.GetPersonGender: creating request")
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonGender: creating request")
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	log.Printf("personalDataEnricher.GetPersonGender: request created: %v", req)
+	slog.DebugContext(ctx, "personalDataEnricher.GetPersonGender: request created", "url", logging.URL(req.URL))
 
 	// Send request
-	log.Printf("personalDataEnricher.GetPersonGender: sending request")
-	resp, err := p.client.Do(req)
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonGender: sending request")
+	resp, err := p.do(req)
 	if err != nil {
-		log.Printf("personalDataEnricher.GetPersonGender: could not send request: %v", err)
+		slog.ErrorContext(ctx, "personalDataEnricher.GetPersonGender: could not send request", "error", err)
 		return "", fmt.Errorf("could not send genderize request: %w", err)
 	}
-	log.Printf("personalDataEnricher.GetPersonGender: request sent: %v", resp)
+	slog.DebugContext(ctx, "personalDataEnricher.GetPersonGender: request sent", "status", resp.Status)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("personalDataEnricher.GetPersonGender: genderize returned non-200 status code %d", resp.StatusCode)
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("genderize returned non-200 status code %d: %s", resp.StatusCode, string(body))
+		slog.WarnContext(ctx, "personalDataEnricher.GetPersonGender: genderize returned non-200 status code", "status_code", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+		return "", &StatusError{API: "genderize", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var gr models.GenderizeResponse
-	log.Printf("personalDataEnricher.GetPersonGender: decoding genderize response")
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonGender: decoding genderize response")
 	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
-		log.Printf("personalDataEnricher.GetPersonGender: could not decode genderize response: %v", err)
-		return "", fmt.Errorf("could not decode genderize response: %w", err)
+		slog.ErrorContext(ctx, "personalDataEnricher.GetPersonGender: could not decode genderize response", "error", err)
+		return "", fmt.Errorf("%w: could not decode genderize response: %w", ErrDecode, err)
 	}
 
 	if gr.Gender != nil {
-		log.Printf("personalDataEnricher.GetPersonGender: gender: %s", *gr.Gender)
+		slog.InfoContext(ctx, "personalDataEnricher.GetPersonGender: gender found", "gender", *gr.Gender)
 		return *gr.Gender, nil
 	} else {
-		log.Printf("personalDataEnricher.GetPersonGender: genderize returned empty gender field")
-		return "", fmt.Errorf("genderize returned empty gender field")
+		slog.InfoContext(ctx, "personalDataEnricher.GetPersonGender: genderize returned empty gender field")
+		return "", fmt.Errorf("%w: genderize returned empty gender field", ErrEmptyResult)
 	}
 }
 
@@ -139,41 +155,40 @@ func (p *personalDataEnricher) GetPersonGender(ctx context.Context, name string)
 // If the API request fails, the response cannot be decoded, or the nationality field is empty, an error is returned.
 func (p *personalDataEnricher) GetPersonNationality(ctx context.Context, name string) (string, error) {
 	// Create endpoint
-	log.Printf("personalDataEnricher.GetPersonNationality: getting person nationality by name: %s", name)
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonNationality: getting person nationality by name", "name", logging.PII(name))
 	endpoint := fmt.Sprintf("https://api.nationalize.io/?name=%s", url.QueryEscape(name))
-	log.Printf("personalDataEnricher.GetPersonNationality: endpoint: %s", endpoint)
 
 	// Create request
-	log.Printf("personalDataEnricher.GetPersonNationality: creating request")
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonNationality: creating request")
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	log.Printf("personalDataEnricher.GetPersonNationality: request created: %v", req)
+	slog.DebugContext(ctx, "personalDataEnricher.GetPersonNationality: request created", "url", logging.URL(req.URL))
 
 	// Send request
-	log.Printf("personalDataEnricher.GetPersonNationality: sending request")
-	resp, err := p.client.Do(req)
+	slog.InfoContext(ctx, "personalDataEnricher.GetPersonNationality: sending request")
+	resp, err := p.do(req)
 	if err != nil {
-		log.Printf("personalDataEnricher.GetPersonNationality: could not send request: %v", err)
+		slog.ErrorContext(ctx, "personalDataEnricher.GetPersonNationality: could not send request", "error", err)
 		return "", fmt.Errorf("could not send nationalize request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("personalDataEnricher.GetPersonNationality: nationalize returned non-200 status code %d", resp.StatusCode)
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("nationalize returned non-200 status code %d: %s", resp.StatusCode, string(body))
+		slog.WarnContext(ctx, "personalDataEnricher.GetPersonNationality: nationalize returned non-200 status code", "status_code", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+		return "", &StatusError{API: "nationalize", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var nr models.NationalizeResponse
 	if err := json.NewDecoder(resp.Body).Decode(&nr); err != nil {
-		log.Printf("personalDataEnricher.GetPersonNationality: could not decode nationalize response: %v", err)
-		return "", fmt.Errorf("could not decode nationalize response: %w", err)
+		slog.ErrorContext(ctx, "personalDataEnricher.GetPersonNationality: could not decode nationalize response", "error", err)
+		return "", fmt.Errorf("%w: could not decode nationalize response: %w", ErrDecode, err)
 	}
 
 	if len(nr.Country) > 0 {
-		log.Printf("personalDataEnricher.GetPersonNationality: country: %s", nr.Country[0].CountryID)
+		slog.InfoContext(ctx, "personalDataEnricher.GetPersonNationality: country found", "country", nr.Country[0].CountryID)
 		return nr.Country[0].CountryID, nil
 	} else {
-		log.Printf("personalDataEnricher.GetPersonNationality: nationalize returned empty country field")
-		return "", fmt.Errorf("nationalize returned empty country field")
+		slog.InfoContext(ctx, "personalDataEnricher.GetPersonNationality: nationalize returned empty country field")
+		return "", fmt.Errorf("%w: nationalize returned empty country field", ErrEmptyResult)
 	}
 }
\ No newline at end of file
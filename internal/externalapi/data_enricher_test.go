@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -211,3 +214,57 @@ func TestGetPersonNationality(t *testing.T) {
 		})
 	}
 }
+
+func TestClientErrorRedactsName(t *testing.T) {
+	client := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return nil, &url.Error{Op: "Get", URL: req.URL.String(), Err: errors.New("connection refused")}
+	}}
+	e := newPersonalDataEnricherWithClient(client)
+
+	_, err := e.GetPersonAge(context.Background(), "Ivan")
+	assert.ErrorContains(t, err, "api.agify.io")
+	assert.NotContains(t, err.Error(), "Ivan")
+}
+
+func TestStatusErrorBody(t *testing.T) {
+	client := &mockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return makeResponse(http.StatusBadRequest, `{"error":"invalid name Ivan"}`+strings.Repeat(" ", 2*MaxErrorBodySize)), nil
+	}}
+	e := newPersonalDataEnricherWithClient(client)
+
+	_, err := e.GetPersonAge(context.Background(), "Ivan")
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Len(t, statusErr.Body, MaxErrorBodySize)
+	assert.NotContains(t, err.Error(), "Ivan")
+}
+
+func TestResult(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"ok", nil, ResultOK},
+		{"empty", fmt.Errorf("%w: agify returned empty age field", ErrEmptyResult), ResultEmpty},
+		{"rate limited", &StatusError{API: "agify", StatusCode: http.StatusTooManyRequests}, ResultRateLimited},
+		{"http error", &StatusError{API: "agify", StatusCode: http.StatusBadGateway}, ResultHTTPError},
+		{"decode error", fmt.Errorf("%w: could not decode agify response: %w", ErrDecode, io.ErrUnexpectedEOF), ResultDecodeError},
+		{"deadline", fmt.Errorf("could not send agify request: %w", context.DeadlineExceeded), ResultTimeout},
+		{"client timeout", &url.Error{Op: "Get", URL: "https://api.agify.io/", Err: timeoutError{}}, ResultTimeout},
+		{"connection refused", errors.New("connection refused"), ResultHTTPError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Result(tt.err))
+		})
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return false }
@@ -0,0 +1,75 @@
+package externalapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Errors of the enricher APIs, told apart by Result.
+var (
+	// ErrEmptyResult is returned when an API has no prediction for the name.
+	ErrEmptyResult = errors.New("empty result")
+	// ErrRateLimited is matched by a StatusError with status 429 Too Many Requests.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrHTTPStatus is matched by a StatusError with any other status.
+	ErrHTTPStatus = errors.New("unexpected status")
+	// ErrDecode is returned when the response of an API cannot be decoded.
+	ErrDecode = errors.New("invalid response")
+)
+
+// MaxErrorBodySize bounds the body of an error response kept in a StatusError.
+const MaxErrorBodySize = 4 << 10
+
+// StatusError is returned when an API answers with a status other than 200 OK.
+type StatusError struct {
+	API        string
+	StatusCode int
+	// Body is the start of the response body, up to MaxErrorBodySize bytes. It may echo
+	// the name that was looked up, so Error leaves it out; log it as logging.Sensitive.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned non-200 status code %d", e.API, e.StatusCode)
+}
+
+// Is matches ErrRateLimited for status 429 Too Many Requests and ErrHTTPStatus otherwise.
+func (e *StatusError) Is(target error) bool {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return target == ErrRateLimited
+	}
+	return target == ErrHTTPStatus
+}
+
+// Results of the enricher API calls, see Result.
+const (
+	ResultOK          = "ok"
+	ResultEmpty       = "empty"
+	ResultRateLimited = "rate_limited"
+	ResultHTTPError   = "http_error"
+	ResultDecodeError = "decode_error"
+	ResultTimeout     = "timeout"
+)
+
+// Result returns the result of an API call that returned err. Failures to send
+// the request are http errors, unless the request timed out.
+func Result(err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ResultOK
+	case errors.Is(err, ErrEmptyResult):
+		return ResultEmpty
+	case errors.Is(err, ErrRateLimited):
+		return ResultRateLimited
+	case errors.Is(err, ErrDecode):
+		return ResultDecodeError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ResultTimeout
+	default:
+		return ResultHTTPError
+	}
+}
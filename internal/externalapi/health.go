@@ -0,0 +1,71 @@
+package externalapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Addrs are the addresses of the enricher APIs.
+var Addrs = []string{"api.agify.io:443", "api.genderize.io:443", "api.nationalize.io:443"}
+
+// CheckReachable reports whether the enricher APIs accept connections. It only dials
+// them, since a request would count against their rate limits. The returned error
+// joins those of the unreachable APIs.
+func CheckReachable(ctx context.Context) error {
+	return dialAll(ctx, Addrs)
+}
+
+// ReachabilityTTL is how long the result of CheckReachable is reused by NewReachabilityCheck.
+const ReachabilityTTL = 30 * time.Second
+
+// NewReachabilityCheck returns CheckReachable with its result reused for ttl, so that the
+// readiness probes of every replica do not dial the APIs each time.
+func NewReachabilityCheck(ttl time.Duration) func(ctx context.Context) error {
+	return cached(ttl, CheckReachable)
+}
+
+// cached returns check with its result reused for ttl. A check canceled by its caller
+// says nothing of the APIs, so its result is not kept; one that timed out is.
+func cached(ttl time.Duration, check func(ctx context.Context) error) func(ctx context.Context) error {
+	var (
+		mu      sync.Mutex
+		checked time.Time
+		result  error
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return result
+		}
+		err := check(ctx)
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			checked, result = time.Now(), err
+		}
+		return err
+	}
+}
+
+func dialAll(ctx context.Context, addrs []string) error {
+	errs := make([]error, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s unreachable: %w", addr, err)
+				return
+			}
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
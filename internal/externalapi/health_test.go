@@ -0,0 +1,51 @@
+package externalapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialAll(t *testing.T) {
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer up.Close()
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	down.Close()
+
+	assert.NoError(t, dialAll(context.Background(), []string{up.Addr().String()}))
+
+	err = dialAll(context.Background(), []string{up.Addr().String(), down.Addr().String()})
+	assert.ErrorContains(t, err, down.Addr().String()+" unreachable")
+	assert.NotContains(t, err.Error(), up.Addr().String())
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	boom := errors.New("boom")
+	check := cached(time.Hour, func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return ctx.Err()
+		}
+		return boom
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, check(ctx), context.Canceled)
+	assert.ErrorIs(t, check(context.Background()), boom, "a canceled check is not kept")
+	assert.ErrorIs(t, check(context.Background()), boom)
+	assert.Equal(t, 2, calls, "the result is reused within the ttl")
+
+	calls = 0
+	check = cached(0, func(ctx context.Context) error { calls++; return nil })
+	check(context.Background())
+	check(context.Background())
+	assert.Equal(t, 2, calls)
+}
@@ -9,32 +9,36 @@ import (
 
 type metricsEnricher struct {
 	enricher EnrichPersonalData
+	m        *metrics.Metrics
 }
 
-func NewMetricsEnricher(enricher EnrichPersonalData) EnrichPersonalData {
-	return &metricsEnricher{enricher: enricher}
+func NewMetricsEnricher(enricher EnrichPersonalData, m *metrics.Metrics) EnrichPersonalData {
+	return &metricsEnricher{enricher: enricher, m: m}
 }
 
-func (e *metricsEnricher) GetPersonAge(ctx context.Context, name string) (int, error) {
+func (e *metricsEnricher) GetPersonAge(ctx context.Context, name string) (_ int, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.EnricherRequestDuration.WithLabelValues("age").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, e.m.EnricherRequestDuration.WithLabelValues("age"), time.Since(start).Seconds())
+		e.m.EnricherRequestsTotal.WithLabelValues("agify", Result(err)).Inc()
 	}()
 	return e.enricher.GetPersonAge(ctx, name)
 }
 
-func (e *metricsEnricher) GetPersonGender(ctx context.Context, name string) (string, error) {
+func (e *metricsEnricher) GetPersonGender(ctx context.Context, name string) (_ string, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.EnricherRequestDuration.WithLabelValues("gender").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, e.m.EnricherRequestDuration.WithLabelValues("gender"), time.Since(start).Seconds())
+		e.m.EnricherRequestsTotal.WithLabelValues("genderize", Result(err)).Inc()
 	}()
 	return e.enricher.GetPersonGender(ctx, name)
 }
 
-func (e *metricsEnricher) GetPersonNationality(ctx context.Context, name string) (string, error) {
+func (e *metricsEnricher) GetPersonNationality(ctx context.Context, name string) (_ string, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.EnricherRequestDuration.WithLabelValues("nationality").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, e.m.EnricherRequestDuration.WithLabelValues("nationality"), time.Since(start).Seconds())
+		e.m.EnricherRequestsTotal.WithLabelValues("nationalize", Result(err)).Inc()
 	}()
 	return e.enricher.GetPersonNationality(ctx, name)
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GetDuplicates responds to GET /people/duplicates requests.
+// It reads the threshold, page and size query parameters, calls h.service.GetDuplicates
+// and writes the pairs of likely duplicates, most similar first, with status code 200.
+// The threshold is the minimum similarity of a pair, from 0 to 1, by default
+// service.DefaultDuplicateThreshold.
+// If a query parameter is invalid, it returns a 400 error.
+// If the duplicates could not be fetched, it returns a 500 error.
+func (h *Handler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.GetDuplicates: getting duplicates")
+	q := r.URL.Query()
+	page, size, err := parsePage(r.Context(), q)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+		return
+	}
+	threshold := service.DefaultDuplicateThreshold
+	if t := q.Get("threshold"); t != "" {
+		if v, err := strconv.ParseFloat(t, 64); err == nil && v > 0 && v <= 1 {
+			threshold = v
+		} else {
+			slog.InfoContext(r.Context(), "handlers.GetDuplicates: invalid threshold parameter", "threshold", t)
+			respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, "invalid threshold parameter, expected a number in (0, 1]")
+			return
+		}
+	}
+
+	pairs, err := h.service.GetDuplicates(r.Context(), threshold, page, size)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.GetDuplicates: could not get duplicates", "error", err)
+		respondServiceError(w, r, err, "could not fetch duplicates")
+		return
+	}
+	slog.InfoContext(r.Context(), "handlers.GetDuplicates: got pairs", "count", len(pairs))
+
+	resp := make([]models.DuplicatePairResponse, len(pairs))
+	for i, p := range pairs {
+		resp[i] = models.DuplicatePairResponse{
+			First:  toPersonResponse(p.First),
+			Second: toPersonResponse(p.Second),
+			Score:  p.Score,
+		}
+	}
+	respondJSON(w, r, http.StatusOK, resp)
+}
+
+// MergePerson responds to POST /people/{id}/merge requests.
+// It merges the person duplicate_id of the JSON body into the person of the path,
+// which survives, and writes the survivor with status code 200. The fields listed
+// in take get the value of the duplicate, like the fields the survivor has no value
+// for. The duplicate is deleted, and GET /people/{id} of its id redirects to the survivor.
+// If-Match is required like for PUT: 428 without it, 412 if the survivor has changed.
+// If the body is invalid JSON, it returns a 400 error.
+// If the duplicate is the survivor itself or take lists an unknown field, it returns a 422 error.
+// If either person is not found, it returns a 404 error.
+// If the people could not be merged, it returns a 500 error.
+func (h *Handler) MergePerson(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.MergePerson: merging person")
+	id := mux.Vars(r)["id"]
+	if strings.TrimSpace(id) == "" {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidID, "id is required")
+		return
+	}
+	var req models.MergeRequest
+	if err := decodeJSON(r, &req); err != nil {
+		slog.InfoContext(r.Context(), "handlers.MergePerson: invalid JSON", "error", err)
+		respondDecodeError(w, r, err)
+		return
+	}
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "handlers.MergePerson: invalid If-Match", "error", err)
+		respondIfMatchError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.MergePerson: send merge request to service")
+	merged, err := h.service.MergePeople(r.Context(), id, req.DuplicateID, version, req.Take)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.MergePerson: could not merge people", "error", err)
+		respondServiceError(w, r, err, "could not merge people")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.MergePerson: people merged")
+	respondPersonJSON(w, r, http.StatusOK, merged)
+}
+
+// respondDuplicates writes the 409 answered by POST /people when the person to
+// create looks like existing people, and reports whether err was such an error.
+func respondDuplicates(w http.ResponseWriter, r *http.Request, err error) bool {
+	var derr *models.DuplicateError
+	if !errors.As(err, &derr) {
+		return false
+	}
+	resp := models.DuplicateResponse{
+		Problem: newProblem(r, http.StatusConflict, models.CodeDuplicatePerson,
+			"person looks like existing people, create it without check_duplicates to proceed"),
+		Duplicates: make([]models.PersonResponse, len(derr.People)),
+	}
+	for i, p := range derr.People {
+		resp.Duplicates[i] = toPersonResponse(p)
+	}
+	respondJSONAs(w, r, problemContentType, http.StatusConflict, resp)
+	return true
+}
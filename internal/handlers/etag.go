@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"person-enricher/internal/models"
+	"strconv"
+	"strings"
+)
+
+// The entity tag of a person is its version in quotes, e.g. "3". It is a strong
+// tag: the version changes with every update of the person.
+
+var (
+	errIfMatchMissing = errors.New("If-Match header is required, send the ETag of the person")
+	errIfMatchInvalid = errors.New("If-Match must be a single entity tag or *")
+)
+
+// etag returns the entity tag for the given person version.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// respondPersonJSON writes a person like respondJSON, together with its ETag.
+func respondPersonJSON(w http.ResponseWriter, r *http.Request, status int, p models.Person) {
+	w.Header().Set("ETag", etag(p.Version))
+	respondJSON(w, r, status, toPersonResponse(p))
+}
+
+// ifMatchVersion returns the person version required by the If-Match header,
+// 0 for "*", which matches any version.
+// A weak or foreign entity tag can never match, it yields models.ErrVersionMismatch.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case tag == "":
+		return 0, errIfMatchMissing
+	case tag == "*":
+		return 0, nil
+	case strings.Contains(tag, ","):
+		return 0, errIfMatchInvalid
+	}
+
+	// strong comparison: W/"3" does not match "3"
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, fmt.Errorf("%w: If-Match %s is not a current entity tag", models.ErrVersionMismatch, tag)
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%w: If-Match %s is not a current entity tag", models.ErrVersionMismatch, tag)
+	}
+	return version, nil
+}
+
+// respondIfMatchError writes the response for an error returned by ifMatchVersion:
+// 428 if the header is missing, 412 if it cannot match and 400 if it is malformed.
+func respondIfMatchError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errIfMatchMissing):
+		respondError(w, r, http.StatusPreconditionRequired, models.CodePreconditionRequired, err.Error())
+	case errors.Is(err, models.ErrVersionMismatch):
+		respondServiceError(w, r, err, "")
+	default:
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidPrecondition, err.Error())
+	}
+}
+
+// noneMatch reports whether the If-None-Match header matches tag.
+// GET uses the weak comparison, so W/"3" matches "3".
+func noneMatch(r *http.Request, tag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"person-enricher/internal/exporter"
+	"person-enricher/internal/models"
+	"strings"
+)
+
+// ExportPeople responds to GET /people/export requests.
+// It streams every person matching the filter and match query parameters of
+// GET /people, ordered by id and from one consistent snapshot, in the format
+// given by the format query parameter: csv (default), ndjson or parquet.
+// The output is compressed with Content-Encoding: gzip if the client accepts it.
+// If a query parameter is invalid, it returns a 400 error.
+// If the export fails before anything was written, it returns a 500 error;
+// once the output has started, the connection is aborted instead so that the
+// client does not mistake a truncated export for a complete one.
+func (h *Handler) ExportPeople(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.ExportPeople: exporting people")
+	q := r.URL.Query()
+	pf, err := parsePeopleFilter(r.Context(), q)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+		return
+	}
+	format := exporter.FormatCSV
+	if f := q.Get("format"); f != "" {
+		if format, err = exporter.ParseFormat(f); err != nil {
+			respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, "invalid format parameter")
+			return
+		}
+	}
+	opts := exporter.Options{Format: format, Gzip: acceptsGzip(r)}
+
+	out := &exportWriter{ResponseWriter: w, start: func() {
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="people.`+string(format)+`"`)
+		w.Header().Add("Vary", "Accept-Encoding")
+		if opts.Gzip {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		w.WriteHeader(http.StatusOK)
+	}}
+	n, err := exporter.Export(r.Context(), h.service, pf, out, opts)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.ExportPeople: export failed", "exported", n, "error", err)
+		if !out.started {
+			respondServiceError(w, r, err, "could not export people")
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+	if !out.started {
+		out.start()
+	}
+	slog.InfoContext(r.Context(), "handlers.ExportPeople: people exported", "count", n)
+}
+
+// exportWriter sends the response headers of an export with the first write, so
+// that an export failing before it wrote anything can still answer with an error.
+type exportWriter struct {
+	http.ResponseWriter
+	start   func()
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.start()
+	}
+	return e.ResponseWriter.Write(p)
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
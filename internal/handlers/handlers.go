@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"person-enricher/internal/importer"
+	"person-enricher/internal/logging"
 	"person-enricher/internal/models"
 	"person-enricher/internal/service"
+	"person-enricher/internal/validation"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -22,15 +32,17 @@ func NewHandler(s service.PersonService) *Handler {
 	return &Handler{service: s}
 }
 
-// respondError writes an error response in JSON format.
-// It sets the Content-Type header to application/json,
-// the status code to the given status, and encodes the error message
-// in the request body as a models.ErrorResponse.
-func respondError(w http.ResponseWriter, status int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	log.Printf("handlers.respondError: %s", msg)
-	json.NewEncoder(w).Encode(models.ErrorResponse{Error: msg})
+// decodeJSON decodes the JSON body of r into v. A field v does not have is
+// rejected with a *models.ValidationError naming it.
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if field, ok := strings.CutPrefix(fmt.Sprint(err), "json: unknown field "); ok {
+		name, _ := strconv.Unquote(field)
+		return &models.ValidationError{Fields: []validation.FieldError{validation.UnknownField(name)}}
+	}
+	return err
 }
 
 func toPersonResponse(p models.Person) models.PersonResponse {
@@ -42,214 +54,636 @@ func toPersonResponse(p models.Person) models.PersonResponse {
 		Age:         p.Age,
 		Gender:      p.Gender,
 		Nationality: p.Nationality,
+		Version:     p.Version,
+		Score:       p.Score,
+		DeletedAt:   deletedAt(p),
+	}
+}
+
+// deletedAt returns the deletion time of a soft-deleted person, or nil.
+func deletedAt(p models.Person) *time.Time {
+	if !p.DeletedAt.Valid {
+		return nil
 	}
+	t := p.DeletedAt.Time
+	return &t
 }
 
 // respondJSON writes a JSON response with the given status code and payload.
 // It sets the Content-Type header to application/json, the status code to the given status,
 // and encodes the payload in the request body as a JSON object.
-func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+func respondJSON(w http.ResponseWriter, r *http.Request, status int, payload interface{}) {
+	respondJSONAs(w, r, "application/json", status, payload)
+}
+
+// respondJSONAs writes a JSON response like respondJSON, but with the given Content-Type.
+func respondJSONAs(w http.ResponseWriter, r *http.Request, contentType string, status int, payload interface{}) {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
-	log.Printf("handlers.respondJSON: %v", payload)
+	slog.DebugContext(r.Context(), "handlers.respondJSON: response", "status", status, "payload", logging.Sensitive{Value: payload})
 	json.NewEncoder(w).Encode(payload)
 }
 
-// GetPeople responds to GET /people requests.
-// It reads the page and size query parameters and calls h.service.GetPeople with the given filter.
-// It returns the list of people as a JSON object with status code 200.
-// If the page or size is invalid, it returns a 400 error.
-// If the people could not be fetched, it returns a 500 error.
-func (h *Handler) GetPeople(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-
-	// filter
-	log.Printf("handlers.GetPeople: getting people with filter: %s", q.Get("filter"))
-	filterStr := strings.TrimSpace(q.Get("filter"))
-
-	// page
-	page := 1
+// parsePage reads the page and size query parameters, 1 and 10 by default. It returns
+// an error with a client-facing message if either is invalid.
+func parsePage(ctx context.Context, q url.Values) (page, size int, err error) {
+	page = 1
 	if p := q.Get("page"); p != "" {
 		if v, err := strconv.Atoi(p); err == nil && v > 0 {
 			page = v
 		} else {
-			log.Printf("handlers.GetPeople: invalid page parameter: %s", p)
-			respondError(w, http.StatusBadRequest, "invalid page parameter")
-			return
+			slog.InfoContext(ctx, "handlers.parsePage: invalid page parameter", "page", p)
+			return 0, 0, errors.New("invalid page parameter")
 		}
 	}
-	log.Printf("handlers.GetPeople: page: %d", page)
+	slog.DebugContext(ctx, "handlers.parsePage: page", "page", page)
 
-	// size
-	size := 10
+	size = 10
 	if s := q.Get("size"); s != "" {
 		if v, err := strconv.Atoi(s); err == nil && v > 0 {
 			size = v
 		} else {
-			log.Printf("handlers.GetPeople: invalid size parameter: %s", s)
-			respondError(w, http.StatusBadRequest, "invalid size parameter")
-			return
+			slog.InfoContext(ctx, "handlers.parsePage: invalid size parameter", "size", s)
+			return 0, 0, errors.New("invalid size parameter")
 		}
 	}
-	log.Printf("handlers.GetPeople: size: %d", size)
+	slog.DebugContext(ctx, "handlers.parsePage: size", "size", size)
+	return page, size, nil
+}
 
+// parsePeopleFilter reads the filter, match, page, size and count query parameters
+// shared by the people listings. It returns an error with a client-facing message
+// if any of them is invalid.
+func parsePeopleFilter(ctx context.Context, q url.Values) (models.PeopleFilter, error) {
 	// filter
-	pf := models.PeopleFilter{
-		Filter: filterStr,
-		Page:   page,
-		Size:   size,
+	slog.DebugContext(ctx, "handlers.parsePeopleFilter: filter", "filter", logging.PII(q.Get("filter")))
+	filterStr := strings.TrimSpace(q.Get("filter"))
+
+	// page and size
+	page, size, err := parsePage(ctx, q)
+	if err != nil {
+		return models.PeopleFilter{}, err
+	}
+
+	// count
+	estimate := false
+	switch c := q.Get("count"); c {
+	case "", "exact":
+	case "estimated":
+		estimate = true
+	default:
+		slog.InfoContext(ctx, "handlers.parsePeopleFilter: invalid count parameter", "count", c)
+		return models.PeopleFilter{}, errors.New("invalid count parameter")
+	}
+
+	// match
+	fuzzy := false
+	switch m := q.Get("match"); m {
+	case "", "substring":
+	case "fuzzy":
+		fuzzy = true
+	default:
+		slog.InfoContext(ctx, "handlers.parsePeopleFilter: invalid match parameter", "match", m)
+		return models.PeopleFilter{}, errors.New("invalid match parameter")
+	}
+
+	return models.PeopleFilter{
+		Filter:        filterStr,
+		Fuzzy:         fuzzy,
+		Page:          page,
+		Size:          size,
+		EstimateTotal: estimate,
+	}, nil
+}
+
+// GetPeople responds to GET /people requests.
+// It reads the filter, match, page, size and count query parameters and calls h.service.GetPeople with the given filter.
+// It returns the list of people as a JSON array with status code 200.
+// If the Accept header asks for the v2 media type, it calls h.service.GetPeoplePage instead and
+// returns a paginated envelope with the total count together with RFC 8288 Link headers.
+// With match=fuzzy the filter is matched by trigram similarity and the results are ranked by score.
+// If the match, page, size or count is invalid, it returns a 400 error.
+// If the people could not be fetched, it returns a 500 error.
+func (h *Handler) GetPeople(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.GetPeople: getting people")
+	pf, err := parsePeopleFilter(r.Context(), r.URL.Query())
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+		return
+	}
+	slog.InfoContext(r.Context(), "handlers.GetPeople: parsed filter", "filter", pf)
+
+	w.Header().Add("Vary", "Accept")
+	if acceptsPeopleV2(r) {
+		slog.InfoContext(r.Context(), "handlers.GetPeople: send page request to service")
+		peoplePage, err := h.service.GetPeoplePage(r.Context(), pf)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "handlers.GetPeople: could not get people page", "error", err)
+			respondServiceError(w, r, err, "could not fetch people")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "handlers.GetPeople: got people page", "count", len(peoplePage.People), "total", peoplePage.Total)
+		w.Header().Set("Link", paginationLinks(r.URL, peoplePage))
+		respondJSONAs(w, r, mediaTypePeopleV2, http.StatusOK, toPeoplePageResponse(peoplePage))
+		return
 	}
-	log.Printf("handlers.GetPeople: result people filter: %v", pf)
 
 	// get people
-	log.Printf("handlers.GetPeople: getting people")
-	log.Printf("handlers.GetPeople: send request to service")
+	slog.InfoContext(r.Context(), "handlers.GetPeople: send request to service")
 	people, err := h.service.GetPeople(r.Context(), pf)
 	if err != nil {
-		log.Printf("handlers.GetPeople: could not get people: %v", err)
-		respondError(w, http.StatusInternalServerError, "could not fetch people")
+		slog.ErrorContext(r.Context(), "handlers.GetPeople: could not get people", "error", err)
+		respondServiceError(w, r, err, "could not fetch people")
 		return
 	}
 
 
-	log.Printf("handlers.GetPeople: got %d people", len(people))
-	respondJSON(w, http.StatusOK, people)
+	slog.InfoContext(r.Context(), "handlers.GetPeople: got people", "count", len(people))
+	respondJSON(w, r, http.StatusOK, people)
 }
 
 // GetPersonByID responds to GET /people/{id} requests.
 // It reads the id path parameter, calls h.service.GetPersonByID with the given id,
-// and writes the response as a JSON object with status code 200.
-// If the id is empty, it returns a 400 error.
+// and writes the response as a JSON object with status code 200 and the ETag header.
+// If the If-None-Match header matches the ETag, it returns 304 without a body.
+// With the as_of query parameter it returns the person as it was at that time.
+// If the id is malformed, it returns a 400 error.
 // If the person is not found, it returns a 404 error.
+// If the person was merged into another one, it redirects there with 308.
 func (h *Handler) GetPersonByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	log.Printf("handlers.GetPersonByID: getting person with id: %s", id)
-	log.Printf("handlers.GetPersonByID: send request to service")
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		h.getPersonAsOf(w, r, id, asOf)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.GetPersonByID: getting person with id", "id", id)
+	slog.InfoContext(r.Context(), "handlers.GetPersonByID: send request to service")
 	person, err := h.service.GetPersonByID(r.Context(), id)
 	if err != nil {
-		log.Printf("handlers.GetPersonByID: could not get person: %v", err)
-		respondError(w, http.StatusInternalServerError, "internal service error")
+		slog.ErrorContext(r.Context(), "handlers.GetPersonByID: could not get person", "error", err)
+		respondServiceError(w, r, err, "internal service error")
+		return
+	}
+	slog.DebugContext(r.Context(), "handlers.GetPersonByID: got person", "person", person)
+
+	tag := etag(person.Version)
+	if noneMatch(r, tag) {
+		slog.InfoContext(r.Context(), "handlers.GetPersonByID: person not modified")
+		w.Header().Set("ETag", tag)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	log.Printf("handlers.GetPersonByID: got person: %v", person)
-	if person == (models.Person{}) {
-		log.Printf("handlers.GetPersonByID: person not found")
-		respondError(w, http.StatusNotFound, "person not found")
+	respondPersonJSON(w, r, http.StatusOK, person)
+}
+
+// getPersonAsOf answers GET /people/{id}?as_of=<RFC 3339 time> with the person
+// as it was at that time. Historical versions carry no ETag.
+func (h *Handler) getPersonAsOf(w http.ResponseWriter, r *http.Request, id, asOf string) {
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		slog.InfoContext(r.Context(), "handlers.GetPersonByID: invalid as_of parameter", "as_of", asOf)
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, "invalid as_of parameter, expected RFC 3339 time")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.GetPersonByID: getting person with id as of", "id", id, "at", at)
+	person, err := h.service.GetPersonAsOf(r.Context(), id, at)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.GetPersonByID: could not get person as of", "at", at, "error", err)
+		respondServiceError(w, r, err, "internal service error")
+		return
+	}
+	respondJSON(w, r, http.StatusOK, toPersonResponse(person))
+}
+
+// GetPersonHistory responds to GET /people/{id}/history requests.
+// It reads the id path parameter and the page and size query parameters, calls
+// h.service.GetPersonHistory and writes the changes, oldest first, with status code 200.
+// Every change holds the person before and after it, the changed fields, the actor,
+// the request id and the source.
+// If the page or size parameter is invalid, or the id is malformed, it returns a 400 error.
+// If the person never existed, it returns a 404 error.
+func (h *Handler) GetPersonHistory(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.GetPersonHistory: getting history of person")
+	id := mux.Vars(r)["id"]
+
+	page, size, err := parsePage(r.Context(), r.URL.Query())
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+		return
+	}
+
+	changes, err := h.service.GetPersonHistory(r.Context(), id, page, size)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.GetPersonHistory: could not get history", "error", err)
+		respondServiceError(w, r, err, "could not fetch person history")
 		return
 	}
+	slog.InfoContext(r.Context(), "handlers.GetPersonHistory: got changes", "count", len(changes))
 
-	respondJSON(w, http.StatusOK, toPersonResponse(person))
+	respondJSON(w, r, http.StatusOK, changes)
 }
 
 // CreatePerson responds to POST /people requests.
-// It reads the JSON body, validates the name and surname fields,
+// It reads the JSON body, validates it with models.CreatePersonRequest.Validate,
 // calls h.service.CreatePerson with the given request, and writes the response
 // as a JSON object with status code 201.
 // If the body is invalid JSON, it returns a 400 error.
-// If the name or surname is empty, it returns a 400 error.
+// If the body has unknown or invalid fields, it returns a 400 error listing them.
+// With check_duplicates=true, if the person looks like existing people, it returns
+// a 409 error with them before anything is enriched or created.
+// If the person conflicts with an existing one, it returns a 409 error.
 // If the person could not be created, it returns a 500 error.
 func (h *Handler) CreatePerson(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handlers.CreatePerson: creating person")
+	slog.InfoContext(r.Context(), "handlers.CreatePerson: creating person")
 	var req models.CreatePersonRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("handlers.CreatePerson: invalid JSON: %v", err)
-		respondError(w, http.StatusBadRequest, "invalid JSON")
+	if err := decodeJSON(r, &req); err != nil {
+		slog.InfoContext(r.Context(), "handlers.CreatePerson: invalid JSON", "error", err)
+		respondDecodeError(w, r, err)
 		return
 	}
 	// validate neccessary fields
-	log.Printf("handlers.CreatePerson: validating neccessary fields")
-	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Surname) == "" {
-		respondError(w, http.StatusBadRequest, "name and surname are required")
+	slog.InfoContext(r.Context(), "handlers.CreatePerson: validating neccessary fields")
+	if err := req.Validate(); err != nil {
+		respondValidationError(w, r, http.StatusBadRequest, err)
 		return
 	}
-	log.Printf("handlers.CreatePerson: name: %s, surname: %s", req.Name, req.Surname)
+	slog.DebugContext(r.Context(), "handlers.CreatePerson: request", "request", req)
 
-	log.Printf("handlers.CreatePerson: send request to service")
+	if check := r.URL.Query().Get("check_duplicates"); check != "" {
+		enabled, err := strconv.ParseBool(check)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, "invalid check_duplicates parameter")
+			return
+		}
+		if enabled {
+			slog.InfoContext(r.Context(), "handlers.CreatePerson: checking duplicates")
+			if err := h.service.CheckDuplicates(r.Context(), req); err != nil {
+				slog.ErrorContext(r.Context(), "handlers.CreatePerson: duplicate check failed", "error", err)
+				if !respondDuplicates(w, r, err) {
+					respondServiceError(w, r, err, "could not check duplicates")
+				}
+				return
+			}
+		}
+	}
+
+	slog.InfoContext(r.Context(), "handlers.CreatePerson: send request to service")
 	person, err := h.service.CreatePerson(r.Context(), req)
 	if err != nil {
-		log.Printf("handlers.CreatePerson: could not create person: %v", err)
-		respondError(w, http.StatusInternalServerError, "could not create person")
+		slog.ErrorContext(r.Context(), "handlers.CreatePerson: could not create person", "error", err)
+		respondServiceError(w, r, err, "could not create person")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.CreatePerson: person created", "id", person.ID)
+	respondPersonJSON(w, r, http.StatusCreated, person)
+}
+
+// CreatePeople responds to POST /people:batch requests.
+// It reads a JSON body with the mode and the items to create, calls
+// h.service.CreatePeople and writes a models.BatchResponse with the outcome of
+// every item in the order of the request.
+// If the body is invalid JSON or has unknown fields, the mode is unknown, or there
+// are no items or more than service.MaxBatchSize of them, it returns a 400 error.
+// Invalid items fail with the list of their invalid fields.
+// If every item was created, it returns 201. If an atomic batch failed, nothing is
+// created and it returns 422; if some items of a partial batch failed, 207.
+// If the people could not be created, it returns a 500 error.
+func (h *Handler) CreatePeople(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.CreatePeople: creating people")
+	var req models.CreatePeopleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		slog.InfoContext(r.Context(), "handlers.CreatePeople: invalid JSON", "error", err)
+		respondDecodeError(w, r, err)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = models.BatchAtomic
+	}
+	if req.Mode != models.BatchAtomic && req.Mode != models.BatchPartial {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "mode must be atomic or partial")
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > service.MaxBatchSize {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidRequest, fmt.Sprintf("items must contain from 1 to %d people", service.MaxBatchSize))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.CreatePeople: send items to service", "count", len(req.Items))
+	items, err := h.service.CreatePeople(r.Context(), req.Items, req.Mode)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.CreatePeople: could not create people", "error", err)
+		respondServiceError(w, r, err, "could not create people")
+		return
+	}
+
+	resp := models.BatchResponse{Mode: req.Mode, Items: make([]models.BatchItemResponse, len(items))}
+	for i, item := range items {
+		resp.Items[i] = models.BatchItemResponse{Index: i, Status: item.Status}
+		switch item.Status {
+		case models.BatchCreated:
+			person := toPersonResponse(item.Person)
+			resp.Items[i].Person = &person
+			resp.Created++
+		case models.BatchFailed:
+			_, resp.Items[i].Code, resp.Items[i].Error = serviceProblem(item.Err, "could not create person")
+			var verr *models.ValidationError
+			if errors.As(item.Err, &verr) {
+				resp.Items[i].Errors = verr.Fields
+			}
+			resp.Failed++
+		}
+	}
+
+	status := http.StatusCreated
+	switch {
+	case resp.Failed > 0 && req.Mode == models.BatchAtomic:
+		status = http.StatusUnprocessableEntity
+	case resp.Failed > 0:
+		status = http.StatusMultiStatus
+	}
+	slog.InfoContext(r.Context(), "handlers.CreatePeople: batch processed", "created", resp.Created, "failed", resp.Failed)
+	respondJSON(w, r, status, resp)
+}
+
+// maxImportSize is the largest file POST /people:import accepts.
+const maxImportSize = 32 << 20
+
+// ImportPeople responds to POST /people:import requests.
+// The body is a CSV file with a header row (Content-Type: text/csv) or NDJSON
+// (Content-Type: application/x-ndjson); the map query parameter names the columns
+// the fields are read from, e.g. map=name=first_name,surname=last_name.
+// It imports the people with the importer package and writes a models.ImportResult
+// with the rejected lines and status code 200.
+// If the content type is not supported, it returns a 415 error.
+// If the mapping is invalid or a mapped column is missing, it returns a 400 error.
+// If the file is larger than 32 MiB, it returns a 413 error.
+// If the import stops, it returns a 500 error; the lines up to the last one
+// reported in the message were imported.
+func (h *Handler) ImportPeople(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.ImportPeople: importing people")
+	format, err := importer.FormatFromContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		w.Header().Set("Accept", "text/csv, application/x-ndjson")
+		respondError(w, r, http.StatusUnsupportedMediaType, models.CodeUnsupportedMediaType, "content type must be text/csv or application/x-ndjson")
+		return
+	}
+	mapping, err := importer.ParseMapping(r.URL.Query().Get("map"))
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	result, err := importer.New(h.service, importer.Options{Format: format, Mapping: mapping}).Run(r.Context(), body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondError(w, r, http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, "file is larger than 32 MiB")
+		return
+	case errors.Is(err, importer.ErrInvalidFile):
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "handlers.ImportPeople: import failed", "error", err)
+		respondError(w, r, http.StatusInternalServerError, models.CodeImportInterrupted, fmt.Sprintf("import stopped, lines up to %d were processed", result.LastLine))
 		return
 	}
 
-	log.Printf("handlers.CreatePerson: person created: %v", person)
-	respondJSON(w, http.StatusCreated, toPersonResponse(person))
+	slog.InfoContext(r.Context(), "handlers.ImportPeople: import done", "created", result.Created, "rejected", result.Rejected)
+	respondJSON(w, r, http.StatusOK, result)
 }
 
 // UpdatePerson responds to PUT /people/{id} requests.
-// It reads the JSON body, validates the name, surname, age, gender and nationality fields,
+// It reads the JSON body, validates it with models.UpdatePersonRequest.Validate,
 // calls h.service.UpdatePerson with the given request, and writes the response
 // as a JSON object with status code 200.
-// If the body is invalid JSON, it returns a 400 error.
-// If the name, surname, age, gender or nationality is empty, it returns a 400 error.
+// If the body is invalid JSON, or the id is malformed, it returns a 400 error.
+// If the body has unknown or invalid fields, it returns a 400 error listing them.
+// The If-Match header must carry the ETag of the person: without it the handler
+// returns a 428 error, if the person has changed since, a 412 error.
+// If the person is not found, it returns a 404 error.
 // If the person could not be updated, it returns a 500 error.
 func (h *Handler) UpdatePerson(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handlers.UpdatePerson: updating person")
+	slog.InfoContext(r.Context(), "handlers.UpdatePerson: updating person")
 	var req models.UpdatePersonRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("handlers.UpdatePerson: invalid JSON: %v", err)
-		respondError(w, http.StatusBadRequest, "invalid JSON")
+	if err := decodeJSON(r, &req); err != nil {
+		slog.InfoContext(r.Context(), "handlers.UpdatePerson: invalid JSON", "error", err)
+		respondDecodeError(w, r, err)
 		return
 	}
 	
 	// check id
-	log.Printf("handlers.UpdatePerson: checking id")
+	slog.InfoContext(r.Context(), "handlers.UpdatePerson: checking id")
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if strings.TrimSpace(id) == "" {
-		respondError(w, http.StatusBadRequest, "id is required")
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidID, "id is required")
 		return
 	}
 
 	// validate neccessary fields
-	log.Printf("handlers.UpdatePerson: validating neccessary fields")
-	if strings.TrimSpace(req.Name) == "" ||
-		strings.TrimSpace(req.Surname) == "" ||
-		req.Age <= 0 ||
-		strings.TrimSpace(req.Gender) == "" ||
-		strings.TrimSpace(req.Nationality) == "" {
-		respondError(w, http.StatusBadRequest, "name, surname, age (>0), gender and nationality are required")
+	slog.InfoContext(r.Context(), "handlers.UpdatePerson: validating neccessary fields")
+	if err := req.Validate(); err != nil {
+		respondValidationError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	slog.DebugContext(r.Context(), "handlers.UpdatePerson: request", "request", req)
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "handlers.UpdatePerson: invalid If-Match", "error", err)
+		respondIfMatchError(w, r, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.UpdatePerson: send update request to service")
+	updated, err := h.service.UpdatePerson(r.Context(), id, version, req)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.UpdatePerson: could not update person", "error", err)
+		respondServiceError(w, r, err, "could not update person")
+		return
+	}
+	slog.InfoContext(r.Context(), "handlers.UpdatePerson: person updated", "version", updated.Version)
+
+	respondPersonJSON(w, r, http.StatusOK, updated)
+}
+
+// maxPatchSize limits the body of PATCH /people/{id}.
+const maxPatchSize = 1 << 16
+
+// acceptPatch lists the media types PATCH /people/{id} accepts.
+var acceptPatch = string(models.MergePatch) + ", " + string(models.JSONPatch)
+
+// PatchPerson responds to PATCH /people/{id} requests.
+// The body is an RFC 7396 merge patch (application/merge-patch+json), where null clears
+// a field, or an RFC 6902 JSON patch (application/json-patch+json). It calls
+// h.service.PatchPerson and writes the patched person with status code 200.
+// Any other content type is answered with 415 and the Accept-Patch header.
+// If the patch is malformed or cannot be applied, it returns a 400 error.
+// If the patched person is invalid, it returns a 422 error.
+// If-Match is required like for PUT: 428 without it, 412 if the person has changed.
+// If the person is not found, it returns a 404 error.
+func (h *Handler) PatchPerson(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.PatchPerson: patching person")
+	id := mux.Vars(r)["id"]
+	if strings.TrimSpace(id) == "" {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidID, "id is required")
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	patchType := models.PatchType(mediaType)
+	if err != nil || (patchType != models.MergePatch && patchType != models.JSONPatch) {
+		slog.InfoContext(r.Context(), "handlers.PatchPerson: unsupported content type", "content_type", r.Header.Get("Content-Type"))
+		w.Header().Set("Accept-Patch", acceptPatch)
+		respondError(w, r, http.StatusUnsupportedMediaType, models.CodeUnsupportedMediaType, "content type must be one of: "+acceptPatch)
+		return
+	}
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "handlers.PatchPerson: invalid If-Match", "error", err)
+		respondIfMatchError(w, r, err)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil {
+		slog.InfoContext(r.Context(), "handlers.PatchPerson: could not read body", "error", err)
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "could not read body")
 		return
 	}
-	log.Printf("handlers.UpdatePerson: name: %s, surname: %s, age: %d, gender: %s, nationality: %s", req.Name, req.Surname, req.Age, req.Gender, req.Nationality)
 
-	log.Printf("handlers.UpdatePerson: send update request to service")
-	updated, err := h.service.UpdatePerson(r.Context(), id, req)
+	slog.InfoContext(r.Context(), "handlers.PatchPerson: send patch request to service")
+	patched, err := h.service.PatchPerson(r.Context(), id, version, patchType, patch)
 	if err != nil {
-		log.Printf("handlers.UpdatePerson: could not update person: %v", err)
-		respondError(w, http.StatusInternalServerError, "could not update person")
+		slog.ErrorContext(r.Context(), "handlers.PatchPerson: could not patch person", "error", err)
+		respondServiceError(w, r, err, "could not patch person")
 		return
 	}
-	log.Printf("handlers.UpdatePerson: person updated: %v", updated)
+	slog.InfoContext(r.Context(), "handlers.PatchPerson: person patched", "version", patched.Version)
 
-	respondJSON(w, http.StatusOK, toPersonResponse(updated))
+	respondPersonJSON(w, r, http.StatusOK, patched)
 }
 
 // DeletePerson responds to DELETE /people/{id} requests.
 // It reads the id path parameter, calls h.service.DeletePerson with the given id,
-// and writes the response as a JSON object with status code 204.
-// If the id is empty, it returns a 400 error.
+// and writes the response as a JSON object with status code 200.
+// If the id is empty or malformed, it returns a 400 error.
+// If-Match is required like for PUT: 428 without it, 412 if the person has changed.
+// If the person is not found, it returns a 404 error.
 // If the person could not be deleted, it returns a 500 error.
 func (h *Handler) DeletePerson(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handlers.DeletePerson: deleting person")
+	slog.InfoContext(r.Context(), "handlers.DeletePerson: deleting person")
 	vars := mux.Vars(r)
 	id := vars["id"]
 	if strings.TrimSpace(id) == "" {
-		log.Printf("handlers.DeletePerson: id is required")
-		respondError(w, http.StatusBadRequest, "id is required")
+		slog.InfoContext(r.Context(), "handlers.DeletePerson: id is required")
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidID, "id is required")
+		return
+	}
+
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "handlers.DeletePerson: invalid If-Match", "error", err)
+		respondIfMatchError(w, r, err)
 		return
 	}
 
-	log.Printf("handlers.DeletePerson: send delete request to service")
-	if err := h.service.DeletePerson(r.Context(), id); err != nil {
-		log.Printf("handlers.DeletePerson: could not delete person: %v", err)
-		respondError(w, http.StatusInternalServerError, "could not delete person")
+	slog.InfoContext(r.Context(), "handlers.DeletePerson: send delete request to service")
+	if err := h.service.DeletePerson(r.Context(), id, version); err != nil {
+		slog.ErrorContext(r.Context(), "handlers.DeletePerson: could not delete person", "error", err)
+		respondServiceError(w, r, err, "could not delete person")
 		return
 	}
 
-	log.Printf("handlers.DeletePerson: person deleted")
+	slog.InfoContext(r.Context(), "handlers.DeletePerson: person deleted")
 	// вернуть пользователю информацию, что запись успешно удалена
-	respondJSON(w, http.StatusOK, "the record was successfully deleted")
+	respondJSON(w, r, http.StatusOK, "the record was successfully deleted")
+}
+
+// GetDeletedPeople responds to GET /people/trash requests.
+// It reads the same query parameters as GetPeople, calls h.service.GetDeletedPeople
+// and returns the soft-deleted people with their deleted_at as a JSON array with status code 200.
+// If the parameters are invalid, it returns a 400 error.
+// If the people could not be fetched, it returns a 500 error.
+func (h *Handler) GetDeletedPeople(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.GetDeletedPeople: getting deleted people")
+	pf, err := parsePeopleFilter(r.Context(), r.URL.Query())
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.GetDeletedPeople: send request to service")
+	people, err := h.service.GetDeletedPeople(r.Context(), pf)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.GetDeletedPeople: could not get deleted people", "error", err)
+		respondServiceError(w, r, err, "could not fetch deleted people")
+		return
+	}
+
+	resp := make([]models.PersonResponse, 0, len(people))
+	for _, p := range people {
+		resp = append(resp, toPersonResponse(p))
+	}
+	slog.InfoContext(r.Context(), "handlers.GetDeletedPeople: got deleted people", "count", len(people))
+	respondJSON(w, r, http.StatusOK, resp)
+}
+
+// RestorePerson responds to POST /people/{id}/restore requests.
+// It calls h.service.RestorePerson with the id path parameter and writes
+// the restored person as a JSON object with status code 200.
+// If the id is empty or malformed, it returns a 400 error.
+// If there is no deleted person with the id, it returns a 404 error.
+// If the person could not be restored, it returns a 500 error.
+func (h *Handler) RestorePerson(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.RestorePerson: restoring person")
+	id := mux.Vars(r)["id"]
+	if strings.TrimSpace(id) == "" {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidID, "id is required")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.RestorePerson: send restore request to service")
+	restored, err := h.service.RestorePerson(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "handlers.RestorePerson: could not restore person", "error", err)
+		respondServiceError(w, r, err, "could not restore person")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.RestorePerson: person restored")
+	respondPersonJSON(w, r, http.StatusOK, restored)
+}
+
+// PurgePerson responds to DELETE /people/trash/{id} requests.
+// It calls h.service.PurgePerson with the id path parameter, which permanently
+// deletes a person from the trash, and writes a message with status code 200.
+// If the id is empty or malformed, it returns a 400 error.
+// If there is no deleted person with the id, it returns a 404 error.
+// If the person could not be purged, it returns a 500 error.
+func (h *Handler) PurgePerson(w http.ResponseWriter, r *http.Request) {
+	slog.InfoContext(r.Context(), "handlers.PurgePerson: purging person")
+	id := mux.Vars(r)["id"]
+	if strings.TrimSpace(id) == "" {
+		respondError(w, r, http.StatusBadRequest, models.CodeInvalidID, "id is required")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.PurgePerson: send purge request to service")
+	if err := h.service.PurgePerson(r.Context(), id); err != nil {
+		slog.ErrorContext(r.Context(), "handlers.PurgePerson: could not purge person", "error", err)
+		respondServiceError(w, r, err, "could not purge person")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "handlers.PurgePerson: person purged")
+	respondJSON(w, r, http.StatusOK, "the record was permanently deleted")
 }
@@ -2,15 +2,35 @@ package handlers
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/logging"
+	"person-enricher/internal/metrics"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+	"person-enricher/internal/validation"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+
 func TestGetPeople(t *testing.T) {
 	router, _ := setupTest()
 
@@ -19,23 +39,70 @@ func TestGetPeople(t *testing.T) {
 		query        string
 		statusCode int
 	}{
-		{"valid request", "/people", http.StatusOK},
-		{"custom page and size", "/people?page=2&size=20", http.StatusOK},
-		{"invalid page", "/people?page=abc", http.StatusBadRequest},
-		{"invalid size", "/people?size=abc", http.StatusBadRequest},
-		{"error case", "/people?filter=error", http.StatusInternalServerError},
-		{"empty filter string", "/people?filter=", http.StatusOK},
-		{"custom filter", "/people?filter=Test", http.StatusOK},
-		{"custom page, size, filter", "/people?page=2&size=20&filter=User", http.StatusOK},
+		{"valid request", "/v1/people", http.StatusOK},
+		{"custom page and size", "/v1/people?page=2&size=20", http.StatusOK},
+		{"invalid page", "/v1/people?page=abc", http.StatusBadRequest},
+		{"invalid size", "/v1/people?size=abc", http.StatusBadRequest},
+		{"error case", "/v1/people?filter=error", http.StatusInternalServerError},
+		{"empty filter string", "/v1/people?filter=", http.StatusOK},
+		{"custom filter", "/v1/people?filter=Test", http.StatusOK},
+		{"custom page, size, filter", "/v1/people?page=2&size=20&filter=User", http.StatusOK},
+		{"fuzzy match", "/v1/people?filter=Ushakof&match=fuzzy", http.StatusOK},
+		{"substring match", "/v1/people?filter=Ushakov&match=substring", http.StatusOK},
+		{"invalid match", "/v1/people?filter=Ushakov&match=regex", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestGetPeoplePage(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		statusCode  int
+		contentType string
+		link        string
+	}{
+		{"bare array by default", "/v1/people", "application/json", http.StatusOK, "application/json", ""},
+		{"envelope by vendor media type", "/v1/people?page=2&size=5", mediaTypePeopleV2, http.StatusOK, mediaTypePeopleV2,
+			`</v1/people?page=1&size=5>; rel="first", </v1/people?page=1&size=5>; rel="prev", </v1/people?page=3&size=5>; rel="next"`},
+		{"envelope by version parameter", "/v1/people?page=1&size=5", "application/json; version=2", http.StatusOK, mediaTypePeopleV2,
+			`</v1/people?page=1&size=5>; rel="first", </v1/people?page=2&size=5>; rel="next", </v1/people?page=2&size=5>; rel="last"`},
+		{"filter is kept in links", "/v1/people?filter=Test&size=5", mediaTypePeopleV2, http.StatusOK, mediaTypePeopleV2,
+			`</v1/people?filter=Test&page=1&size=5>; rel="first"`},
+		{"estimated count", "/v1/people?count=estimated", mediaTypePeopleV2, http.StatusOK, mediaTypePeopleV2, ""},
+		{"invalid count", "/v1/people?count=fast", mediaTypePeopleV2, http.StatusBadRequest, "application/problem+json", ""},
+		{"service error", "/v1/people?filter=error", mediaTypePeopleV2, http.StatusInternalServerError, "application/problem+json", ""},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req, _ := http.NewRequest("GET", tt.query, nil)
+			req.Header.Set("Accept", tt.accept)
 			rr := httptest.NewRecorder()
 
 			router.ServeHTTP(rr, req)
 			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Header().Get("Link"), tt.link)
+
+			if tt.statusCode == http.StatusOK && tt.contentType == mediaTypePeopleV2 {
+				var body models.PeoplePageResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				assert.Len(t, body.Items, 1)
+				assert.True(t, body.HasNext)
+			}
 		})
 	}
 }
@@ -50,17 +117,26 @@ func TestGetPersonByID(t *testing.T) {
 	}{
 		{"valid request", "valid-id", http.StatusOK},
 		{"not found", "notfound-id", http.StatusNotFound},
+		{"invalid id", "invalid-id", http.StatusBadRequest},
 		{"service error", "error-id", http.StatusInternalServerError},
+		{"as of", "valid-id?as_of=2024-05-01T12:00:00Z", http.StatusOK},
+		{"as of with offset", "valid-id?as_of=2024-05-01T15:00:00%2B03:00", http.StatusOK},
+		{"invalid as of", "valid-id?as_of=yesterday", http.StatusBadRequest},
+		{"as of not found", "notfound-id?as_of=2024-05-01T12:00:00Z", http.StatusNotFound},
+		{"merged", "merged-id", http.StatusPermanentRedirect},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			url := fmt.Sprintf("/people/%s", tt.id)
+			url := fmt.Sprintf("/v1/people/%s", tt.id)
 			req, _ := http.NewRequest("GET", url, nil)
 			rr := httptest.NewRecorder()
 
 			router.ServeHTTP(rr, req)
 			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusPermanentRedirect {
+				assert.Equal(t, "/v1/people/survivor-id", rr.Header().Get("Location"))
+			}
 		})
 	}
 }
@@ -79,19 +155,405 @@ func TestCreatePerson(t *testing.T) {
 		{"invalid request with empty surname", `{"name":"John","surname":""}`, http.StatusBadRequest},
 		{"invalid request with invalid JSON body", `{"name":"John"}`, http.StatusBadRequest},
 		{"service error", `{"name":"error","surname":"Doe"}`, http.StatusInternalServerError},
+		{"conflict", `{"name":"conflict","surname":"Doe"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/people", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+		want       []validation.FieldError
+	}{
+		{"unknown field", "POST", "/v1/people", `{"name":"John","surname":"Doe","age":30}`, http.StatusBadRequest,
+			[]validation.FieldError{{Field: "age", Code: validation.CodeUnknownField, Message: "age is not a known field"}}},
+		{"invalid fields", "POST", "/v1/people", `{"name":"John2","surname":""}`, http.StatusBadRequest,
+			[]validation.FieldError{
+				{Field: "name", Code: validation.CodeInvalidChars, Message: "name may only contain letters, spaces, hyphens and apostrophes"},
+				{Field: "surname", Code: validation.CodeRequired, Message: "surname is required"},
+			}},
+		{"invalid update", "PUT", "/v1/people/valid-id", `{"name":"John","surname":"Doe","age":200,"gender":"male","nationality":"USA"}`, http.StatusBadRequest,
+			[]validation.FieldError{
+				{Field: "age", Code: validation.CodeOutOfRange, Message: "age must be between 1 and 150"},
+				{Field: "nationality", Code: validation.CodeInvalidValue, Message: "nationality must be an ISO 3166-1 alpha-2 country code, e.g. RU"},
+			}},
+		{"invalid patch result", "PUT", "/v1/people/unprocessable-id", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusUnprocessableEntity,
+			[]validation.FieldError{{Field: "age", Code: validation.CodeRequired, Message: "age is required"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("If-Match", "*")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			var resp models.Problem
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.want, resp.Errors)
+			assert.Equal(t, models.CodeValidationFailed, resp.Code)
+			assert.NotEmpty(t, resp.Detail)
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		statusCode int
+		code       models.ErrorCode
+	}{
+		{"invalid parameter", "GET", "/v1/people?page=0", "", http.StatusBadRequest, models.CodeInvalidParameter},
+		{"invalid JSON", "POST", "/v1/people", `{`, http.StatusBadRequest, models.CodeInvalidJSON},
+		{"not found", "GET", "/v1/people/notfound-id", "", http.StatusNotFound, models.CodePersonNotFound},
+		{"invalid id", "GET", "/v1/people/invalid-id", "", http.StatusBadRequest, models.CodeInvalidID},
+		{"merged", "GET", "/v1/people/merged-id", "", http.StatusPermanentRedirect, models.CodePersonMerged},
+		{"conflict", "DELETE", "/v1/people/conflict-id", "", http.StatusConflict, models.CodePersonConflict},
+		{"service error", "POST", "/v1/people", `{"name":"error","surname":"Doe"}`, http.StatusInternalServerError, models.CodeInternal},
+		{"unsupported media type", "PATCH", "/v1/people/valid-id", `{}`, http.StatusUnsupportedMediaType, models.CodeUnsupportedMediaType},
+		{"unknown route", "GET", "/v1/persons", "", http.StatusNotFound, models.CodeRouteNotFound},
+		{"method not allowed", "PUT", "/v1/people", "", http.StatusMethodNotAllowed, models.CodeMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("If-Match", "*")
+			req.Header.Set("Content-Type", "text/plain")
+			req.Header.Set("X-Request-ID", "req-1")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			var resp models.Problem
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, "urn:person-enricher:problem:"+string(tt.code), resp.Type)
+			assert.NotEmpty(t, resp.Title)
+			assert.Equal(t, tt.statusCode, resp.Status)
+			assert.NotEmpty(t, resp.Detail)
+			assert.Equal(t, req.URL.Path, resp.Instance)
+			assert.Equal(t, tt.code, resp.Code)
+			assert.Equal(t, "req-1", resp.RequestID)
+		})
+	}
+}
+
+func TestCreatePersonCheckDuplicates(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		statusCode int
+	}{
+		{"no duplicates", "check_duplicates=true", `{"name":"John","surname":"Doe"}`, http.StatusCreated},
+		{"duplicates", "check_duplicates=true", `{"name":"duplicate","surname":"Doe"}`, http.StatusConflict},
+		{"check disabled", "check_duplicates=false", `{"name":"duplicate","surname":"Doe"}`, http.StatusCreated},
+		{"invalid parameter", "check_duplicates=maybe", `{"name":"John","surname":"Doe"}`, http.StatusBadRequest},
+		{"service error", "check_duplicates=1", `{"name":"error","surname":"Doe"}`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/people?"+tt.query, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusConflict {
+				var resp models.DuplicateResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Len(t, resp.Duplicates, 1)
+				assert.Equal(t, "dup-id", resp.Duplicates[0].ID)
+			}
+		})
+	}
+}
+
+func TestGetDuplicates(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		score      float64
+	}{
+		{"default threshold", "", http.StatusOK, 0.7},
+		{"custom threshold", "?threshold=0.5&size=5", http.StatusOK, 0.5},
+		{"invalid threshold", "?threshold=2", http.StatusBadRequest, 0},
+		{"invalid size", "?size=abc", http.StatusBadRequest, 0},
+		{"listing parameters ignored", "?match=fuzzy&count=bogus&filter=John", http.StatusOK, 0.7},
+		{"service error", "?page=2", http.StatusInternalServerError, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/v1/people/duplicates"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusOK {
+				var pairs []models.DuplicatePairResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pairs))
+				assert.Len(t, pairs, 1)
+				assert.Equal(t, tt.score, pairs[0].Score)
+			}
+		})
+	}
+}
+
+func TestMergePerson(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		ifMatch    string
+		statusCode int
+	}{
+		{"valid request", "valid-id", `{"duplicate_id":"other-id","take":["surname"]}`, `"3"`, http.StatusOK},
+		{"invalid json", "valid-id", `{invalid}`, `"3"`, http.StatusBadRequest},
+		{"without if-match", "valid-id", `{"duplicate_id":"other-id"}`, "", http.StatusPreconditionRequired},
+		{"stale etag", "valid-id", `{"duplicate_id":"other-id"}`, `"2"`, http.StatusPreconditionFailed},
+		{"duplicate not found", "valid-id", `{"duplicate_id":"notfound-id"}`, `"3"`, http.StatusNotFound},
+		{"invalid merge", "valid-id", `{"duplicate_id":"unprocessable-id"}`, `"3"`, http.StatusUnprocessableEntity},
+		{"service error", "error-id", `{"duplicate_id":"other-id"}`, `"3"`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/people/"+tt.id+"/merge", bytes.NewBufferString(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestCreatePeople(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		created    int
+		failed     int
+		statuses   []models.BatchStatus
+	}{
+		{
+			name:       "all created",
+			body:       `{"items":[{"name":"John","surname":"Doe"},{"name":"Jane","surname":"Doe"}]}`,
+			statusCode: http.StatusCreated,
+			created:    2,
+			statuses:   []models.BatchStatus{models.BatchCreated, models.BatchCreated},
+		},
+		{
+			name:       "atomic batch with a failed item",
+			body:       `{"mode":"atomic","items":[{"name":"John","surname":"Doe"},{"name":"conflict","surname":"Doe"}]}`,
+			statusCode: http.StatusUnprocessableEntity,
+			failed:     1,
+			statuses:   []models.BatchStatus{models.BatchSkipped, models.BatchFailed},
+		},
+		{
+			name:       "partial batch with a failed item",
+			body:       `{"mode":"partial","items":[{"name":"John","surname":"Doe"},{"name":"conflict","surname":"Doe"}]}`,
+			statusCode: http.StatusMultiStatus,
+			created:    1,
+			failed:     1,
+			statuses:   []models.BatchStatus{models.BatchCreated, models.BatchFailed},
+		},
+		{"invalid json", `{invalid}`, http.StatusBadRequest, 0, 0, nil},
+		{"invalid mode", `{"mode":"some","items":[{"name":"John","surname":"Doe"}]}`, http.StatusBadRequest, 0, 0, nil},
+		{"no items", `{"items":[]}`, http.StatusBadRequest, 0, 0, nil},
+		{"service error", `{"items":[{"name":"error","surname":"Doe"}]}`, http.StatusInternalServerError, 0, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/people:batch", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statuses == nil {
+				return
+			}
+
+			var resp models.BatchResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			assert.Equal(t, tt.created, resp.Created)
+			assert.Equal(t, tt.failed, resp.Failed)
+			for i, status := range tt.statuses {
+				assert.Equal(t, i, resp.Items[i].Index)
+				assert.Equal(t, status, resp.Items[i].Status)
+				assert.Equal(t, status == models.BatchCreated, resp.Items[i].Person != nil)
+				assert.Equal(t, status == models.BatchFailed, resp.Items[i].Error != "")
+				if status == models.BatchFailed {
+					assert.Equal(t, models.CodePersonConflict, resp.Items[i].Code)
+				}
+			}
+		})
+	}
+}
+
+func TestCreatePeopleTooManyItems(t *testing.T) {
+	router, _ := setupTest()
+
+	items := make([]models.CreatePersonRequest, service.MaxBatchSize+1)
+	for i := range items {
+		items[i] = models.CreatePersonRequest{Name: "John", Surname: "Doe"}
+	}
+	body, _ := json.Marshal(models.CreatePeopleRequest{Items: items})
+	req, _ := http.NewRequest("POST", "/v1/people:batch", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestImportPeople(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		statusCode  int
+		want        models.ImportResult
+	}{
+		{
+			name:        "csv",
+			contentType: "text/csv",
+			body:        "name,surname\nJohn,Doe\n,Doe\nconflict,Doe\n",
+			statusCode:  http.StatusOK,
+			want: models.ImportResult{LastLine: 4, Created: 1, Rejected: 2, Rejects: []models.ImportReject{
+				{Line: 3, Error: "name is required", Record: ",Doe"},
+				{Line: 4, Error: "mock: conflict", Record: "conflict,Doe"},
+			}},
+		},
+		{
+			name:        "ndjson with mapping",
+			contentType: "application/x-ndjson",
+			query:       "?map=name=first,surname=last",
+			body:        `{"first":"John","last":"Doe"}` + "\n",
+			statusCode:  http.StatusOK,
+			want:        models.ImportResult{LastLine: 1, Created: 1},
+		},
+		{"unsupported content type", "application/json", "", `[]`, http.StatusUnsupportedMediaType, models.ImportResult{}},
+		{"invalid mapping", "text/csv", "?map=age=years", "name,surname\n", http.StatusBadRequest, models.ImportResult{}},
+		{"missing column", "text/csv", "", "name\nJohn\n", http.StatusBadRequest, models.ImportResult{}},
+		{"service error", "text/csv", "", "name,surname\nerror,Doe\n", http.StatusInternalServerError, models.ImportResult{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/v1/people:import"+tt.query, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			var got models.ImportResult
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExportPeople(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name           string
+		query          string
+		acceptEncoding string
+		statusCode     int
+		contentType    string
+		lines          int
+	}{
+		{"csv by default", "", "", http.StatusOK, "text/csv", 3},
+		{"ndjson", "?format=ndjson", "", http.StatusOK, "application/x-ndjson", 2},
+		{"gzip", "?format=ndjson", "br, gzip", http.StatusOK, "application/x-ndjson", 2},
+		{"gzip refused", "?format=csv", "gzip;q=0", http.StatusOK, "text/csv", 3},
+		{"invalid format", "?format=xml", "", http.StatusBadRequest, "application/problem+json", 1},
+		{"invalid match", "?match=exact", "", http.StatusBadRequest, "application/problem+json", 1},
+		{"service error", "?filter=error", "", http.StatusInternalServerError, "application/problem+json", 1},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req, _ := http.NewRequest("POST", "/people", bytes.NewBufferString(tt.body))
+			req, _ := http.NewRequest("GET", "/v1/people/export"+tt.query, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
 			rr := httptest.NewRecorder()
 
 			router.ServeHTTP(rr, req)
 			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+
+			body := io.Reader(rr.Body)
+			if rr.Header().Get("Content-Encoding") == "gzip" {
+				gz, err := gzip.NewReader(rr.Body)
+				assert.NoError(t, err)
+				body = gz
+			}
+			data, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.lines, bytes.Count(data, []byte("\n")))
 		})
 	}
 }
 
+func TestExportPeopleAbortsOnError(t *testing.T) {
+	router, _ := setupTest()
+
+	req, _ := http.NewRequest("GET", "/v1/people/export?format=ndjson&filter=broken", nil)
+	rr := httptest.NewRecorder()
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { router.ServeHTTP(rr, req) })
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
 func TestUpdatePerson(t *testing.T) {
 	router, _ := setupTest()
 
@@ -104,6 +566,9 @@ func TestUpdatePerson(t *testing.T) {
 		{"valid request", "valid-id", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusOK},
 		{"invalid id", " ", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusBadRequest},
 		{"service error", "error-id", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusInternalServerError},
+		{"not found", "notfound-id", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusNotFound},
+		{"malformed id", "invalid-id", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusBadRequest},
+		{"conflict", "conflict-id", `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`, http.StatusConflict},
 		{"invalid request with empty name", "1", `{"name":"","surname":"Doe"}`, http.StatusBadRequest},
 		{"invalid request with empty surname", "1", `{"name":"John","surname":""}`, http.StatusBadRequest},
 		{"invalid request with empty age", "1", `{"name":"John","surname":"Doe","age":0}`, http.StatusBadRequest},
@@ -115,12 +580,64 @@ func TestUpdatePerson(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			url := fmt.Sprintf("/people/%s", tt.id)
+			url := fmt.Sprintf("/v1/people/%s", tt.id)
 			req, _ := http.NewRequest("PUT", url, bytes.NewBufferString(tt.body))
+			req.Header.Set("If-Match", `"3"`)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestPatchPerson(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name        string
+		id          string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{"merge patch", "valid-id", "application/merge-patch+json", `{"patronymic":null}`, http.StatusOK},
+		{"json patch", "valid-id", "application/json-patch+json", `[{"op":"replace","path":"/age","value":31}]`, http.StatusOK},
+		{"content type with charset", "valid-id", "application/merge-patch+json; charset=utf-8", `{}`, http.StatusOK},
+		{"unsupported content type", "valid-id", "application/json", `{}`, http.StatusUnsupportedMediaType},
+		{"missing content type", "valid-id", "", `{}`, http.StatusUnsupportedMediaType},
+		{"invalid id", " ", "application/merge-patch+json", `{}`, http.StatusBadRequest},
+		{"invalid patch", "badpatch-id", "application/merge-patch+json", `{`, http.StatusBadRequest},
+		{"invalid result", "unprocessable-id", "application/merge-patch+json", `{"name":null}`, http.StatusUnprocessableEntity},
+		{"not found", "notfound-id", "application/merge-patch+json", `{}`, http.StatusNotFound},
+		{"service error", "error-id", "application/merge-patch+json", `{}`, http.StatusInternalServerError},
+		{"merged", "merged-id", "application/merge-patch+json", `{"age":31}`, http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := fmt.Sprintf("/v1/people/%s", tt.id)
+			req, _ := http.NewRequest("PATCH", url, bytes.NewBufferString(tt.body))
+			req.Header.Set("If-Match", `"3"`)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
 			rr := httptest.NewRecorder()
 
 			router.ServeHTTP(rr, req)
 			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusUnsupportedMediaType {
+				assert.Equal(t, "application/merge-patch+json, application/json-patch+json", rr.Header().Get("Accept-Patch"))
+			}
+			if tt.statusCode == http.StatusGone {
+				// Not a redirect: following it would apply the patch to a person the client never read
+				assert.Empty(t, rr.Header().Get("Location"))
+				assert.Equal(t, `</v1/people/survivor-id>; rel="alternate"`, rr.Header().Get("Link"))
+				var resp models.Problem
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, models.CodePersonMerged, resp.Code)
+				assert.Contains(t, resp.Detail, "survivor-id")
+			}
 		})
 	}
 }
@@ -136,11 +653,177 @@ func TestDeletePerson(t *testing.T) {
 		{"valid request", "valid-id", http.StatusOK},
 		{"empty id", " ", http.StatusBadRequest},
 		{"service error", "error-id", http.StatusInternalServerError},
+		{"not found", "notfound-id", http.StatusNotFound},
+		{"malformed id", "invalid-id", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := fmt.Sprintf("/v1/people/%s", tt.id)
+			req, _ := http.NewRequest("DELETE", url, nil)
+			req.Header.Set("If-Match", `"3"`)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	router, _ := setupTest()
+
+	const updateBody = `{"name":"John","surname":"Doe","age":30,"gender":"male","nationality":"US"}`
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		ifMatch     string
+		statusCode  int
+	}{
+		{"put with current etag", "PUT", "application/json", updateBody, `"3"`, http.StatusOK},
+		{"put with any etag", "PUT", "application/json", updateBody, `*`, http.StatusOK},
+		{"put without if-match", "PUT", "application/json", updateBody, "", http.StatusPreconditionRequired},
+		{"put with stale etag", "PUT", "application/json", updateBody, `"2"`, http.StatusPreconditionFailed},
+		{"put with weak etag", "PUT", "application/json", updateBody, `W/"3"`, http.StatusPreconditionFailed},
+		{"put with foreign etag", "PUT", "application/json", updateBody, `"abc"`, http.StatusPreconditionFailed},
+		{"put with etag list", "PUT", "application/json", updateBody, `"2", "3"`, http.StatusBadRequest},
+		{"patch without if-match", "PATCH", "application/merge-patch+json", `{}`, "", http.StatusPreconditionRequired},
+		{"patch with stale etag", "PATCH", "application/merge-patch+json", `{}`, `"2"`, http.StatusPreconditionFailed},
+		{"delete without if-match", "DELETE", "", "", "", http.StatusPreconditionRequired},
+		{"delete with stale etag", "DELETE", "", "", `"2"`, http.StatusPreconditionFailed},
+		{"delete with current etag", "DELETE", "", "", `"3"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/v1/people/valid-id", bytes.NewBufferString(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusOK && tt.method != "DELETE" {
+				assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestGetPersonByIDConditional(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		statusCode  int
+	}{
+		{"no if-none-match", "", http.StatusOK},
+		{"matching etag", `"3"`, http.StatusNotModified},
+		{"matching weak etag", `W/"3"`, http.StatusNotModified},
+		{"matching etag in list", `"1", "3"`, http.StatusNotModified},
+		{"any etag", `*`, http.StatusNotModified},
+		{"stale etag", `"2"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/v1/people/valid-id", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+			if tt.statusCode == http.StatusNotModified {
+				assert.Empty(t, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetDeletedPeople(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+	}{
+		{"valid request", "/v1/people/trash", http.StatusOK},
+		{"custom page, size, filter", "/v1/people/trash?page=2&size=20&filter=User", http.StatusOK},
+		{"invalid page", "/v1/people/trash?page=abc", http.StatusBadRequest},
+		{"service error", "/v1/people/trash?filter=error", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusOK {
+				var body []models.PersonResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				assert.Len(t, body, 1)
+				assert.NotNil(t, body[0].DeletedAt)
+			}
+		})
+	}
+}
+
+func TestRestorePerson(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		id         string
+		statusCode int
+	}{
+		{"valid request", "valid-id", http.StatusOK},
+		{"not found", "notfound-id", http.StatusNotFound},
+		{"malformed id", "invalid-id", http.StatusBadRequest},
+		{"service error", "error-id", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := fmt.Sprintf("/v1/people/%s/restore", tt.id)
+			req, _ := http.NewRequest("POST", url, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+		})
+	}
+}
+
+func TestPurgePerson(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		id         string
+		statusCode int
+	}{
+		{"valid request", "valid-id", http.StatusOK},
+		{"empty id", " ", http.StatusBadRequest},
+		{"not found", "notfound-id", http.StatusNotFound},
+		{"service error", "error-id", http.StatusInternalServerError},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			url := fmt.Sprintf("/people/%s", tt.id)
+			url := fmt.Sprintf("/v1/people/trash/%s", tt.id)
 			req, _ := http.NewRequest("DELETE", url, nil)
 			rr := httptest.NewRecorder()
 
@@ -154,6 +837,302 @@ func TestDeletePerson(t *testing.T) {
 func setupTest() (*mux.Router, *MockPersonService) {
 	service := &MockPersonService{}
 	handler := NewHandler(service)
-	router := NewRouter(handler)
+	router := NewRouter(handler, nil, nil)
 	return router, service
 }
+
+func TestGetPersonHistory(t *testing.T) {
+	router, _ := setupTest()
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+	}{
+		{"valid request", "/v1/people/valid-id/history", http.StatusOK},
+		{"custom page and size", "/v1/people/valid-id/history?page=2&size=5", http.StatusOK},
+		{"invalid page", "/v1/people/valid-id/history?page=abc", http.StatusBadRequest},
+		{"invalid size", "/v1/people/valid-id/history?size=0", http.StatusBadRequest},
+		{"listing parameters ignored", "/v1/people/valid-id/history?match=bogus&count=bogus", http.StatusOK},
+		{"not found", "/v1/people/notfound-id/history", http.StatusNotFound},
+		{"malformed id", "/v1/people/invalid-id/history", http.StatusBadRequest},
+		{"service error", "/v1/people/error-id/history", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.statusCode, rr.Code)
+			if tt.statusCode == http.StatusOK {
+				var changes []models.PersonChange
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &changes))
+				assert.Len(t, changes, 1)
+				assert.Equal(t, "Changed", changes[0].Diff["surname"].To)
+			}
+		})
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	var got audit.Meta
+	handler := RequestIDMiddleware(AuditMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = audit.FromContext(r.Context())
+	})))
+
+	req, _ := http.NewRequest("PUT", "/v1/people/1", nil)
+	req.Header.Set("X-Actor", "alice")
+	req.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, audit.Meta{Actor: "alice", RequestID: "req-1", Source: audit.SourceAPI}, got)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	assert.NoError(t, os.WriteFile(path, []byte("token-a alice\n"), 0o600))
+	tokens, err := audit.LoadTokens(path)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		statusCode    int
+		actor         string
+	}{
+		{"known token", "/v1/people/1", "Bearer token-a", http.StatusOK, "alice"},
+		{"missing token", "/v1/people/1", "", http.StatusUnauthorized, ""},
+		{"unknown token", "/v1/people/1", "Bearer token-b", http.StatusUnauthorized, ""},
+		{"other scheme", "/v1/people/1", "Basic token-a", http.StatusUnauthorized, ""},
+		{"swagger", "/v1/swagger/doc.json", "", http.StatusOK, "mallory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got audit.Meta
+			handler := AuditMiddleware(AuthMiddleware(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = audit.FromContext(r.Context())
+			})))
+
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set("X-Actor", "mallory")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.statusCode, rr.Code)
+			assert.Equal(t, tt.actor, got.Actor, "the actor of the token replaces X-Actor")
+			if tt.statusCode == http.StatusUnauthorized {
+				var resp models.Problem
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+				assert.Equal(t, models.CodeUnauthorized, resp.Code)
+				assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		generate bool
+	}{
+		{"kept", "req-1", false},
+		{"missing", "", true},
+		{"too long", strings.Repeat("a", 129), true},
+		{"not printable", "req 1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = logging.RequestID(r.Context())
+			}))
+
+			req, _ := http.NewRequest("GET", "/v1/people", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if tt.generate {
+				assert.Len(t, got, 32)
+			} else {
+				assert.Equal(t, tt.header, got)
+			}
+			assert.Equal(t, got, rr.Header().Get("X-Request-ID"))
+		})
+	}
+}
+
+func TestHTTPMetricsMiddleware(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry(), metrics.Options{})
+	assert.NoError(t, err)
+	router := NewRouter(NewHandler(&MockPersonService{}), nil, m)
+
+	for _, id := range []string{"1", "notfound-id", "notfound-id"} {
+		req, _ := http.NewRequest("GET", "/v1/people/"+id, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.HTTPRequestsTotal.WithLabelValues("GET", "/v1/people/{id}", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.HTTPRequestsTotal.WithLabelValues("GET", "/v1/people/{id}", "404")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.HTTPRequestDuration), "one series per method and path")
+}
+
+func TestRouterTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+	router := NewRouter(NewHandler(&MockPersonService{}), nil, nil)
+
+	req, _ := http.NewRequest("GET", "/v1/people/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "/v1/people/{id}", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+}
+
+// memoryIdempotencyStore keeps idempotency records in memory. With hold set,
+// completed requests stay in flight.
+type memoryIdempotencyStore struct {
+	records map[string]models.IdempotencyRecord
+	hold    bool
+}
+
+func (m *memoryIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string) (models.IdempotencyRecord, bool, error) {
+	if rec, ok := m.records[key]; ok {
+		return rec, false, nil
+	}
+	m.records[key] = models.IdempotencyRecord{Key: key, Fingerprint: fingerprint}
+	return models.IdempotencyRecord{}, true, nil
+}
+
+func (m *memoryIdempotencyStore) Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error {
+	if m.hold {
+		return nil
+	}
+	rec := m.records[key]
+	rec.StatusCode, rec.Header, rec.Body = status, header, body
+	m.records[key] = rec
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	delete(m.records, key)
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	const john = `{"name":"John","surname":"Doe"}`
+	type request struct {
+		key        string
+		body       string
+		statusCode int
+		replayed   bool
+	}
+	tests := []struct {
+		name     string
+		hold     bool
+		requests []request
+	}{
+		{"retry replayed", false, []request{
+			{"k1", john, http.StatusCreated, false},
+			{"k1", john, http.StatusCreated, true},
+		}},
+		{"key reused with another body", false, []request{
+			{"k1", john, http.StatusCreated, false},
+			{"k1", `{"name":"Jane","surname":"Doe"}`, http.StatusUnprocessableEntity, false},
+		}},
+		{"without key", false, []request{
+			{"", john, http.StatusCreated, false},
+			{"", john, http.StatusCreated, false},
+		}},
+		{"client error replayed", false, []request{
+			{"k1", `{"name":"conflict","surname":"Doe"}`, http.StatusConflict, false},
+			{"k1", `{"name":"conflict","surname":"Doe"}`, http.StatusConflict, true},
+		}},
+		{"server error not stored", false, []request{
+			{"k1", `{"name":"error","surname":"Doe"}`, http.StatusInternalServerError, false},
+			{"k1", `{"name":"error","surname":"Doe"}`, http.StatusInternalServerError, false},
+		}},
+		{"request in flight", true, []request{
+			{"k1", john, http.StatusCreated, false},
+			{"k1", john, http.StatusConflict, false},
+		}},
+		{"key too long", false, []request{
+			{string(bytes.Repeat([]byte("k"), 256)), john, http.StatusBadRequest, false},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryIdempotencyStore{records: map[string]models.IdempotencyRecord{}, hold: tt.hold}
+			router := NewRouter(NewHandler(&MockPersonService{}), store, nil)
+
+			var first []byte
+			var firstType string
+			for i, r := range tt.requests {
+				req, _ := http.NewRequest("POST", "/v1/people", bytes.NewBufferString(r.body))
+				if r.key != "" {
+					req.Header.Set("Idempotency-Key", r.key)
+				}
+				requestID := fmt.Sprintf("request-%d", i)
+				req.Header.Set("X-Request-ID", requestID)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, r.statusCode, rr.Code, "request %d", i)
+				assert.Equal(t, r.replayed, rr.Header().Get("Idempotent-Replayed") == "true", "request %d", i)
+				assert.Equal(t, requestID, rr.Header().Get("X-Request-ID"), "request %d", i)
+				if i == 0 {
+					first = rr.Body.Bytes()
+					firstType = rr.Header().Get("Content-Type")
+				} else if r.replayed {
+					assert.Equal(t, first, rr.Body.Bytes())
+					assert.Equal(t, firstType, rr.Header().Get("Content-Type"))
+				}
+			}
+		})
+	}
+}
+
+func TestSwaggerDoc(t *testing.T) {
+	router, _ := setupTest()
+
+	req, _ := http.NewRequest("GET", "/v1/swagger/doc.json", nil)
+	// http-swagger reads the path from RequestURI, which only the server sets
+	req.RequestURI = req.URL.Path
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.1", doc.OpenAPI)
+	assert.Contains(t, doc.Components.Schemas, "models.Problem")
+}
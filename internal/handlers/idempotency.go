@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+)
+
+// maxIdempotencyKeyLength limits the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// perRequestHeaders are response headers that describe the request rather than its
+// outcome; they are neither stored nor replayed, a replay gets its own.
+var perRequestHeaders = []string{"X-Request-ID", "Date"}
+
+// IdempotencyStore keeps the requests made with an Idempotency-Key and their
+// responses, see repository.GormIdempotencyRepository.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key, fingerprint string) (models.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyMiddleware makes POST requests with an Idempotency-Key header safe to retry.
+// The first request with a key runs and its response is stored; a retry with the same
+// key and request gets the stored response again, with the Idempotent-Replayed header and
+// its own X-Request-ID.
+// The same key with a different request is answered with 422, and a retry while the
+// first request is still running with 409 and Retry-After. Responses with a 5xx status
+// are not stored, so that a retry runs again.
+// Requests without the header are passed through.
+func IdempotencyMiddleware(store IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				respondError(w, r, http.StatusBadRequest, models.CodeInvalidIdempotencyKey, "Idempotency-Key is too long")
+				return
+			}
+
+			// the body is part of the fingerprint, read it once and hand a copy to next
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					respondError(w, r, http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, "request body is too large")
+					return
+				}
+				respondError(w, r, http.StatusBadRequest, models.CodeInvalidRequest, "could not read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := requestFingerprint(r, body)
+
+			rec, reserved, err := store.Reserve(r.Context(), key, fingerprint)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "handlers.IdempotencyMiddleware: could not reserve key", "error", err)
+				respondError(w, r, http.StatusInternalServerError, models.CodeInternal, "could not check Idempotency-Key")
+				return
+			}
+			if !reserved {
+				replayIdempotent(w, r, rec, fingerprint)
+				return
+			}
+
+			// the outcome is stored even if the client has gone away
+			ctx := context.WithoutCancel(r.Context())
+			rw := &recordingWriter{ResponseWriter: w}
+			defer func() {
+				if p := recover(); p != nil {
+					if err := store.Release(ctx, key); err != nil {
+						slog.ErrorContext(ctx, "handlers.IdempotencyMiddleware: could not release key", "error", err)
+					}
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				err = store.Release(ctx, key)
+			} else {
+				err = store.Complete(ctx, key, status, rw.header, rw.body.Bytes())
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "handlers.IdempotencyMiddleware: could not store outcome", "error", err)
+			}
+		})
+	}
+}
+
+// requestFingerprint identifies a request by its method, URL, actor, content type and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	for _, part := range []string{r.Method, r.URL.RequestURI(), audit.FromContext(r.Context()).Actor, r.Header.Get("Content-Type")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayIdempotent answers a request whose Idempotency-Key is held by rec.
+func replayIdempotent(w http.ResponseWriter, r *http.Request, rec models.IdempotencyRecord, fingerprint string) {
+	switch {
+	case rec.Fingerprint != fingerprint:
+		slog.InfoContext(r.Context(), "handlers.IdempotencyMiddleware: key reused with another request")
+		respondError(w, r, http.StatusUnprocessableEntity, models.CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request")
+	case rec.StatusCode == 0:
+		slog.InfoContext(r.Context(), "handlers.IdempotencyMiddleware: request with the key in flight")
+		w.Header().Set("Retry-After", "1")
+		respondError(w, r, http.StatusConflict, models.CodeIdempotencyKeyInProgress, "a request with this Idempotency-Key is in progress, retry later")
+	default:
+		slog.InfoContext(r.Context(), "handlers.IdempotencyMiddleware: replaying stored response")
+		for name, values := range rec.Header {
+			if !isPerRequestHeader(name) {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(rec.StatusCode)
+		w.Write(rec.Body)
+	}
+}
+
+func isPerRequestHeader(name string) bool {
+	for _, h := range perRequestHeaders {
+		if http.CanonicalHeaderKey(name) == h {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingWriter keeps a copy of the response it writes.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+		rw.header = rw.ResponseWriter.Header().Clone()
+		for _, h := range perRequestHeaders {
+			rw.header.Del(h)
+		}
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
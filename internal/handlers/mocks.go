@@ -3,7 +3,12 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"person-enricher/internal/models"
+	"person-enricher/internal/validation"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type MockPersonService struct{}
@@ -15,30 +20,127 @@ func (m *MockPersonService) GetPeople(ctx context.Context, filter models.PeopleF
 	return []models.Person{{ID: "1", Name: "Test", Surname: "User"}}, nil
 }
 
-func (m *MockPersonService) GetPersonByID(ctx context.Context, id string) (models.Person, error) {
+func (m *MockPersonService) GetPeoplePage(ctx context.Context, filter models.PeopleFilter) (models.PeoplePage, error) {
+	if filter.Filter == "error" {
+		return models.PeoplePage{}, errors.New("service error")
+	}
+	return models.PeoplePage{
+		People:  []models.Person{{ID: "1", Name: "Test", Surname: "User"}},
+		Page:    filter.Page,
+		Size:    filter.Size,
+		Total:   int64(filter.Page*filter.Size + 1),
+		HasNext: true,
+	}, nil
+}
+
+// ExportPeople exports two people, and fails after the first one if the filter is "broken".
+func (m *MockPersonService) ExportPeople(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error {
+	if filter.Filter == "error" {
+		return errors.New("service error")
+	}
+	people := []models.Person{
+		{ID: "1", Name: "Test", Surname: "User", Age: 30, Version: 1},
+		{ID: "2", Name: "Other", Surname: "User", Patronymic: "Middle", Version: 2},
+	}
+	for i, p := range people {
+		if i == 1 && filter.Filter == "broken" {
+			return errors.New("service error")
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mockVersion is the version of every person the mock service returns.
+const mockVersion = 3
+
+// mockVersionError returns models.ErrVersionMismatch unless version matches mockVersion or is 0.
+func mockVersionError(version int64) error {
+	if version != 0 && version != mockVersion {
+		return fmt.Errorf("mock: %w", models.ErrVersionMismatch)
+	}
+	return nil
+}
+
+// mockIDError returns the error the mock service answers for the special test ids.
+func mockIDError(id string) error {
 	switch id {
 	case "error-id":
-		return models.Person{}, errors.New("service error")
+		return errors.New("service error")
 	case "notfound-id":
-		return models.Person{}, nil
-	default:
-		return models.Person{ID: id, Name: "Test", Surname: "User"}, nil
+		return fmt.Errorf("mock: %w", models.ErrNotFound)
+	case "invalid-id":
+		return fmt.Errorf("mock: %w", models.ErrInvalidID)
+	case "conflict-id":
+		return fmt.Errorf("mock: %w", models.ErrConflict)
+	case "badpatch-id":
+		return fmt.Errorf("mock: %w", models.ErrInvalidPatch)
+	case "merged-id":
+		return fmt.Errorf("mock: %w", &models.MergedError{Into: "survivor-id"})
+	case "unprocessable-id":
+		return fmt.Errorf("mock: %w", &models.ValidationError{Fields: []validation.FieldError{
+			{Field: "age", Code: validation.CodeRequired, Message: "age is required"},
+		}})
+	}
+	return nil
+}
+
+func (m *MockPersonService) GetPersonByID(ctx context.Context, id string) (models.Person, error) {
+	if err := mockIDError(id); err != nil {
+		return models.Person{}, err
 	}
+	return models.Person{ID: id, Name: "Test", Surname: "User", Version: mockVersion}, nil
 }
 
 func (m *MockPersonService) CreatePerson(ctx context.Context, req models.CreatePersonRequest) (models.Person, error) {
-	if req.Name == "error" {
+	switch req.Name {
+	case "error":
 		return models.Person{}, errors.New("service error")
+	case "conflict":
+		return models.Person{}, fmt.Errorf("mock: %w", models.ErrConflict)
 	}
 	return models.Person{ID: "new-id", Name: req.Name, Surname: req.Surname}, nil
 }
 
-func (m *MockPersonService) UpdatePerson(ctx context.Context, id string, req models.UpdatePersonRequest) (models.Person, error) {
-	if id == "error-id" {
-		return models.Person{}, errors.New("service error")
+// CreatePeople fails the whole batch if its first item is named "error", and the
+// items named "conflict" with models.ErrConflict.
+func (m *MockPersonService) CreatePeople(ctx context.Context, reqs []models.CreatePersonRequest, mode models.BatchMode) ([]models.BatchItem, error) {
+	if reqs[0].Name == "error" {
+		return nil, errors.New("service error")
+	}
+	items := make([]models.BatchItem, len(reqs))
+	failed := false
+	for i, req := range reqs {
+		person, err := m.CreatePerson(ctx, req)
+		if err != nil {
+			items[i] = models.BatchItem{Status: models.BatchFailed, Err: err}
+			failed = true
+			continue
+		}
+		items[i] = models.BatchItem{Status: models.BatchCreated, Person: person}
+	}
+	if failed && mode == models.BatchAtomic {
+		for i := range items {
+			if items[i].Status == models.BatchCreated {
+				items[i] = models.BatchItem{Status: models.BatchSkipped}
+			}
+		}
+	}
+	return items, nil
+}
+
+func (m *MockPersonService) UpdatePerson(ctx context.Context, id string, version int64, req models.UpdatePersonRequest) (models.Person, error) {
+	if err := mockIDError(id); err != nil {
+		return models.Person{}, err
+	}
+	if err := mockVersionError(version); err != nil {
+		return models.Person{}, err
 	}
 	return models.Person{
 		ID:          id,
+		Version:     mockVersion + 1,
 		Name:        req.Name,
 		Surname:     req.Surname,
 		Age:         req.Age,
@@ -47,9 +149,106 @@ func (m *MockPersonService) UpdatePerson(ctx context.Context, id string, req mod
 	}, nil
 }
 
-func (m *MockPersonService) DeletePerson(ctx context.Context, id string) error {
-	if id == "error-id" {
+func (m *MockPersonService) PatchPerson(ctx context.Context, id string, version int64, patchType models.PatchType, patch []byte) (models.Person, error) {
+	if err := mockIDError(id); err != nil {
+		return models.Person{}, err
+	}
+	if err := mockVersionError(version); err != nil {
+		return models.Person{}, err
+	}
+	return models.Person{ID: id, Name: "Patched", Surname: string(patchType), Version: mockVersion + 1}, nil
+}
+
+func (m *MockPersonService) DeletePerson(ctx context.Context, id string, version int64) error {
+	if err := mockIDError(id); err != nil {
+		return err
+	}
+	return mockVersionError(version)
+}
+
+func (m *MockPersonService) GetDeletedPeople(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+	if filter.Filter == "error" {
+		return nil, errors.New("service error")
+	}
+	return []models.Person{{
+		ID: "1", Name: "Test", Surname: "User",
+		DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true},
+	}}, nil
+}
+
+func (m *MockPersonService) RestorePerson(ctx context.Context, id string) (models.Person, error) {
+	if err := mockIDError(id); err != nil {
+		return models.Person{}, err
+	}
+	return models.Person{ID: id, Name: "Test", Surname: "User"}, nil
+}
+
+func (m *MockPersonService) PurgePerson(ctx context.Context, id string) error {
+	return mockIDError(id)
+}
+
+func (m *MockPersonService) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockPersonService) GetPersonHistory(ctx context.Context, id string, page, size int) ([]models.PersonChange, error) {
+	if err := mockIDError(id); err != nil {
+		return nil, err
+	}
+	before := &models.Person{ID: id, Name: "Test", Surname: "User", Version: 1}
+	after := &models.Person{ID: id, Name: "Test", Surname: "Changed", Version: 2}
+	return []models.PersonChange{{
+		ID:        1,
+		PersonID:  id,
+		Version:   2,
+		Operation: models.OperationUpdate,
+		Before:    before,
+		After:     after,
+		Diff:      map[string]models.FieldChange{"surname": {From: "User", To: "Changed"}},
+		Actor:     "tester",
+		Source:    "api",
+	}}, nil
+}
+
+func (m *MockPersonService) GetPersonAsOf(ctx context.Context, id string, at time.Time) (models.Person, error) {
+	if err := mockIDError(id); err != nil {
+		return models.Person{}, err
+	}
+	return models.Person{ID: id, Name: "Test", Surname: "User", Version: 1}, nil
+}
+
+// GetDuplicates returns one pair with the given threshold as score.
+func (m *MockPersonService) GetDuplicates(ctx context.Context, threshold float64, page, size int) ([]models.DuplicatePair, error) {
+	if page > 1 {
+		return nil, errors.New("service error")
+	}
+	return []models.DuplicatePair{{
+		First:  models.Person{ID: "1", Name: "Ivan", Surname: "Ivanov"},
+		Second: models.Person{ID: "2", Name: "Ivan", Surname: "Ivanoff"},
+		Score:  threshold,
+	}}, nil
+}
+
+// CheckDuplicates finds a duplicate of the people named "duplicate".
+func (m *MockPersonService) CheckDuplicates(ctx context.Context, req models.CreatePersonRequest) error {
+	switch req.Name {
+	case "duplicate":
+		return &models.DuplicateError{People: []models.Person{{ID: "dup-id", Name: req.Name, Surname: req.Surname, Score: 0.9}}}
+	case "error":
 		return errors.New("service error")
 	}
 	return nil
 }
+
+func (m *MockPersonService) MergePeople(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (models.Person, error) {
+	if err := mockIDError(survivorID); err != nil {
+		return models.Person{}, err
+	}
+	if err := mockIDError(duplicateID); err != nil {
+		return models.Person{}, err
+	}
+	if err := mockVersionError(version); err != nil {
+		return models.Person{}, err
+	}
+	return models.Person{ID: survivorID, Name: "Test", Surname: "User", Version: mockVersion + 1}, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"person-enricher/internal/models"
+	"strconv"
+	"strings"
+)
+
+// mediaTypePeopleV2 is the media type clients send in Accept to get the paginated
+// envelope from GET /people instead of the bare JSON array.
+const mediaTypePeopleV2 = "application/vnd.person-enricher.v2+json"
+
+// acceptsPeopleV2 reports whether the Accept header asks for version 2 of the people
+// list, either by the vendor media type or by a version=2 parameter on application/json.
+func acceptsPeopleV2(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == mediaTypePeopleV2 {
+			return true
+		}
+		if mediaType == "application/json" && params["version"] == "2" {
+			return true
+		}
+	}
+	return false
+}
+
+// toPeoplePageResponse converts a service page into the JSON envelope.
+func toPeoplePageResponse(p models.PeoplePage) models.PeoplePageResponse {
+	items := make([]models.PersonResponse, 0, len(p.People))
+	for _, person := range p.People {
+		items = append(items, toPersonResponse(person))
+	}
+	return models.PeoplePageResponse{
+		Items:          items,
+		Page:           p.Page,
+		Size:           p.Size,
+		Total:          p.Total,
+		TotalEstimated: p.TotalEstimated,
+		HasNext:        p.HasNext,
+	}
+}
+
+// paginationLinks builds an RFC 8288 Link header value with first, prev, next and last
+// relations for the page. All other query parameters of the request are preserved.
+// The last relation is omitted when the total is only an estimate.
+func paginationLinks(u *url.URL, p models.PeoplePage) string {
+	link := func(page int, rel string) string {
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		q.Set("size", strconv.Itoa(p.Size))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, q.Encode(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if p.Page > 1 {
+		links = append(links, link(p.Page-1, "prev"))
+	}
+	if p.HasNext {
+		links = append(links, link(p.Page+1, "next"))
+	}
+	if !p.TotalEstimated {
+		last := int((p.Total + int64(p.Size) - 1) / int64(p.Size))
+		if last < 1 {
+			last = 1
+		}
+		links = append(links, link(last, "last"))
+	}
+	return strings.Join(links, ", ")
+}
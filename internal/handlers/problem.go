@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+)
+
+// problemContentType is the media type of the error responses, see RFC 7807.
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix is prepended to the code of a problem to form its type URI.
+const problemTypePrefix = "urn:person-enricher:problem:"
+
+// problemTitles holds the title of every problem type.
+var problemTitles = map[models.ErrorCode]string{
+	models.CodeInvalidParameter:         "Invalid query parameter",
+	models.CodeInvalidRequest:           "Invalid request",
+	models.CodeInvalidJSON:              "Invalid JSON body",
+	models.CodeValidationFailed:         "Validation failed",
+	models.CodeInvalidID:                "Invalid person id",
+	models.CodeInvalidPatch:             "Invalid patch",
+	models.CodeInvalidFile:              "Invalid import file",
+	models.CodePersonNotFound:           "Person not found",
+	models.CodePersonMerged:             "Person was merged",
+	models.CodePersonConflict:           "Person conflicts with an existing record",
+	models.CodeDuplicatePerson:          "Person looks like existing people",
+	models.CodePreconditionRequired:     "If-Match header required",
+	models.CodeInvalidPrecondition:      "Invalid If-Match header",
+	models.CodeVersionMismatch:          "Person was modified",
+	models.CodeUnsupportedMediaType:     "Unsupported content type",
+	models.CodePayloadTooLarge:          "Request body too large",
+	models.CodeInvalidIdempotencyKey:    "Invalid Idempotency-Key",
+	models.CodeIdempotencyKeyReused:     "Idempotency-Key reused",
+	models.CodeIdempotencyKeyInProgress: "Request with the Idempotency-Key in progress",
+	models.CodeUnauthorized:             "Unauthorized",
+	models.CodeRouteNotFound:            "Route not found",
+	models.CodeMethodNotAllowed:         "Method not allowed",
+	models.CodeImportInterrupted:        "Import interrupted",
+	models.CodeInternal:                 "Internal error",
+}
+
+// newProblem returns the problem answered to r with the given status, code and detail.
+// Its instance is the path of r, and its request id the one stored by AuditMiddleware.
+func newProblem(r *http.Request, status int, code models.ErrorCode, detail string) models.Problem {
+	return models.Problem{
+		Type:      problemTypePrefix + string(code),
+		Title:     problemTitles[code],
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: audit.FromContext(r.Context()).RequestID,
+	}
+}
+
+// respondError writes an error response in the application/problem+json format
+// with the given status, code and detail.
+func respondError(w http.ResponseWriter, r *http.Request, status int, code models.ErrorCode, detail string) {
+	respondProblem(w, r, newProblem(r, status, code, detail))
+}
+
+// respondProblem writes p with its status.
+func respondProblem(w http.ResponseWriter, r *http.Request, p models.Problem) {
+	level := slog.LevelInfo
+	if p.Status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Log(r.Context(), level, "handlers.respondError: error response", "status", p.Status, "code", p.Code, "detail", p.Detail)
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// respondValidationError writes a validation error with the given status, together
+// with the invalid fields of a *models.ValidationError.
+func respondValidationError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	p := newProblem(r, status, models.CodeValidationFailed, validationMessage(err))
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		p.Errors = verr.Fields
+	}
+	respondProblem(w, r, p)
+}
+
+// respondDecodeError writes the 400 answered for an error returned by decodeJSON.
+func respondDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrValidation) {
+		respondValidationError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	respondError(w, r, http.StatusBadRequest, models.CodeInvalidJSON, "invalid JSON")
+}
+
+// respondServiceError writes the error response for an error returned by the service,
+// as mapped by serviceProblem, and a validation error with the invalid fields.
+// A GET or HEAD of a person merged into another is redirected to the Location of the
+// survivor. Any other method is answered 410 with a Link to the survivor instead: a 308
+// would have the client repeat the request, If-Match included, on a person it never read.
+func respondServiceError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	status, code, detail := serviceProblem(err, msg)
+	var merr *models.MergedError
+	if errors.As(err, &merr) {
+		survivor := "/v1/people/" + merr.Into
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			w.Header().Set("Location", survivor)
+		} else {
+			status = http.StatusGone
+			w.Header().Set("Link", "<"+survivor+`>; rel="alternate"`)
+		}
+	}
+	if code == models.CodeValidationFailed {
+		respondValidationError(w, r, status, err)
+		return
+	}
+	respondError(w, r, status, code, detail)
+}
+
+// serviceProblem returns the HTTP status, code and client-facing detail for an error
+// returned by the service, msg being the detail of errors that are not mapped.
+// Sentinel errors are mapped to their HTTP status: models.ErrNotFound to 404,
+// models.ErrInvalidID and models.ErrInvalidPatch to 400, models.ErrConflict to 409,
+// models.ErrVersionMismatch to 412, models.ErrValidation to 422 and models.ErrMerged to 308.
+// Any other error is mapped to 500.
+func serviceProblem(err error, msg string) (int, models.ErrorCode, string) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound, models.CodePersonNotFound, "person not found"
+	case errors.Is(err, models.ErrInvalidID):
+		return http.StatusBadRequest, models.CodeInvalidID, "invalid id"
+	case errors.Is(err, models.ErrConflict):
+		return http.StatusConflict, models.CodePersonConflict, "person conflicts with an existing record"
+	case errors.Is(err, models.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, models.CodeVersionMismatch, "person was modified, get it again for the current ETag"
+	case errors.Is(err, models.ErrInvalidPatch):
+		return http.StatusBadRequest, models.CodeInvalidPatch, "invalid patch"
+	case errors.Is(err, models.ErrValidation):
+		return http.StatusUnprocessableEntity, models.CodeValidationFailed, validationMessage(err)
+	case errors.Is(err, models.ErrMerged):
+		return http.StatusPermanentRedirect, models.CodePersonMerged, "person was merged, " + err.Error()
+	default:
+		return http.StatusInternalServerError, models.CodeInternal, msg
+	}
+}
+
+// validationMessage returns the client-facing message of a validation error.
+func validationMessage(err error) string {
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		return verr.Error()
+	}
+	return "validation failed"
+}
+
+// routeNotFound answers the requests no route matches.
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusNotFound, models.CodeRouteNotFound, "no endpoint at "+r.URL.Path)
+}
+
+// methodNotAllowed answers the requests whose path matches a route, but not their method.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusMethodNotAllowed, models.CodeMethodNotAllowed, r.Method+" is not supported at "+r.URL.Path)
+}
@@ -2,13 +2,20 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "person-enricher/docs"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/logging"
 	"person-enricher/internal/metrics"
+	"person-enricher/internal/models"
+	"person-enricher/internal/tracing"
 
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 // NewRouter returns a new Gorilla Mux router with endpoints:
@@ -16,40 +23,190 @@ import (
 // * GET /people: GetPeople
 // * GET /people/{id}: GetPersonByID
 // * POST /people: CreatePerson
+// * POST /people:batch: CreatePeople
+// * POST /people:import: ImportPeople
+// * GET /people/export: ExportPeople
 // * PUT /people/{id}: UpdatePerson
+// * PATCH /people/{id}: PatchPerson
 // * DELETE /people/{id}: DeletePerson
-func NewRouter(h *Handler) *mux.Router {
+// * GET /people/trash: GetDeletedPeople
+// * POST /people/{id}/restore: RestorePerson
+// * DELETE /people/trash/{id}: PurgePerson
+// * GET /people/{id}/history: GetPersonHistory
+// * GET /people/duplicates: GetDuplicates
+// * POST /people/{id}/merge: MergePerson
+//
+// Every request gets a request id, see RequestIDMiddleware, and a span named after its
+// route, continuing the trace of the W3C traceparent header if the request has one.
+// The POST endpoints support the Idempotency-Key header with the given store,
+// see IdempotencyMiddleware. A nil store disables it.
+// Requests are measured into m, see HTTPMetricsMiddleware. A nil m disables it.
+// Unknown paths and unsupported methods are answered with a problem like the endpoints' errors.
+func NewRouter(h *Handler, idempotency IdempotencyStore, m *metrics.Metrics) *mux.Router {
 	r := mux.NewRouter()
+	post := func(f http.HandlerFunc) http.Handler {
+		if idempotency == nil {
+			return f
+		}
+		return IdempotencyMiddleware(idempotency)(f)
+	}
 
-	r.Use(HttpMetricsMiddleware)
+	r.Use(RequestIDMiddleware)
+	r.Use(otelmux.Middleware(tracing.ServiceName))
+	if m != nil {
+		r.Use(HTTPMetricsMiddleware(m))
+	}
+	r.Use(AuditMiddleware)
+	// mux runs the middleware of r only for matched routes
+	r.NotFoundHandler = RequestIDMiddleware(AuditMiddleware(http.HandlerFunc(routeNotFound)))
+	r.MethodNotAllowedHandler = RequestIDMiddleware(AuditMiddleware(http.HandlerFunc(methodNotAllowed)))
 
 	// Swagger
 	r.PathPrefix("/v1/swagger/").Handler(httpSwagger.WrapHandler)
 
 	r.HandleFunc("/v1/people", h.GetPeople).Methods(http.MethodGet)
+	// registered before /v1/people/{id}, which would match "trash" and "export" as ids
+	r.HandleFunc("/v1/people/trash", h.GetDeletedPeople).Methods(http.MethodGet)
+	r.HandleFunc("/v1/people/trash/{id}", h.PurgePerson).Methods(http.MethodDelete)
+	r.HandleFunc("/v1/people/export", h.ExportPeople).Methods(http.MethodGet)
+	r.HandleFunc("/v1/people/duplicates", h.GetDuplicates).Methods(http.MethodGet)
 	r.HandleFunc("/v1/people/{id}", h.GetPersonByID).Methods(http.MethodGet)
-	r.HandleFunc("/v1/people", h.CreatePerson).Methods(http.MethodPost)
+	r.Handle("/v1/people", post(h.CreatePerson)).Methods(http.MethodPost)
+	r.Handle("/v1/people:batch", post(h.CreatePeople)).Methods(http.MethodPost)
+	r.Handle("/v1/people:import", post(h.ImportPeople)).Methods(http.MethodPost)
 	r.HandleFunc("/v1/people/{id}", h.UpdatePerson).Methods(http.MethodPut)
+	r.HandleFunc("/v1/people/{id}", h.PatchPerson).Methods(http.MethodPatch)
 	r.HandleFunc("/v1/people/{id}", h.DeletePerson).Methods(http.MethodDelete)
+	r.Handle("/v1/people/{id}/restore", post(h.RestorePerson)).Methods(http.MethodPost)
+	r.HandleFunc("/v1/people/{id}/history", h.GetPersonHistory).Methods(http.MethodGet)
+	r.Handle("/v1/people/{id}/merge", post(h.MergePerson)).Methods(http.MethodPost)
 
 	return r
 }
 
-// httpMetricsMiddleware измеряет длительность HTTP запросов.
-func HttpMetricsMiddleware(next http.Handler) http.Handler {
+// HTTPMetricsMiddleware measures the duration of the HTTP requests and counts them by status code into m.
+// The trace id of the request is attached to the observation as an exemplar.
+func HTTPMetricsMiddleware(m *metrics.Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			duration := time.Since(start).Seconds()
+
+			route := mux.CurrentRoute(r)
+			var pathTemplate string
+			if route != nil {
+				pathTemplate, _ = route.GetPathTemplate()
+			} else {
+				pathTemplate = "not_found"
+			}
+
+			metrics.Observe(r.Context(), m.HTTPRequestDuration.WithLabelValues(r.Method, pathTemplate), duration)
+			m.HTTPRequestsTotal.WithLabelValues(r.Method, pathTemplate, strconv.Itoa(sw.Status())).Inc()
+		})
+	}
+}
+
+// statusWriter remembers the status code of the response it writes.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer, e.g. to flush it.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Status returns the status code written, 200 OK if the handler wrote nothing.
+func (sw *statusWriter) Status() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
+
+// maxRequestIDLength is the length from which an X-Request-ID sent by the client is replaced.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware stores the request id in the request context, so that every log line
+// written for the request carries it, and echoes it in the X-Request-ID response header.
+// The id is the X-Request-ID header of the request; a missing, too long or non-printable
+// one is replaced with a generated id.
+func RequestIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		duration := time.Since(start).Seconds()
-
-		route := mux.CurrentRoute(r)
-		var pathTemplate string
-		if route != nil {
-			pathTemplate, _ = route.GetPathTemplate()
-		} else {
-			pathTemplate = "not_found"
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id can be used as a request id: printable ASCII
+// of at most maxRequestIDLength characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
 		}
+	}
+	return true
+}
 
-		metrics.HTTPRequestDuration.WithLabelValues(r.Method, pathTemplate).Observe(duration)
+// AuthMiddleware requires an "Authorization: Bearer <token>" header with one of tokens,
+// and replaces the actor stored by AuditMiddleware, which it must run after, with the
+// actor of the token: the X-Actor header is not trusted then. Other requests are answered
+// with 401. The Swagger documentation is served without a token.
+func AuthMiddleware(tokens audit.Tokens) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/v1/swagger/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			actor, known := tokens.Actor(strings.TrimSpace(token))
+			if !ok || !known {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="person-enricher"`)
+				respondError(w, r, http.StatusUnauthorized, models.CodeUnauthorized, "a valid bearer token is required")
+				return
+			}
+			meta := audit.FromContext(r.Context())
+			meta.Actor = actor
+			next.ServeHTTP(w, r.WithContext(audit.WithMeta(r.Context(), meta)))
+		})
+	}
+}
+
+// AuditMiddleware stores the actor (X-Actor header) and the request id (see RequestIDMiddleware)
+// in the request context, so that the person history records who changed what.
+func AuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithMeta(r.Context(), audit.Meta{
+			Actor:     r.Header.Get("X-Actor"),
+			RequestID: logging.RequestID(r.Context()),
+			Source:    audit.SourceAPI,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,153 @@
+// Package health serves the liveness and readiness probes: /healthz tells the process
+// is alive, /readyz runs the dependency checks and fails while the server shuts down.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds a check without a timeout of its own.
+const DefaultTimeout = 2 * time.Second
+
+// Status of a check or of the whole probe.
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusDegraded is the status of a failed check that is not critical, and of a probe
+	// whose critical checks pass but some other check failed. The probe still passes.
+	StatusDegraded     Status = "degraded"
+	StatusFail         Status = "fail"
+	StatusShuttingDown Status = "shutting_down"
+)
+
+// Check is a dependency check of the readiness probe.
+type Check struct {
+	// Name identifies the check in the report, e.g. "database".
+	Name string
+	// Timeout bounds Run; 0 means DefaultTimeout.
+	Timeout time.Duration
+	// Critical checks fail the probe; the others only degrade it.
+	Critical bool
+	// Run returns an error if the dependency is not usable.
+	Run func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a check in a Report.
+type CheckResult struct {
+	Status     Status  `json:"status"`
+	Critical   bool    `json:"critical"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report is the body of the probes.
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health runs the checks of the readiness probe.
+type Health struct {
+	checks   []Check
+	draining atomic.Bool
+}
+
+// New returns a Health running the given checks.
+func New(checks ...Check) *Health {
+	return &Health{checks: checks}
+}
+
+// Drain makes the readiness probe fail from now on, so that the load balancer stops
+// sending requests before the server stops accepting them.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Check runs all the checks concurrently, each within its timeout, and reports them.
+// The status is fail if a critical check failed, degraded if another one did, ok otherwise.
+func (h *Health) Check(ctx context.Context) Report {
+	results := make([]CheckResult, len(h.checks))
+	var wg sync.WaitGroup
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+	for i, c := range h.checks {
+		res := results[i]
+		report.Checks[c.Name] = res
+		switch {
+		case res.Status == StatusFail:
+			report.Status = StatusFail
+		case res.Status == StatusDegraded && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs a check within its timeout.
+func run(ctx context.Context, c Check) CheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Run(ctx)
+	res := CheckResult{
+		Status:     StatusOK,
+		Critical:   c.Critical,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusDegraded
+		if c.Critical {
+			res.Status = StatusFail
+		}
+		res.Error = err.Error()
+		slog.WarnContext(ctx, "health.Check: check failed", "check", c.Name, "critical", c.Critical, "error", err)
+	}
+	return res
+}
+
+// Liveness answers 200 while the process can serve HTTP at all.
+func (h *Health) Liveness(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readiness answers 200 with the report of the checks, or 503 if a critical check failed
+// or the server is shutting down, see Drain.
+func (h *Health) Readiness(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		respond(w, http.StatusServiceUnavailable, Report{Status: StatusShuttingDown})
+		return
+	}
+	report := h.Check(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	respond(w, status, report)
+}
+
+func respond(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
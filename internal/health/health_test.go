@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("boom") }
+
+// probe serves the handler and decodes the report.
+func probe(t *testing.T, handler http.HandlerFunc) (int, Report) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var report Report
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestLiveness(t *testing.T) {
+	h := New(Check{Name: "database", Critical: true, Run: failing})
+	h.Drain()
+
+	code, report := probe(t, h.Liveness)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Empty(t, report.Checks)
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantCode   int
+		wantStatus Status
+	}{
+		{
+			name:       "all ok",
+			checks:     []Check{{Name: "database", Critical: true, Run: ok}, {Name: "enricher", Run: ok}},
+			wantCode:   http.StatusOK,
+			wantStatus: StatusOK,
+		},
+		{
+			name:       "non-critical failure degrades",
+			checks:     []Check{{Name: "database", Critical: true, Run: ok}, {Name: "enricher", Run: failing}},
+			wantCode:   http.StatusOK,
+			wantStatus: StatusDegraded,
+		},
+		{
+			name:       "critical failure fails",
+			checks:     []Check{{Name: "database", Critical: true, Run: failing}, {Name: "enricher", Run: failing}},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: StatusFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, report := probe(t, New(tt.checks...).Readiness)
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantStatus, report.Status)
+			assert.Len(t, report.Checks, len(tt.checks))
+			for _, c := range tt.checks {
+				res := report.Checks[c.Name]
+				assert.Equal(t, c.Critical, res.Critical)
+				if res.Status == StatusOK {
+					assert.Empty(t, res.Error)
+				} else {
+					assert.Equal(t, "boom", res.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	blocking := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	h := New(
+		Check{Name: "slow", Critical: true, Timeout: 10 * time.Millisecond, Run: blocking},
+		Check{Name: "fast", Critical: true, Run: ok},
+	)
+
+	start := time.Now()
+	code, report := probe(t, h.Readiness)
+	assert.Less(t, time.Since(start), DefaultTimeout, "the check is bounded by its own timeout")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, report.Checks["slow"].Status)
+	assert.Contains(t, report.Checks["slow"].Error, "deadline exceeded")
+	assert.Equal(t, StatusOK, report.Checks["fast"].Status)
+}
+
+func TestReadinessDrain(t *testing.T) {
+	called := false
+	h := New(Check{Name: "database", Critical: true, Run: func(ctx context.Context) error {
+		called = true
+		return nil
+	}})
+	h.Drain()
+
+	code, report := probe(t, h.Readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusShuttingDown, report.Status)
+	assert.False(t, called, "the checks are not run while shutting down")
+}
@@ -0,0 +1,192 @@
+// Package importer creates people in bulk from CSV or NDJSON files, for the import
+// subcommand and POST /people:import.
+//
+// A file is read record by record, so its size does not matter. Every record is
+// validated like POST /people, and the valid ones are created in batches through
+// service.PersonService.CreatePeople in partial mode, which enriches the distinct
+// names of a batch concurrently. Records that can not be imported are rejected
+// with their line and the reason, the others are imported anyway.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+)
+
+// DefaultBatchSize is the number of valid records created at once by default.
+const DefaultBatchSize = 100
+
+// ErrInvalidFile is returned when a file can not be imported at all,
+// e.g. when its header has no column for a required field.
+var ErrInvalidFile = errors.New("invalid import file")
+
+// Options configures an import.
+type Options struct {
+	Format  Format
+	Mapping Mapping
+	// BatchSize is the number of valid records created at once, DefaultBatchSize if 0
+	BatchSize int
+	// Checkpoint is the file the progress is stored in after every batch. An import
+	// started with the checkpoint of an interrupted one skips the lines it already
+	// processed. The file is removed when the import completes. Empty disables it.
+	Checkpoint string
+	// Rejects receives every rejected line as a JSON object (models.ImportReject)
+	// per line. If nil, the rejects are returned in models.ImportResult.Rejects.
+	Rejects io.Writer
+}
+
+// Importer imports people through a PersonService.
+type Importer struct {
+	service service.PersonService
+	opts    Options
+}
+
+// New creates an Importer that creates people with s.
+func New(s service.PersonService, opts Options) *Importer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Mapping == (Mapping{}) {
+		opts.Mapping = DefaultMapping()
+	}
+	return &Importer{service: s, opts: opts}
+}
+
+// Run imports the people read from src and returns how many were created and
+// rejected. The changes are recorded with audit.SourceImport.
+//
+// Progress is checkpointed after each batch: if Run fails, e.g. because the
+// database is down or ctx is canceled, the result covers the lines up to the last
+// completed batch, and running it again with the same checkpoint resumes from there.
+// A crash between creating a batch and storing the checkpoint imports that batch twice.
+func (im *Importer) Run(ctx context.Context, src io.Reader) (models.ImportResult, error) {
+	ctx = audit.WithSource(ctx, audit.SourceImport)
+
+	var result models.ImportResult
+	if im.opts.Checkpoint != "" {
+		cp, err := loadCheckpoint(im.opts.Checkpoint)
+		if err != nil {
+			return result, err
+		}
+		result = cp
+		if result.LastLine > 0 {
+			slog.InfoContext(ctx, "importer.Run: resuming after line", "last_line", result.LastLine)
+		}
+	}
+
+	records, err := newRecordReader(src, im.opts.Format, im.opts.Mapping)
+	if err != nil {
+		return result, err
+	}
+
+	batch := make([]record, 0, im.opts.BatchSize)
+	valid := 0
+	for {
+		rec, err := records.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("read %s: %w", im.opts.Format, err)
+		}
+		if rec.line <= result.LastLine {
+			continue
+		}
+		if rec.err == nil {
+			rec.err = rec.req.Validate()
+		}
+		batch = append(batch, rec)
+		if rec.err == nil {
+			valid++
+		}
+		if valid < im.opts.BatchSize {
+			continue
+		}
+		if err := im.flush(ctx, batch, &result); err != nil {
+			return result, err
+		}
+		batch, valid = batch[:0], 0
+	}
+	if err := im.flush(ctx, batch, &result); err != nil {
+		return result, err
+	}
+
+	if im.opts.Checkpoint != "" {
+		if err := os.Remove(im.opts.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.ErrorContext(ctx, "importer.Run: could not remove checkpoint", "error", err)
+		}
+	}
+	slog.InfoContext(ctx, "importer.Run: import completed", "created", result.Created, "rejected", result.Rejected)
+	return result, nil
+}
+
+// flush creates the valid records of batch, rejects the others and those that
+// could not be created, and checkpoints the progress.
+func (im *Importer) flush(ctx context.Context, batch []record, result *models.ImportResult) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	reqs := make([]models.CreatePersonRequest, 0, len(batch))
+	index := make([]int, 0, len(batch))
+	for i, rec := range batch {
+		if rec.err == nil {
+			reqs = append(reqs, rec.req)
+			index = append(index, i)
+		}
+	}
+	if len(reqs) > 0 {
+		slog.InfoContext(ctx, "importer.flush: creating people", "count", len(reqs))
+		items, err := im.service.CreatePeople(ctx, reqs, models.BatchPartial)
+		if err != nil {
+			return fmt.Errorf("create people of lines %d-%d: %w", batch[0].line, batch[len(batch)-1].line, err)
+		}
+		for j, i := range index {
+			if items[j].Status == models.BatchCreated {
+				result.Created++
+				continue
+			}
+			batch[i].err = items[j].Err
+		}
+	}
+
+	for _, rec := range batch {
+		if rec.err == nil {
+			continue
+		}
+		if err := im.reject(result, models.ImportReject{Line: rec.line, Error: rec.err.Error(), Record: rec.raw}); err != nil {
+			return err
+		}
+	}
+	result.LastLine = batch[len(batch)-1].line
+
+	if im.opts.Checkpoint != "" {
+		return saveCheckpoint(im.opts.Checkpoint, *result)
+	}
+	return nil
+}
+
+// reject records a line that was not imported.
+func (im *Importer) reject(result *models.ImportResult, r models.ImportReject) error {
+	result.Rejected++
+	if im.opts.Rejects == nil {
+		result.Rejects = append(result.Rejects, r)
+		return nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode reject: %w", err)
+	}
+	if _, err := im.opts.Rejects.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write reject: %w", err)
+	}
+	return nil
+}
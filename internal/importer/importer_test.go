@@ -0,0 +1,181 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+	"person-enricher/internal/service"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeService creates every person except those named "conflict", and fails
+// the whole batch when a person is named "down".
+type fakeService struct {
+	service.PersonService
+	batches [][]models.CreatePersonRequest
+	sources []audit.Source
+}
+
+func (f *fakeService) CreatePeople(ctx context.Context, reqs []models.CreatePersonRequest, mode models.BatchMode) ([]models.BatchItem, error) {
+	f.batches = append(f.batches, reqs)
+	f.sources = append(f.sources, audit.FromContext(ctx).Source)
+	items := make([]models.BatchItem, len(reqs))
+	for i, req := range reqs {
+		switch req.Name {
+		case "down":
+			return nil, errors.New("db error")
+		case "conflict":
+			items[i] = models.BatchItem{Status: models.BatchFailed, Err: models.ErrConflict}
+		default:
+			items[i] = models.BatchItem{Status: models.BatchCreated, Person: models.Person{Name: req.Name}}
+		}
+	}
+	return items, nil
+}
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Mapping
+		wantErr bool
+	}{
+		{"empty", "", DefaultMapping(), false},
+		{"some fields", "name=first_name, surname = last_name", Mapping{Name: "first_name", Surname: "last_name", Patronymic: "patronymic"}, false},
+		{"unknown field", "age=years", Mapping{}, true},
+		{"no column", "name=", Mapping{}, true},
+		{"no separator", "name", Mapping{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMapping(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidFile)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRecordReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		mapping Mapping
+		input   string
+		want    []record
+		wantErr bool
+	}{
+		{
+			name:    "csv with mapping",
+			format:  FormatCSV,
+			mapping: Mapping{Name: "first", Surname: "last", Patronymic: "middle"},
+			input:   "\ufefffirst,last,age\nIvan,Ivanov,30\n\"Petr\",Petrov\n",
+			want: []record{
+				{line: 2, raw: "Ivan,Ivanov,30", req: models.CreatePersonRequest{Name: "Ivan", Surname: "Ivanov"}},
+				{line: 3, raw: "Petr,Petrov", req: models.CreatePersonRequest{Name: "Petr", Surname: "Petrov"}},
+			},
+		},
+		{
+			name:    "csv without surname column",
+			format:  FormatCSV,
+			mapping: DefaultMapping(),
+			input:   "name,last\nIvan,Ivanov\n",
+			wantErr: true,
+		},
+		{
+			name:    "ndjson",
+			format:  FormatNDJSON,
+			mapping: DefaultMapping(),
+			input:   "{\"name\":\"Ivan\",\"surname\":\"Ivanov\",\"patronymic\":null}\n\n{bad\n{\"name\":1}\n",
+			want: []record{
+				{line: 1, raw: `{"name":"Ivan","surname":"Ivanov","patronymic":null}`, req: models.CreatePersonRequest{Name: "Ivan", Surname: "Ivanov"}},
+				{line: 3, raw: "{bad"},
+				{line: 4, raw: `{"name":1}`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newRecordReader(strings.NewReader(tt.input), tt.format, tt.mapping)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidFile)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got []record
+			for {
+				rec, err := r.next()
+				if err != nil {
+					break
+				}
+				got = append(got, rec)
+			}
+			assert.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].line, got[i].line)
+				assert.Equal(t, tt.want[i].raw, got[i].raw)
+				assert.Equal(t, tt.want[i].req, got[i].req)
+				assert.Equal(t, tt.want[i].req == models.CreatePersonRequest{}, got[i].err != nil)
+			}
+		})
+	}
+}
+
+func TestImporter_Run(t *testing.T) {
+	input := "name,surname\nIvan,Ivanov\n,Petrov\nconflict,Sidorov\nAnna,Petrova\nOlga,Ivanova\n"
+	svc := &fakeService{}
+
+	result, err := New(svc, Options{Format: FormatCSV, BatchSize: 2}).Run(context.Background(), strings.NewReader(input))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 6, result.LastLine)
+	assert.Equal(t, 3, result.Created)
+	assert.Equal(t, 2, result.Rejected)
+	assert.Equal(t, []models.ImportReject{
+		{Line: 3, Error: "name is required", Record: ",Petrov"},
+		{Line: 4, Error: models.ErrConflict.Error(), Record: "conflict,Sidorov"},
+	}, result.Rejects)
+	assert.Len(t, svc.batches, 2)
+	assert.Equal(t, []audit.Source{audit.SourceImport, audit.SourceImport}, svc.sources)
+}
+
+func TestImporter_RunResume(t *testing.T) {
+	dir := t.TempDir()
+	checkpoint := filepath.Join(dir, "people.checkpoint")
+	rejects := new(strings.Builder)
+	opts := Options{Format: FormatNDJSON, BatchSize: 1, Checkpoint: checkpoint, Rejects: rejects}
+	input := `{"name":"Ivan","surname":"Ivanov"}
+{"name":"down","surname":"Petrov"}
+{"name":"Anna"}
+`
+
+	// the second batch fails, the checkpoint keeps the first one
+	result, err := New(&fakeService{}, opts).Run(context.Background(), strings.NewReader(input))
+	assert.Error(t, err)
+	assert.Equal(t, models.ImportResult{LastLine: 1, Created: 1}, result)
+	_, err = os.Stat(checkpoint)
+	assert.NoError(t, err)
+
+	// resuming skips the first line
+	svc := &fakeService{}
+	input = strings.Replace(input, "down", "Petr", 1)
+	result, err = New(svc, opts).Run(context.Background(), strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportResult{LastLine: 3, Created: 2, Rejected: 1}, result)
+	assert.Equal(t, [][]models.CreatePersonRequest{{{Name: "Petr", Surname: "Petrov"}}}, svc.batches)
+	assert.Equal(t, `{"line":3,"error":"surname is required","record":"{\"name\":\"Anna\"}"}`+"\n", rejects.String())
+	_, err = os.Stat(checkpoint)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,251 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"person-enricher/internal/models"
+	"strings"
+)
+
+// Format is the format of an import file.
+type Format string
+
+const (
+	// FormatCSV — comma-separated values with a header row
+	FormatCSV Format = "csv"
+	// FormatNDJSON — one JSON object per line
+	FormatNDJSON Format = "ndjson"
+)
+
+// maxLineSize is the longest NDJSON line the importer reads.
+const maxLineSize = 1 << 20
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatNDJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: unknown format %q, expected csv or ndjson", ErrInvalidFile, s)
+}
+
+// FormatFromPath returns the format of a file by its extension.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("%w: can not tell the format of %q, expected .csv, .ndjson or .jsonl", ErrInvalidFile, path)
+}
+
+// FormatFromContentType returns the format of an uploaded file by its media type.
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson", "application/ndjson":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("%w: unsupported content type %q", ErrInvalidFile, contentType)
+}
+
+// Mapping names the CSV columns, or the NDJSON keys, the fields of a person are read from.
+type Mapping struct {
+	Name       string
+	Surname    string
+	Patronymic string
+}
+
+// DefaultMapping reads every field from the column named like its JSON field.
+func DefaultMapping() Mapping {
+	return Mapping{Name: "name", Surname: "surname", Patronymic: "patronymic"}
+}
+
+// ParseMapping parses a mapping like "name=first_name,surname=last_name".
+// Fields left out are read from their default column.
+func ParseMapping(s string) (Mapping, error) {
+	m := DefaultMapping()
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return Mapping{}, fmt.Errorf("%w: invalid mapping %q, expected field=column", ErrInvalidFile, pair)
+		}
+		switch field {
+		case "name":
+			m.Name = column
+		case "surname":
+			m.Surname = column
+		case "patronymic":
+			m.Patronymic = column
+		default:
+			return Mapping{}, fmt.Errorf("%w: unknown field %q in mapping, expected name, surname or patronymic", ErrInvalidFile, field)
+		}
+	}
+	return m, nil
+}
+
+// record is one line of an import file. A record with err set is rejected.
+type record struct {
+	line int
+	raw  string
+	req  models.CreatePersonRequest
+	err  error
+}
+
+// recordReader reads the records of an import file one by one.
+// next returns io.EOF after the last record.
+type recordReader interface {
+	next() (record, error)
+}
+
+// newRecordReader returns the reader of the records of src in the given format.
+func newRecordReader(src io.Reader, format Format, m Mapping) (recordReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(src, m)
+	case FormatNDJSON:
+		return newNDJSONReader(src, m), nil
+	}
+	return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidFile, format)
+}
+
+// csvReader reads records from CSV with a header row.
+type csvReader struct {
+	r *csv.Reader
+	// columns of name, surname and patronymic, -1 if there is no patronymic column
+	name, surname, patronymic int
+}
+
+// newCSVReader reads the header of src and finds the mapped columns in it.
+// The name and surname columns are required.
+func newCSVReader(src io.Reader, m Mapping) (*csvReader, error) {
+	r := csv.NewReader(src)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: read header: %v", ErrInvalidFile, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		// Excel starts UTF-8 files with a byte order mark
+		columns[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+
+	c := &csvReader{r: r, patronymic: -1}
+	var ok bool
+	if c.name, ok = columns[m.Name]; !ok {
+		return nil, fmt.Errorf("%w: no %q column for the name", ErrInvalidFile, m.Name)
+	}
+	if c.surname, ok = columns[m.Surname]; !ok {
+		return nil, fmt.Errorf("%w: no %q column for the surname", ErrInvalidFile, m.Surname)
+	}
+	if i, ok := columns[m.Patronymic]; ok {
+		c.patronymic = i
+	}
+	return c, nil
+}
+
+func (c *csvReader) next() (record, error) {
+	fields, err := c.r.Read()
+	if err == io.EOF {
+		return record{}, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return record{line: parseErr.StartLine, err: fmt.Errorf("invalid CSV: %v", parseErr.Err)}, nil
+	}
+	if err != nil {
+		return record{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	return record{
+		line: line,
+		raw:  csvLine(fields),
+		req: models.CreatePersonRequest{
+			Name:       field(fields, c.name),
+			Surname:    field(fields, c.surname),
+			Patronymic: field(fields, c.patronymic),
+		},
+	}, nil
+}
+
+// field returns the i-th field of a CSV record, or "" if there is none.
+func field(fields []string, i int) string {
+	if i < 0 || i >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[i])
+}
+
+// csvLine formats fields back as a CSV line, for the reject file.
+func csvLine(fields []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(fields)
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ndjsonReader reads records from newline-delimited JSON objects.
+// Blank lines are skipped.
+type ndjsonReader struct {
+	s    *bufio.Scanner
+	m    Mapping
+	line int
+}
+
+func newNDJSONReader(src io.Reader, m Mapping) *ndjsonReader {
+	s := bufio.NewScanner(src)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &ndjsonReader{s: s, m: m}
+}
+
+func (n *ndjsonReader) next() (record, error) {
+	for n.s.Scan() {
+		n.line++
+		raw := strings.TrimSpace(n.s.Text())
+		if raw == "" {
+			continue
+		}
+		rec := record{line: n.line, raw: raw}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+			rec.err = fmt.Errorf("invalid JSON: %v", err)
+			return rec, nil
+		}
+		values := make([]string, 3)
+		for i, key := range []string{n.m.Name, n.m.Surname, n.m.Patronymic} {
+			v, ok := obj[key]
+			if !ok || v == nil {
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				rec.err = fmt.Errorf("%q must be a string", key)
+				return rec, nil
+			}
+			values[i] = strings.TrimSpace(s)
+		}
+		rec.req = models.CreatePersonRequest{Name: values[0], Surname: values[1], Patronymic: values[2]}
+		return rec, nil
+	}
+	if err := n.s.Err(); err != nil {
+		return record{}, fmt.Errorf("line %d: %w", n.line+1, err)
+	}
+	return record{}, io.EOF
+}
@@ -0,0 +1,189 @@
+// Package lifecycle starts the components of the server in order and stops them in
+// reverse order within a deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultStopTimeout bounds the stop of all the components unless New is given another.
+const DefaultStopTimeout = 30 * time.Second
+
+// Component is a part of the server with a lifetime, such as the database, a background
+// worker or an HTTP server.
+type Component struct {
+	// Name identifies the component in the logs and errors.
+	Name string
+	// Start starts the component and returns once it runs; nil if there is nothing to start.
+	Start func(ctx context.Context) error
+	// Stop stops the component, giving up when ctx is done; nil if there is nothing to stop.
+	Stop func(ctx context.Context) error
+}
+
+// Manager runs components: Run starts them in the order they were added and stops the
+// started ones in reverse order.
+type Manager struct {
+	components  []Component
+	stopTimeout time.Duration
+	// failed receives the errors of components failing while they run
+	failed chan error
+}
+
+// New returns a Manager stopping all its components within stopTimeout; 0 means
+// DefaultStopTimeout.
+func New(stopTimeout time.Duration) *Manager {
+	if stopTimeout <= 0 {
+		stopTimeout = DefaultStopTimeout
+	}
+	return &Manager{stopTimeout: stopTimeout, failed: make(chan error, 1)}
+}
+
+// Add appends c to the components, to start after those added before.
+func (m *Manager) Add(c Component) {
+	m.components = append(m.components, c)
+}
+
+// Fail stops the components as if Run's context was canceled, and makes Run return err.
+// It is meant for components failing while they run; only the first failure is kept.
+func (m *Manager) Fail(err error) {
+	select {
+	case m.failed <- err:
+	default:
+	}
+}
+
+// AddWorker adds a component running run in a goroutine until the component is stopped.
+// Stopping it cancels the context of run and waits for it to return.
+func (m *Manager) AddWorker(name string, run func(ctx context.Context)) {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+	m.Add(Component{
+		Name: name,
+		Start: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				run(ctx)
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				// ctx is done already if the components stopped earlier used up the deadline
+				select {
+				case <-done:
+					return nil
+				default:
+					return fmt.Errorf("worker did not return: %w", ctx.Err())
+				}
+			}
+		},
+	})
+}
+
+// AddServer adds a component serving srv. Start listens on srv.Addr, so that a port in
+// use fails the start, then serves in the background; an error serving fails the manager.
+// Stop shuts the server down gracefully. In-flight requests may drain for half the time
+// left before the deadline; then their contexts are canceled, which aborts the enricher
+// calls they wait for, and they get the other half to answer. The server is closed if
+// they still outlast the deadline.
+func (m *Manager) AddServer(name string, srv *http.Server) {
+	base, cancelRequests := context.WithCancel(context.Background())
+	srv.BaseContext = func(net.Listener) context.Context { return base }
+	m.Add(Component{
+		Name: name,
+		Start: func(context.Context) error {
+			ln, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return err
+			}
+			slog.Info("lifecycle.AddServer: listening", "component", name, "addr", ln.Addr().String())
+			go func() {
+				if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					m.Fail(fmt.Errorf("%s: %w", name, err))
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			if deadline, ok := ctx.Deadline(); ok {
+				drain := time.AfterFunc(time.Until(deadline)/2, func() {
+					slog.Warn("lifecycle.AddServer: requests outlasted the drain, canceling them", "component", name)
+					cancelRequests()
+				})
+				defer drain.Stop()
+			}
+			err := srv.Shutdown(ctx)
+			cancelRequests()
+			if err != nil {
+				slog.Warn("lifecycle.AddServer: requests outlasted the shutdown, closing", "component", name, "error", err)
+				return errors.Join(err, srv.Close())
+			}
+			return nil
+		},
+	})
+}
+
+// Run starts the components, then waits for ctx to be done or a component to fail, and
+// stops the started components in reverse order within the stop timeout. It returns the
+// errors of the start, the failure and the stops, nil after a clean shutdown.
+func (m *Manager) Run(ctx context.Context) error {
+	started, err := m.start(ctx)
+	if err == nil {
+		select {
+		case <-ctx.Done():
+			slog.Info("lifecycle.Run: shutting down")
+		case err = <-m.failed:
+			slog.Error("lifecycle.Run: component failed, shutting down", "error", err)
+		}
+	}
+	return errors.Join(err, m.stop(started))
+}
+
+// start starts the components in order, up to the first failing one, and returns those started.
+func (m *Manager) start(ctx context.Context) ([]Component, error) {
+	for i, c := range m.components {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				slog.Error("lifecycle.Run: could not start", "component", c.Name, "error", err)
+				return m.components[:i], fmt.Errorf("start %s: %w", c.Name, err)
+			}
+		}
+		slog.Info("lifecycle.Run: started", "component", c.Name)
+	}
+	return m.components, nil
+}
+
+// stop stops components in reverse order, all of them within the stop timeout. A component
+// failing to stop does not keep the others from stopping.
+func (m *Manager) stop(components []Component) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.stopTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		if c.Stop == nil {
+			continue
+		}
+		start := time.Now()
+		if err := c.Stop(ctx); err != nil {
+			slog.Error("lifecycle.Run: could not stop", "component", c.Name, "error", err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+			continue
+		}
+		slog.Info("lifecycle.Run: stopped", "component", c.Name, "duration", time.Since(start))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,197 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder records the starts and stops of components.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) component(name string, startErr, stopErr error) Component {
+	return Component{
+		Name: name,
+		Start: func(context.Context) error {
+			r.record("start " + name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			r.record("stop " + name)
+			return stopErr
+		},
+	}
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// canceled returns a context that is already canceled.
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestRunOrder(t *testing.T) {
+	var r recorder
+	m := New(time.Second)
+	m.Add(r.component("db", nil, nil))
+	m.Add(Component{Name: "nothing"})
+	m.Add(r.component("http", nil, nil))
+
+	assert.NoError(t, m.Run(canceled()))
+	assert.Equal(t, []string{"start db", "start http", "stop http", "stop db"}, r.events)
+}
+
+func TestRunStartFailure(t *testing.T) {
+	var r recorder
+	boom := errors.New("boom")
+	m := New(time.Second)
+	m.Add(r.component("db", nil, nil))
+	m.Add(r.component("http", boom, nil))
+	m.Add(r.component("metrics", nil, nil))
+
+	err := m.Run(context.Background())
+	assert.ErrorIs(t, err, boom)
+	assert.ErrorContains(t, err, "start http")
+	assert.Equal(t, []string{"start db", "start http", "stop db"}, r.events)
+}
+
+func TestRunStopFailure(t *testing.T) {
+	var r recorder
+	boom := errors.New("boom")
+	m := New(time.Second)
+	m.Add(r.component("db", nil, nil))
+	m.Add(r.component("http", nil, boom))
+
+	err := m.Run(canceled())
+	assert.ErrorIs(t, err, boom)
+	assert.ErrorContains(t, err, "stop http")
+	assert.Equal(t, []string{"start db", "start http", "stop http", "stop db"}, r.events, "the others still stop")
+}
+
+func TestFail(t *testing.T) {
+	var r recorder
+	boom := errors.New("boom")
+	m := New(time.Second)
+	m.Add(r.component("db", nil, nil))
+	m.Add(Component{Name: "server", Start: func(context.Context) error {
+		go m.Fail(boom)
+		return nil
+	}})
+
+	assert.ErrorIs(t, m.Run(context.Background()), boom)
+	assert.Equal(t, []string{"start db", "stop db"}, r.events)
+}
+
+func TestAddWorker(t *testing.T) {
+	returned := make(chan struct{})
+	m := New(time.Second)
+	m.AddWorker("job", func(ctx context.Context) {
+		<-ctx.Done()
+		close(returned)
+	})
+	assert.NoError(t, m.Run(canceled()))
+	select {
+	case <-returned:
+	default:
+		t.Fatal("the worker did not return")
+	}
+
+	m = New(10 * time.Millisecond)
+	m.AddWorker("stuck", func(ctx context.Context) { select {} })
+	assert.ErrorIs(t, m.Run(canceled()), context.DeadlineExceeded)
+
+	// A worker that returned is stopped even if the components stopped before it
+	// used up the deadline
+	for i := 0; i < 20; i++ {
+		m = New(time.Millisecond)
+		m.AddWorker("done", func(context.Context) {})
+		m.Add(Component{Name: "slow", Stop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}})
+		assert.NoError(t, m.Run(canceled()))
+	}
+}
+
+// freeAddr returns the address of a port nothing listens on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestAddServer(t *testing.T) {
+	inFlight := make(chan struct{})
+	aborted := make(chan time.Duration, 1)
+	addr := freeAddr(t)
+	m := New(400 * time.Millisecond)
+	m.AddServer("http", &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		close(inFlight)
+		<-r.Context().Done()
+		aborted <- time.Since(start)
+	})})
+	ctx, cancel := context.WithCancel(context.Background())
+	m.Add(Component{Name: "client", Start: func(context.Context) error {
+		go http.Get("http://" + addr)
+		return nil
+	}})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	<-inFlight
+	cancel()
+
+	assert.NoError(t, <-done, "the request answered once its context was canceled")
+	assert.GreaterOrEqual(t, <-aborted, 150*time.Millisecond, "the request drained for half the deadline first")
+}
+
+func TestAddServerStuckRequest(t *testing.T) {
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	addr := freeAddr(t)
+	m := New(50 * time.Millisecond)
+	m.AddServer("http", &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		<-release
+	})})
+	ctx, cancel := context.WithCancel(context.Background())
+	m.Add(Component{Name: "client", Start: func(context.Context) error {
+		go http.Get("http://" + addr)
+		return nil
+	}})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	<-inFlight
+	cancel()
+
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded, "the request outlasted the shutdown")
+}
+
+func TestAddServerPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	m := New(time.Second)
+	m.AddServer("http", &http.Server{Addr: ln.Addr().String()})
+	assert.ErrorContains(t, m.Run(context.Background()), "start http")
+}
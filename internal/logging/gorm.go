@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SlowQueryThreshold is the default duration from which a query is logged as a warning.
+const SlowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger writes the GORM logs to a slog.Logger, with the context of the query,
+// so that the queries run for a request carry its request id.
+// Queries are logged at debug level, slow queries as warnings and failed queries
+// as errors, not counting gorm.ErrRecordNotFound. Bound parameters are left out
+// of the logged SQL unless the unredacted mode is on.
+type GormLogger struct {
+	log   *slog.Logger
+	level logger.LogLevel
+	slow  time.Duration
+}
+
+// NewGormLogger returns a GormLogger writing to l, with SlowQueryThreshold.
+func NewGormLogger(l *slog.Logger) *GormLogger {
+	return &GormLogger{log: l, level: logger.Info, slow: SlowQueryThreshold}
+}
+
+// WithSlowThreshold returns a copy of the logger logging the queries taking d or longer
+// as warnings. A d of 0 keeps the threshold of g.
+func (g *GormLogger) WithSlowThreshold(d time.Duration) *GormLogger {
+	c := *g
+	if d > 0 {
+		c.slow = d
+	}
+	return &c
+}
+
+// LogMode returns a copy of the logger that only logs from the given GORM level on.
+func (g *GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *g
+	c.level = level
+	return &c
+}
+
+// Info logs a GORM message at info level.
+func (g *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if g.level >= logger.Info {
+		g.log.InfoContext(ctx, "gorm: "+fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn logs a GORM message at warn level.
+func (g *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if g.level >= logger.Warn {
+		g.log.WarnContext(ctx, "gorm: "+fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error logs a GORM message at error level.
+func (g *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if g.level >= logger.Error {
+		g.log.ErrorContext(ctx, "gorm: "+fmt.Sprintf(msg, args...))
+	}
+}
+
+// ParamsFilter implements gorm.ParamsFilter: it drops the bound parameters of the
+// logged SQL, which then keeps its placeholders, unless the unredacted mode is on.
+func (g *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if Unredacted() {
+		return sql, params
+	}
+	return sql, nil
+}
+
+// Trace logs a query run between begin and now.
+func (g *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if g.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && g.level >= logger.Error:
+		sql, rows := fc()
+		g.log.ErrorContext(ctx, "gorm: query failed", "sql", sql, "rows", rows, "duration", elapsed, "error", err)
+	case elapsed >= g.slow && g.level >= logger.Warn:
+		sql, rows := fc()
+		g.log.WarnContext(ctx, "gorm: slow query", "sql", sql, "rows", rows, "duration", elapsed)
+	case g.level >= logger.Info && g.log.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		g.log.DebugContext(ctx, "gorm: query", "sql", sql, "rows", rows, "duration", elapsed)
+	}
+}
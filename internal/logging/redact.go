@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+)
+
+// Redacted replaces a value that may not be logged.
+const Redacted = "[REDACTED]"
+
+// unredacted is set in local development, where personal data and payloads are logged as they are.
+var unredacted atomic.Bool
+
+// SetUnredacted turns the unredacted mode on or off. It must only be turned on in local development.
+func SetUnredacted(on bool) {
+	unredacted.Store(on)
+}
+
+// Unredacted reports whether the unredacted mode is on.
+func Unredacted() bool {
+	return unredacted.Load()
+}
+
+// PII returns the form of the personal data s that may be logged: a short hash,
+// which tells equal values apart without revealing them, e.g. "sha256:9f86d081884c".
+// In unredacted mode s is returned as it is. An empty s stays empty.
+func PII(s string) string {
+	if s == "" || Unredacted() {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// Sensitive wraps a value, e.g. a whole response payload, that is only logged
+// in unredacted mode. Otherwise it is logged as Redacted.
+type Sensitive struct {
+	Value interface{}
+}
+
+// LogValue implements slog.LogValuer.
+func (s Sensitive) LogValue() slog.Value {
+	if Unredacted() {
+		return slog.AnyValue(s.Value)
+	}
+	return slog.StringValue(Redacted)
+}
+
+// URL returns u as it may be logged: the values of its query parameters, which may hold
+// personal data such as a name, are hashed by PII.
+func URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	redacted.User = nil
+	q := u.Query()
+	for key, values := range q {
+		for i, v := range values {
+			values[i] = PII(v)
+		}
+		q[key] = values
+	}
+	redacted.RawQuery = q.Encode()
+	return redacted.String()
+}
@@ -1,11 +1,22 @@
+// Package metrics defines the Prometheus metrics of the application.
 package metrics
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+
+	"person-enricher/internal/models"
 )
 
-var (
+// Metrics holds the Prometheus metrics of the application. It is built with New
+// against a registerer, so that tests can use a registry of their own.
+type Metrics struct {
 	// HTTPRequestDuration measures the duration of HTTP requests by method and path.
 	HTTPRequestDuration *prometheus.HistogramVec
 
@@ -17,31 +28,175 @@ var (
 
 	// EnricherRequestDuration measures the duration of external enricher API requests by type.
 	EnricherRequestDuration *prometheus.HistogramVec
+
+	// HTTPRequestsTotal counts HTTP requests by method, path and status code.
+	HTTPRequestsTotal *prometheus.CounterVec
+
+	// ServiceMethodCalls counts service method calls by method name and outcome, see Outcome.
+	ServiceMethodCalls *prometheus.CounterVec
+
+	// RepoMethodCalls counts repository method calls by method name and outcome, see Outcome.
+	RepoMethodCalls *prometheus.CounterVec
+
+	// EnricherRequestsTotal counts external enricher API requests by provider and result:
+	// ok, empty, rate_limited, http_error, decode_error or timeout.
+	EnricherRequestsTotal *prometheus.CounterVec
+
+	// DBSlowQueries counts the SQL queries taking the slow query threshold or longer,
+	// by operation (query, create, update, delete, row or raw) and table.
+	DBSlowQueries *prometheus.CounterVec
+
+	opts Options
+}
+
+// Options configures the metrics of an instance.
+type Options struct {
+	// Namespace prefixes the metric names, e.g. "person_enricher" gives
+	// person_enricher_http_requests_total. Empty leaves them as they are.
+	Namespace string
+	// ConstLabels are added to every metric, e.g. {"replica": "a"}, to tell apart
+	// several instances scraped into the same Prometheus.
+	ConstLabels prometheus.Labels
+}
+
+// New creates the metrics and registers them with reg. It returns an error if one
+// of them cannot be registered, e.g. because reg already has a metric of the same name.
+func New(reg prometheus.Registerer, opts Options) (*Metrics, error) {
+	histogram := func(name, help string, labels ...string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+			Buckets:     prometheus.DefBuckets,
+		}, labels)
+	}
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+		}, labels)
+	}
+
+	m := &Metrics{
+		RepoMethodDuration: histogram("repo_method_duration_seconds",
+			"Duration of repository method executions by method name.", "method"),
+		EnricherRequestDuration: histogram("enricher_request_duration_seconds",
+			"Duration of external enricher API requests by type.", "type"),
+		HTTPRequestDuration: histogram("http_request_duration_seconds",
+			"Duration of HTTP requests by method and path.", "method", "path"),
+		ServiceMethodDuration: histogram("service_method_duration_seconds",
+			"Duration of service method executions by method name.", "method"),
+		HTTPRequestsTotal: counter("http_requests_total",
+			"Number of HTTP requests by method, path and status code.", "method", "path", "code"),
+		ServiceMethodCalls: counter("service_method_calls_total",
+			"Number of service method calls by method name and outcome.", "method", "outcome"),
+		RepoMethodCalls: counter("repo_method_calls_total",
+			"Number of repository method calls by method name and outcome.", "method", "outcome"),
+		EnricherRequestsTotal: counter("enricher_requests_total",
+			"Number of external enricher API requests by provider and result.", "provider", "result"),
+		DBSlowQueries: counter("db_slow_queries_total",
+			"Number of SQL queries slower than the threshold by operation and table.", "operation", "table"),
+		opts: opts,
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.RepoMethodDuration, m.EnricherRequestDuration, m.HTTPRequestDuration, m.ServiceMethodDuration,
+		m.HTTPRequestsTotal, m.ServiceMethodCalls, m.RepoMethodCalls, m.EnricherRequestsTotal,
+		m.DBSlowQueries,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("register metric: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// NewDesc returns the description of a metric with the namespace and constant labels
+// of m, for the collectors of other packages, which compute their metrics when scraped.
+func (m *Metrics) NewDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(m.opts.Namespace, "", name), help, labels, m.opts.ConstLabels)
+}
+
+// labelName matches the names Prometheus accepts for labels.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseLabels parses constant labels written as "name=value" pairs separated by commas,
+// e.g. "region=eu,replica=a". An empty string gives no labels.
+func ParseLabels(s string) (prometheus.Labels, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	labels := prometheus.Labels{}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", strings.TrimSpace(pair))
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("duplicate label %q", name)
+		}
+		labels[name] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// Outcomes of the service and repository calls. A failed call is counted by the class
+// of its error, so that client errors, such as a missing person, can be told apart
+// from failures worth an alert.
+const (
+	OutcomeOK              = "ok"
+	OutcomeNotFound        = "not_found"
+	OutcomeInvalidID       = "invalid_id"
+	OutcomeConflict        = "conflict"
+	OutcomeVersionMismatch = "version_mismatch"
+	OutcomeInvalidPatch    = "invalid_patch"
+	OutcomeValidation      = "validation"
+	OutcomeMerged          = "merged"
+	OutcomeCanceled        = "canceled"
+	OutcomeTimeout         = "timeout"
+	OutcomeError           = "error"
 )
 
-// InitMetrics инициализирует метрики Prometheus.
-func InitMetrics() {
-	RepoMethodDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "repo_method_duration_seconds",
-		Help:    "Duration of repository method executions by method name.",
-		Buckets: prometheus.DefBuckets,
-	}, []string{"method"})
-
-	EnricherRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "enricher_request_duration_seconds",
-		Help:    "Duration of external enricher API requests by type.",
-		Buckets: prometheus.DefBuckets,
-	}, []string{"type"})
-
-	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "http_request_duration_seconds",
-		Help:    "Duration of HTTP requests by method and path.",
-		Buckets: prometheus.DefBuckets,
-	}, []string{"method", "path"})
-
-	ServiceMethodDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name:    "service_method_duration_seconds",
-		Help:    "Duration of service method executions by method name.",
-		Buckets: prometheus.DefBuckets,
-	}, []string{"method"})
+// Outcome returns the outcome of a call that returned err.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, models.ErrNotFound):
+		return OutcomeNotFound
+	case errors.Is(err, models.ErrInvalidID):
+		return OutcomeInvalidID
+	case errors.Is(err, models.ErrConflict):
+		return OutcomeConflict
+	case errors.Is(err, models.ErrVersionMismatch):
+		return OutcomeVersionMismatch
+	case errors.Is(err, models.ErrInvalidPatch):
+		return OutcomeInvalidPatch
+	case errors.Is(err, models.ErrValidation):
+		return OutcomeValidation
+	case errors.Is(err, models.ErrMerged):
+		return OutcomeMerged
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return OutcomeTimeout
+	default:
+		return OutcomeError
+	}
+}
+
+// Observe adds v to the histogram obs. When ctx carries a sampled span, its trace id
+// is attached to the observation as an exemplar, which links the bucket to the trace.
+// Exemplars are only exposed in the OpenMetrics format.
+func Observe(ctx context.Context, obs prometheus.Observer, v float64) {
+	sc := trace.SpanContextFromContext(ctx)
+	if eo, ok := obs.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+		eo.ObserveWithExemplar(v, prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	obs.Observe(v)
 }
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+
+	"person-enricher/internal/models"
+)
+
+func TestOutcome(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, OutcomeOK},
+		{fmt.Errorf("get by id: %w", models.ErrNotFound), OutcomeNotFound},
+		{models.ErrInvalidID, OutcomeInvalidID},
+		{models.ErrConflict, OutcomeConflict},
+		{models.ErrVersionMismatch, OutcomeVersionMismatch},
+		{models.ErrInvalidPatch, OutcomeInvalidPatch},
+		{models.ErrValidation, OutcomeValidation},
+		{models.ErrMerged, OutcomeMerged},
+		{context.Canceled, OutcomeCanceled},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), OutcomeTimeout},
+		{errors.New("db error"), OutcomeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, Outcome(tt.err))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg, Options{
+		Namespace:   "person_enricher",
+		ConstLabels: prometheus.Labels{"replica": "a"},
+	})
+	assert.NoError(t, err)
+
+	m.HTTPRequestsTotal.WithLabelValues("GET", "/v1/people", "200").Inc()
+	m.ServiceMethodDuration.WithLabelValues("GetPeople").Observe(0.1)
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	names := make([]string, 0, len(families))
+	for _, f := range families {
+		names = append(names, f.GetName())
+		for _, metric := range f.GetMetric() {
+			assert.Contains(t, metric.GetLabel(), &dto.LabelPair{Name: ptr("replica"), Value: ptr("a")})
+		}
+	}
+	assert.Equal(t, []string{"person_enricher_http_requests_total", "person_enricher_service_method_duration_seconds"}, names)
+
+	_, err = New(reg, Options{Namespace: "person_enricher", ConstLabels: prometheus.Labels{"replica": "a"}})
+	assert.Error(t, err, "the metrics are already registered")
+
+	_, err = New(prometheus.NewRegistry(), Options{})
+	assert.NoError(t, err, "another registry takes the same metrics")
+}
+
+func ptr(s string) *string { return &s }
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    prometheus.Labels
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"region=eu", prometheus.Labels{"region": "eu"}, false},
+		{" region = eu , replica=a", prometheus.Labels{"region": "eu", "replica": "a"}, false},
+		{"region", nil, true},
+		{"1region=eu", nil, true},
+		{"__name__=x", nil, true},
+		{"region=eu,region=us", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLabels(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestObserveExemplar(t *testing.T) {
+	m, err := New(prometheus.NewRegistry(), Options{})
+	assert.NoError(t, err)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	Observe(trace.ContextWithSpanContext(context.Background(), sc), m.HTTPRequestDuration.WithLabelValues("GET", "/v1/people"), 0.1)
+	Observe(context.Background(), m.HTTPRequestDuration.WithLabelValues("GET", "/v1/people"), 0.2)
+
+	var metric dto.Metric
+	assert.NoError(t, m.HTTPRequestDuration.WithLabelValues("GET", "/v1/people").(prometheus.Metric).Write(&metric))
+	assert.Equal(t, uint64(2), metric.GetHistogram().GetSampleCount())
+	var exemplars []*dto.Exemplar
+	for _, b := range metric.GetHistogram().GetBucket() {
+		if b.GetExemplar() != nil {
+			exemplars = append(exemplars, b.GetExemplar())
+		}
+	}
+	assert.Len(t, exemplars, 1)
+	assert.Equal(t, sc.TraceID().String(), exemplars[0].GetLabel()[0].GetValue())
+}
@@ -0,0 +1,300 @@
+// Package migrations applies the versioned SQL migrations embedded into the binary.
+//
+// Every migration is a pair of files sql/NNNN_name.up.sql and sql/NNNN_name.down.sql.
+// Applied versions are recorded in the schema_migrations table, and a Postgres advisory
+// lock makes sure that only one replica migrates the database at a time.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey identifies the advisory lock held while migrations run.
+const lockKey int64 = 7_305_218_846
+
+// ErrSchemaVersion is returned by CheckVersion when the database schema
+// does not match the migrations embedded into the binary.
+var ErrSchemaVersion = errors.New("unexpected schema version")
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    bigint PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a migration and whether it is applied.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Unknown is set for versions applied in the database that this binary has no files for,
+	// e.g. after a rollback of the deployment.
+	Unknown bool
+}
+
+type schemaMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// Migrator applies and rolls back migrations.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a Migrator for the migrations embedded into the binary.
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load parses the embedded migration files and returns them ordered by version.
+// Every version must have both an up and a down file.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := files.ReadFile(path.Join("sql", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the version of the newest embedded migration.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations in version order, each in its own transaction.
+// It returns the migrations that were applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			slog.InfoContext(ctx, "migrations.Up: applying migration", "version", mig.Version, "name", mig.Name)
+			if err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(mig.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+			}); err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the given number of most recently applied migrations,
+// each in its own transaction. It returns the migrations that were rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			slog.InfoContext(ctx, "migrations.Down: rolling back migration", "version", mig.Version, "name", mig.Name)
+			if err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(mig.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, "version = ?", mig.Version).Error
+			}); err != nil {
+				return fmt.Errorf("roll back migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status returns every embedded migration with the time it was applied, followed by
+// the versions applied in the database that this binary does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := appliedVersions(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if sm, ok := applied[mig.Version]; ok {
+			appliedAt := sm.AppliedAt
+			st.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, st)
+	}
+
+	var unknown []Status
+	for version, sm := range applied {
+		if known[version] {
+			continue
+		}
+		appliedAt := sm.AppliedAt
+		unknown = append(unknown, Status{Version: version, Name: sm.Name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+
+	return append(statuses, unknown...), nil
+}
+
+// CheckVersion returns an error wrapping ErrSchemaVersion unless exactly the embedded
+// migrations are applied. The server refuses to start on such an error.
+func (m *Migrator) CheckVersion(ctx context.Context) error {
+	return m.check(ctx, false)
+}
+
+// CheckApplied returns an error wrapping ErrSchemaVersion if an embedded migration is
+// pending. Unlike CheckVersion, it accepts migrations newer than the binary, which
+// the next release applies while the running servers keep serving.
+func (m *Migrator) CheckApplied(ctx context.Context) error {
+	return m.check(ctx, true)
+}
+
+func (m *Migrator) check(ctx context.Context, allowNewer bool) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		if st.Unknown && !allowNewer {
+			return fmt.Errorf("%w: database has migration %d_%s, newer than this binary (latest %d)",
+				ErrSchemaVersion, st.Version, st.Name, m.Latest())
+		}
+		if st.AppliedAt == nil {
+			return fmt.Errorf("%w: migration %d_%s is pending, run `migrate up`",
+				ErrSchemaVersion, st.Version, st.Name)
+		}
+	}
+	return nil
+}
+
+// withLock runs fn on a single connection holding the migrations advisory lock,
+// after making sure the schema_migrations table exists.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		slog.InfoContext(ctx, "migrations: acquiring advisory lock")
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return fmt.Errorf("acquire migrations lock: %w", err)
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", lockKey).Error; err != nil {
+				slog.ErrorContext(ctx, "migrations: could not release advisory lock", "error", err)
+			}
+		}()
+
+		if err := conn.Exec(createSchemaMigrations).Error; err != nil {
+			return fmt.Errorf("create schema_migrations: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+// appliedVersions returns the rows of schema_migrations by version.
+// A missing table means that nothing is applied yet.
+func appliedVersions(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var exists bool
+	if err := db.Raw("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists).Error; err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	applied := make(map[int64]schemaMigration)
+	if !exists {
+		return applied, nil
+	}
+
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
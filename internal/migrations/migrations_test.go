@@ -0,0 +1,160 @@
+package migrations
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func NewMockDB() (*gorm.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		panic(err)
+	}
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return gormDB, mock
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+	assert.Equal(t, "create_people", migrations[0].Name)
+}
+
+func expectApplied(mock sqlmock.Sqlmock, versions ...int64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, v := range versions {
+		rows.AddRow(v, "migration", time.Now())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "schema_migrations" ORDER BY version`)).
+		WillReturnRows(rows)
+}
+
+func TestMigrator_Up(t *testing.T) {
+	db, mock := NewMockDB()
+	m, err := New(db)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).
+		WithArgs(lockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectApplied(mock, m.migrations[0].Version)
+	for _, mig := range m.migrations[1:] {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(mig.Up)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "schema_migrations"`)).
+			WithArgs(mig.Version, mig.Name, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(lockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, m.migrations[1:], applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Down(t *testing.T) {
+	db, mock := NewMockDB()
+	m, err := New(db)
+	require.NoError(t, err)
+	last := m.migrations[len(m.migrations)-1]
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).
+		WithArgs(lockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectApplied(mock, m.migrations[0].Version, last.Version)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(last.Down)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "schema_migrations" WHERE version = $1`)).
+		WithArgs(last.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(lockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rolledBack, err := m.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{last}, rolledBack)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_CheckVersion(t *testing.T) {
+	migrations, err := Load()
+	require.NoError(t, err)
+	all := make([]int64, 0, len(migrations))
+	for _, m := range migrations {
+		all = append(all, m.Version)
+	}
+
+	tests := []struct {
+		name             string
+		applied          []int64
+		expectErr        string
+		expectAppliedErr string
+	}{
+		{"up to date", all, "", ""},
+		{"pending migration", all[:len(all)-1], "is pending", "is pending"},
+		{"newer database", append(append([]int64{}, all...), 9999), "newer than this binary", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := NewMockDB()
+			m, err := New(db)
+			require.NoError(t, err)
+			expectApplied(mock, tt.applied...)
+			expectApplied(mock, tt.applied...)
+
+			err = m.CheckVersion(context.Background())
+			if tt.expectErr != "" {
+				assert.ErrorIs(t, err, ErrSchemaVersion)
+				assert.ErrorContains(t, err, tt.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			err = m.CheckApplied(context.Background())
+			if tt.expectAppliedErr != "" {
+				assert.ErrorIs(t, err, ErrSchemaVersion)
+				assert.ErrorContains(t, err, tt.expectAppliedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
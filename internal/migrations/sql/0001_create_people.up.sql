@@ -0,0 +1,15 @@
+-- IF NOT EXISTS adopts databases that were created by GORM AutoMigrate.
+CREATE TABLE IF NOT EXISTS people (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        varchar(100) NOT NULL,
+    surname     varchar(100) NOT NULL,
+    patronymic  varchar(100),
+    age         bigint,
+    gender      varchar(10),
+    nationality varchar(2),
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_people_deleted_at ON people (deleted_at);
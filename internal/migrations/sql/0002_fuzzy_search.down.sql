@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_people_patronymic_trgm;
+DROP INDEX IF EXISTS idx_people_surname_trgm;
+DROP INDEX IF EXISTS idx_people_name_trgm;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
+
+-- The pg_trgm and unaccent extensions are left installed,
+-- other database objects may depend on them.
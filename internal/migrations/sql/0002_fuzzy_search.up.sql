@@ -0,0 +1,15 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE, so it is wrapped into an IMMUTABLE function
+-- that can be used in index expressions.
+CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+    AS $$ SELECT public.unaccent('public.unaccent'::regdictionary, $1) $$;
+
+CREATE INDEX IF NOT EXISTS idx_people_name_trgm
+    ON people USING gin (immutable_unaccent(name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_people_surname_trgm
+    ON people USING gin (immutable_unaccent(surname) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_people_patronymic_trgm
+    ON people USING gin (immutable_unaccent(patronymic) gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- version is incremented by every update and exposed as the ETag of a person.
+ALTER TABLE people ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
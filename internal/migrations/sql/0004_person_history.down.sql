@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS person_history;
+DROP FUNCTION IF EXISTS person_history_append_only();
@@ -0,0 +1,29 @@
+-- Append-only history of every change of a person, written in the same
+-- transaction as the change. No foreign key: the history outlives purged people.
+CREATE TABLE IF NOT EXISTS person_history (
+    id          bigserial PRIMARY KEY,
+    person_id   uuid NOT NULL,
+    version     bigint NOT NULL,
+    operation   varchar(16) NOT NULL,
+    before      jsonb,
+    after       jsonb,
+    diff        jsonb NOT NULL DEFAULT '{}',
+    actor       text NOT NULL DEFAULT '',
+    request_id  text NOT NULL DEFAULT '',
+    source      varchar(16) NOT NULL,
+    changed_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_person_history_person_id ON person_history (person_id, changed_at);
+
+CREATE OR REPLACE FUNCTION person_history_append_only() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'person_history is append-only';
+END
+$$;
+
+DROP TRIGGER IF EXISTS person_history_append_only ON person_history;
+CREATE TRIGGER person_history_append_only
+    BEFORE UPDATE OR DELETE ON person_history
+    FOR EACH ROW EXECUTE FUNCTION person_history_append_only();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_people_merged_into;
+ALTER TABLE people DROP COLUMN IF EXISTS merged_into;
@@ -0,0 +1,6 @@
+-- merged_into points a person merged into another one at the survivor, so that
+-- its id keeps resolving. Merged people stay soft-deleted and out of the trash.
+ALTER TABLE people ADD COLUMN IF NOT EXISTS merged_into uuid;
+
+CREATE INDEX IF NOT EXISTS idx_people_merged_into
+    ON people (merged_into) WHERE merged_into IS NOT NULL;
@@ -0,0 +1,13 @@
+-- Requests made with an Idempotency-Key header and their responses, replayed when
+-- the request is retried. status_code is 0 while the first request is in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key          text PRIMARY KEY,
+    fingerprint  text NOT NULL,
+    status_code  integer NOT NULL DEFAULT 0,
+    header       jsonb,
+    body         bytea,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,57 @@
+package models
+
+import "person-enricher/internal/validation"
+
+// BatchMode — how POST /people:batch treats failed items
+type BatchMode string
+
+const (
+	// BatchAtomic creates either all items or none of them
+	BatchAtomic BatchMode = "atomic"
+	// BatchPartial creates every item that can be created
+	BatchPartial BatchMode = "partial"
+)
+
+// BatchStatus — outcome of one item of a batch
+type BatchStatus string
+
+const (
+	BatchCreated BatchStatus = "created"
+	BatchFailed  BatchStatus = "failed"
+	// BatchSkipped — the item is valid, but was not created because another item
+	// of an atomic batch failed
+	BatchSkipped BatchStatus = "skipped"
+)
+
+// CreatePeopleRequest — body of POST /people:batch
+type CreatePeopleRequest struct {
+	Mode  BatchMode             `json:"mode,omitempty"`
+	Items []CreatePersonRequest `json:"items"`
+}
+
+// BatchItem — outcome of one item of a batch, in the order of the request
+type BatchItem struct {
+	Status BatchStatus
+	Person Person
+	Err    error
+}
+
+// BatchItemResponse — one element of the items array returned by POST /people:batch
+type BatchItemResponse struct {
+	Index  int             `json:"index"`
+	Status BatchStatus     `json:"status"`
+	Person *PersonResponse `json:"person,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// Code is the code of the Problem the item would have been answered with on its own
+	Code ErrorCode `json:"code,omitempty"`
+	// Errors lists the invalid fields of an item that does not pass validation
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
+
+// BatchResponse — body returned by POST /people:batch
+type BatchResponse struct {
+	Mode    BatchMode           `json:"mode"`
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+	Items   []BatchItemResponse `json:"items"`
+}
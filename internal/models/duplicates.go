@@ -0,0 +1,31 @@
+package models
+
+// DuplicatePair — two people that are likely the same person
+type DuplicatePair struct {
+	First  Person
+	Second Person
+	// Score is the similarity of the two people, from 0 to 1
+	Score float64
+}
+
+// DuplicatePairResponse — one element of the list returned by GET /people/duplicates
+type DuplicatePairResponse struct {
+	First  PersonResponse `json:"first"`
+	Second PersonResponse `json:"second"`
+	Score  float64        `json:"score"`
+}
+
+// DuplicateResponse — body of the 409 returned by POST /people with check_duplicates
+type DuplicateResponse struct {
+	Problem
+	Duplicates []PersonResponse `json:"duplicates"`
+}
+
+// MergeRequest — body of POST /people/{id}/merge
+type MergeRequest struct {
+	// DuplicateID is the person merged into the one of the path, which survives
+	DuplicateID string `json:"duplicate_id"`
+	// Take lists the fields whose value is taken from the duplicate. Other fields keep
+	// the value of the survivor, unless it is empty.
+	Take []string `json:"take,omitempty"`
+}
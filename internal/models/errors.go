@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"person-enricher/internal/validation"
+	"strings"
+)
+
+// Sentinel errors shared by the repository, service and handlers layers.
+// Lower layers wrap them with context, check them with errors.Is.
+var (
+	// ErrNotFound — the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID — the id is not a valid UUID
+	ErrInvalidID = errors.New("invalid id")
+	// ErrConflict — the change conflicts with the current state of the data
+	ErrConflict = errors.New("conflict")
+	// ErrVersionMismatch — the record was changed since the expected version was read
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrInvalidPatch — the patch document is malformed or cannot be applied
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrValidation — the resulting person does not pass validation
+	ErrValidation = errors.New("validation failed")
+	// ErrMerged — the record was merged into another one
+	ErrMerged = errors.New("merged")
+)
+
+// ValidationError — the request does not pass validation, Message and Fields can
+// be shown to the client. It matches ErrValidation with errors.Is.
+type ValidationError struct {
+	Message string
+	// Fields lists the invalid fields, if the error is about fields
+	Fields []validation.FieldError
+}
+
+// Error returns Message, or the messages of the fields if it is empty.
+func (e *ValidationError) Error() string {
+	if e.Message != "" || len(e.Fields) == 0 {
+		return e.Message
+	}
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// newValidationError returns a *ValidationError with the field errors, nil if there are none.
+func newValidationError(fields []validation.FieldError) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// Is reports whether target is ErrValidation
+func (e *ValidationError) Is(target error) bool { return target == ErrValidation }
+
+// MergedError — the person was merged into the person with id Into.
+// It matches ErrMerged with errors.Is.
+type MergedError struct {
+	Into string
+}
+
+func (e *MergedError) Error() string { return "merged into " + e.Into }
+
+// Is reports whether target is ErrMerged
+func (e *MergedError) Is(target error) bool { return target == ErrMerged }
+
+// DuplicateError — the person to create looks like the existing People.
+// It matches ErrConflict with errors.Is.
+type DuplicateError struct {
+	People []Person
+}
+
+func (e *DuplicateError) Error() string { return fmt.Sprintf("%d possible duplicates", len(e.People)) }
+
+// Is reports whether target is ErrConflict
+func (e *DuplicateError) Is(target error) bool { return target == ErrConflict }
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Operations recorded in the person history
+const (
+	OperationCreate  = "create"
+	OperationUpdate  = "update"
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+	OperationPurge   = "purge"
+	OperationMerge   = "merge"
+)
+
+// FieldChange — old and new value of one field of a person
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+	// Source is "enrichment" for a value filled in by the enrichment APIs, empty when
+	// the value comes from the source of the change
+	Source string `json:"source,omitempty"`
+}
+
+// PersonChange — one entry of the append-only person history.
+// Before is nil for a create or restore, After is nil for a delete or purge.
+type PersonChange struct {
+	ID        int64                  `gorm:"primaryKey" json:"id"`
+	PersonID  string                 `gorm:"type:uuid;not null" json:"person_id"`
+	Version   int64                  `json:"version"`
+	Operation string                 `json:"operation"`
+	Before    *Person                `gorm:"type:jsonb;serializer:json" json:"before"`
+	After     *Person                `gorm:"type:jsonb;serializer:json" json:"after"`
+	Diff      map[string]FieldChange `gorm:"type:jsonb;serializer:json" json:"diff"`
+	Actor     string                 `json:"actor,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Source    string                 `json:"source"`
+	ChangedAt time.Time              `json:"changed_at"`
+}
+
+// TableName stores the history in person_history
+func (PersonChange) TableName() string { return "person_history" }
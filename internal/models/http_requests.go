@@ -1,6 +1,7 @@
 package models
 
 import (
+	"person-enricher/internal/validation"
 	"time"
 
 	"gorm.io/gorm"
@@ -18,44 +19,97 @@ type Person struct {
 	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	// Version is incremented by every update, it is the ETag of the person
+	Version int64 `gorm:"not null;default:1" json:"version"`
+	// MergedInto is the id of the person this one was merged into
+	MergedInto *string `gorm:"type:uuid" json:"merged_into,omitempty"`
+	// Score is the similarity to the search term, only set by fuzzy search and duplicate checks
+	Score float64 `gorm:"->;-:migration" json:"score,omitempty"`
 }
 
 // PersonResponse - structure for GET /people{id}, POST /people, PUT /people{id}
 type PersonResponse struct {
-    ID          string `json:"id"`
-    Name        string `json:"name"`
-    Surname     string `json:"surname"`
-    Patronymic  string `json:"patronymic,omitempty"`
-    Age         int    `json:"age,omitempty"`
-    Gender      string `json:"gender,omitempty"`
-    Nationality string `json:"nationality,omitempty"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Surname     string     `json:"surname"`
+	Patronymic  string     `json:"patronymic,omitempty"`
+	Age         int        `json:"age,omitempty"`
+	Gender      string     `json:"gender,omitempty"`
+	Nationality string     `json:"nationality,omitempty"`
+	Version     int64      `json:"version"`
+	Score       float64    `json:"score,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
 // CreatePersonRequest — body of POST /people
 type CreatePersonRequest struct {
-	Name       string `json:"name"`
-	Surname    string `json:"surname"`
-	Patronymic string `json:"patronymic,omitempty"`
+	Name       string `json:"name" validate:"required,max=100,name"`
+	Surname    string `json:"surname" validate:"required,max=100,name"`
+	Patronymic string `json:"patronymic,omitempty" validate:"max=100,name"`
 }
 
-// UpdatePersonRequest — body of PUT /people/{id}
+// Validate checks the fields of a new person against their validate tags. It is
+// shared by POST /people, POST /people:batch and the import, so that all of them
+// accept the same people. It returns a *ValidationError listing every invalid field.
+func (r CreatePersonRequest) Validate() error {
+	return newValidationError(validation.Struct(r))
+}
+
+// UpdatePersonRequest — body of PUT /people/{id}, also the document PATCH /people/{id} applies to
 type UpdatePersonRequest struct {
-	Name        string `json:"name"`
-	Surname     string `json:"surname"`
-	Patronymic  string `json:"patronymic,omitempty"`
-	Age         int    `json:"age"`
-	Gender      string `json:"gender"`
-	Nationality string `json:"nationality"`
+	Name        string `json:"name" validate:"required,max=100,name"`
+	Surname     string `json:"surname" validate:"required,max=100,name"`
+	Patronymic  string `json:"patronymic,omitempty" validate:"max=100,name"`
+	Age         int    `json:"age" validate:"required,min=1,max=150"`
+	Gender      string `json:"gender" validate:"required,oneof=male female other"`
+	Nationality string `json:"nationality" validate:"required,iso3166"`
 }
 
+// Validate checks the fields of a person after an update, by PUT or PATCH, against
+// their validate tags. It returns a *ValidationError listing every invalid field.
+func (r UpdatePersonRequest) Validate() error {
+	return newValidationError(validation.Struct(r))
+}
+
+// PatchType — media type of a PATCH /people/{id} body
+type PatchType string
+
+const (
+	// MergePatch is an RFC 7396 JSON Merge Patch, null removes a field
+	MergePatch PatchType = "application/merge-patch+json"
+	// JSONPatch is an RFC 6902 JSON Patch, a list of operations
+	JSONPatch PatchType = "application/json-patch+json"
+)
+
 // PeopleFilter — parameters for GET /people?page=&size=
 type PeopleFilter struct {
 	Filter string
-	Page   int
-	Size   int
+	// Fuzzy switches Filter from substring matching to trigram similarity search,
+	// ranking the results by score.
+	Fuzzy bool
+	Page  int
+	Size  int
+	// EstimateTotal allows the total to be taken from Postgres statistics
+	// instead of an exact count(*) when no filter is set.
+	EstimateTotal bool
+}
+
+// PeoplePage — one page of people together with the pagination totals
+type PeoplePage struct {
+	People         []Person
+	Page           int
+	Size           int
+	Total          int64
+	TotalEstimated bool
+	HasNext        bool
 }
 
-// ErrorResponse — single JSON error response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// PeoplePageResponse — envelope returned by GET /people for the v2 media type
+type PeoplePageResponse struct {
+	Items          []PersonResponse `json:"items"`
+	Page           int              `json:"page"`
+	Size           int              `json:"size"`
+	Total          int64            `json:"total"`
+	TotalEstimated bool             `json:"total_estimated,omitempty"`
+	HasNext        bool             `json:"has_next"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord — a request made with an Idempotency-Key header and, once it
+// completed, its response. StatusCode is 0 while the request is in flight.
+type IdempotencyRecord struct {
+	Key string `gorm:"primaryKey"`
+	// Fingerprint identifies the request, a retry must have the same
+	Fingerprint string
+	StatusCode  int
+	Header      http.Header `gorm:"type:jsonb;serializer:json"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// TableName stores the records in idempotency_keys
+func (IdempotencyRecord) TableName() string { return "idempotency_keys" }
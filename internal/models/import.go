@@ -0,0 +1,18 @@
+package models
+
+// ImportReject — a line of an import file that was not imported
+type ImportReject struct {
+	Line   int    `json:"line"`
+	Error  string `json:"error"`
+	Record string `json:"record,omitempty"`
+}
+
+// ImportResult — outcome of an import, returned by POST /people:import and stored
+// as the checkpoint of the import subcommand
+type ImportResult struct {
+	// LastLine is the last line of the file that was processed
+	LastLine int            `json:"last_line"`
+	Created  int            `json:"created"`
+	Rejected int            `json:"rejected"`
+	Rejects  []ImportReject `json:"rejects,omitempty"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"log/slog"
+	"person-enricher/internal/logging"
+)
+
+// The LogValue methods below keep personal data out of the logs: names, surnames,
+// patronymics and search terms are logged as hashes by logging.PII.
+
+// LogValue implements slog.LogValuer.
+func (p Person) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", p.ID),
+		slog.String("name", logging.PII(p.Name)),
+		slog.String("surname", logging.PII(p.Surname)),
+		slog.String("patronymic", logging.PII(p.Patronymic)),
+		slog.Int("age", p.Age),
+		slog.String("gender", p.Gender),
+		slog.String("nationality", p.Nationality),
+		slog.Int64("version", p.Version),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (p PersonResponse) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", p.ID),
+		slog.String("name", logging.PII(p.Name)),
+		slog.String("surname", logging.PII(p.Surname)),
+		slog.String("patronymic", logging.PII(p.Patronymic)),
+		slog.Int("age", p.Age),
+		slog.String("gender", p.Gender),
+		slog.String("nationality", p.Nationality),
+		slog.Int64("version", p.Version),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (r CreatePersonRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", logging.PII(r.Name)),
+		slog.String("surname", logging.PII(r.Surname)),
+		slog.String("patronymic", logging.PII(r.Patronymic)),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (r UpdatePersonRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", logging.PII(r.Name)),
+		slog.String("surname", logging.PII(r.Surname)),
+		slog.String("patronymic", logging.PII(r.Patronymic)),
+		slog.Int("age", r.Age),
+		slog.String("gender", r.Gender),
+		slog.String("nationality", r.Nationality),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (f PeopleFilter) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("filter", logging.PII(f.Filter)),
+		slog.Bool("fuzzy", f.Fuzzy),
+		slog.Int("page", f.Page),
+		slog.Int("size", f.Size),
+		slog.Bool("estimate_total", f.EstimateTotal),
+	)
+}
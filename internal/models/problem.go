@@ -0,0 +1,74 @@
+package models
+
+import "person-enricher/internal/validation"
+
+// ErrorCode — stable, machine-readable code of an error response
+type ErrorCode string
+
+const (
+	// CodeInvalidParameter — a query parameter is malformed
+	CodeInvalidParameter ErrorCode = "invalid_parameter"
+	// CodeInvalidRequest — the request is malformed in another way, e.g. its body cannot be read
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	// CodeInvalidJSON — the body is not valid JSON
+	CodeInvalidJSON ErrorCode = "invalid_json"
+	// CodeValidationFailed — the body does not pass validation, see Problem.Errors
+	CodeValidationFailed ErrorCode = "validation_failed"
+	// CodeInvalidID — the id of the path is missing or is not a UUID
+	CodeInvalidID ErrorCode = "invalid_id"
+	// CodeInvalidPatch — the patch cannot be applied
+	CodeInvalidPatch ErrorCode = "invalid_patch"
+	// CodeInvalidFile — the imported file or its column mapping is invalid
+	CodeInvalidFile ErrorCode = "invalid_file"
+	// CodePersonNotFound — no person has the id of the path
+	CodePersonNotFound ErrorCode = "person_not_found"
+	// CodePersonMerged — the person was merged into the one of the Location header
+	CodePersonMerged ErrorCode = "person_merged"
+	// CodePersonConflict — the person conflicts with an existing record
+	CodePersonConflict ErrorCode = "person_conflict"
+	// CodeDuplicatePerson — the new person looks like existing people, see DuplicateResponse
+	CodeDuplicatePerson ErrorCode = "duplicate_person"
+	// CodePreconditionRequired — the If-Match header is missing
+	CodePreconditionRequired ErrorCode = "precondition_required"
+	// CodeInvalidPrecondition — the If-Match header is malformed
+	CodeInvalidPrecondition ErrorCode = "invalid_precondition"
+	// CodeVersionMismatch — the person was modified since the ETag of If-Match
+	CodeVersionMismatch ErrorCode = "version_mismatch"
+	// CodeUnsupportedMediaType — the Content-Type of the body is not supported
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	// CodePayloadTooLarge — the body is larger than allowed
+	CodePayloadTooLarge ErrorCode = "payload_too_large"
+	// CodeInvalidIdempotencyKey — the Idempotency-Key header is malformed
+	CodeInvalidIdempotencyKey ErrorCode = "invalid_idempotency_key"
+	// CodeIdempotencyKeyReused — the Idempotency-Key was used with a different request
+	CodeIdempotencyKeyReused ErrorCode = "idempotency_key_reused"
+	// CodeIdempotencyKeyInProgress — a request with the Idempotency-Key is still running
+	CodeIdempotencyKeyInProgress ErrorCode = "idempotency_key_in_progress"
+	// CodeUnauthorized — the bearer token is missing or unknown
+	CodeUnauthorized ErrorCode = "unauthorized"
+	// CodeRouteNotFound — no endpoint has the path of the request
+	CodeRouteNotFound ErrorCode = "route_not_found"
+	// CodeMethodNotAllowed — the endpoint does not support the method of the request
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	// CodeImportInterrupted — the import stopped before the end of the file
+	CodeImportInterrupted ErrorCode = "import_interrupted"
+	// CodeInternal — an unexpected error
+	CodeInternal ErrorCode = "internal_error"
+)
+
+// Problem — error response in the RFC 7807 format (application/problem+json)
+type Problem struct {
+	// Type is a URI identifying the problem type, derived from Code
+	Type string `json:"type"`
+	// Title is the short summary of the problem type, the same for every occurrence
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail explains this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request
+	Instance  string    `json:"instance,omitempty"`
+	Code      ErrorCode `json:"code"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Errors lists the invalid fields of a request that does not pass validation
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"person-enricher/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// createBatchSize is the number of people CreateMany inserts with one statement.
+const createBatchSize = 100
+
+// errBatchRolledBack rolls back the transaction of an atomic CreateMany in which
+// some people could not be created.
+var errBatchRolledBack = errors.New("batch rolled back")
+
+// CreateMany adds people to the repository in batches of createBatchSize within one
+// transaction. It returns the created people and the error of every person, both in
+// the order of people; a person that could not be created is left zero and has its
+// error mapped like in Create.
+//
+// A batch that fails is retried person by person, each in its own savepoint, to find
+// the people that can not be created. If atomic is true and any person can not be
+// created, none of them are: the whole transaction is rolled back.
+func (r *GormPersonRepository) CreateMany(ctx context.Context, people []models.Person, atomic bool) ([]models.Person, []error, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.CreateMany: creating people", "count", len(people))
+	created := make([]models.Person, len(people))
+	errs := make([]error, len(people))
+	failed := 0
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(people); start += createBatchSize {
+			end := min(start+createBatchSize, len(people))
+			batch := created[start:end]
+			copy(batch, people[start:end])
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return insertPeople(ctx, tx, batch)
+			})
+			if err == nil {
+				continue
+			}
+
+			slog.WarnContext(ctx, "GormPersonRepository.CreateMany: batch failed, retrying one by one", "error", err)
+			for i := range batch {
+				batch[i] = people[start+i]
+				if err := tx.Transaction(func(tx *gorm.DB) error {
+					return insertPeople(ctx, tx, batch[i:i+1])
+				}); err != nil {
+					batch[i] = models.Person{}
+					errs[start+i] = fmt.Errorf("create person: %w", mapError(err))
+					failed++
+				}
+			}
+		}
+		if atomic && failed > 0 {
+			return errBatchRolledBack
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchRolledBack) {
+		slog.ErrorContext(ctx, "GormPersonRepository.CreateMany: could not create people", "error", err)
+		return nil, nil, fmt.Errorf("create people: %w", mapError(err))
+	}
+	if err != nil {
+		slog.InfoContext(ctx, "GormPersonRepository.CreateMany: people failed, nothing created", "failed", failed)
+		return make([]models.Person, len(people)), errs, nil
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.CreateMany: people created", "created", len(people)-failed, "failed", failed)
+	return created, errs, nil
+}
+
+// insertPeople inserts people and their history entries within tx.
+func insertPeople(ctx context.Context, tx *gorm.DB, people []models.Person) error {
+	if err := tx.Create(&people).Error; err != nil {
+		return err
+	}
+	changes := make([]models.PersonChange, 0, len(people))
+	for i := range people {
+		change, err := newChange(ctx, models.OperationCreate, nil, &people[i])
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+	if err := tx.Create(&changes).Error; err != nil {
+		return fmt.Errorf("record history: %w", err)
+	}
+	return nil
+}
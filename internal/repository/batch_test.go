@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"person-enricher/internal/models"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGormPersonRepository_CreateMany(t *testing.T) {
+	people := []models.Person{
+		{Name: "John", Surname: "Doe"},
+		{Name: "Jane", Surname: "Doe"},
+	}
+	conflict := &pgconn.PgError{Code: pgUniqueViolation}
+
+	tests := []struct {
+		name        string
+		atomic      bool
+		mock        func(sqlmock.Sqlmock)
+		wantIDs     []string
+		wantErrs    []error
+		expectedErr bool
+	}{
+		{
+			name: "success",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 1).AddRow("2", 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "person_history"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectCommit()
+			},
+			wantIDs:  []string{"1", "2"},
+			wantErrs: []error{nil, nil},
+		},
+		{
+			name: "partial batch retried one by one",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).WillReturnError(conflict)
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 1))
+				expectHistory(mock)
+
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).WillReturnError(conflict)
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			wantIDs:  []string{"1", ""},
+			wantErrs: []error{nil, models.ErrConflict},
+		},
+		{
+			name:   "atomic batch rolled back",
+			atomic: true,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).WillReturnError(conflict)
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 1))
+				expectHistory(mock)
+
+				mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "people"`)).WillReturnError(conflict)
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			wantIDs:  []string{"", ""},
+			wantErrs: []error{nil, models.ErrConflict},
+		},
+		{
+			name: "transaction error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(assert.AnError)
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := NewMockDB()
+			repo := NewPersonRepository(db)
+			tt.mock(mock)
+
+			created, errs, err := repo.CreateMany(context.Background(), people, tt.atomic)
+
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				for i := range people {
+					assert.Equal(t, tt.wantIDs[i], created[i].ID)
+					if tt.wantErrs[i] == nil {
+						assert.NoError(t, errs[i])
+					} else {
+						assert.ErrorIs(t, errs[i], tt.wantErrs[i])
+					}
+				}
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
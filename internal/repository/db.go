@@ -1,54 +1,191 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"person-enricher/internal/models"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"person-enricher/internal/logging"
+	"person-enricher/internal/tracing"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
+// DBOptions are the connection settings of NewDB.
+type DBOptions struct {
+	// URL is a postgres:// connection URL. When set, or URLFile is, Host, Port, User,
+	// Name and SSLMode are ignored.
+	URL string
+	// URLFile is a file holding the URL, read again for every new connection.
+	URLFile string
+
+	Host string
+	Port int
+	User string
+	Name string
+	// SSLMode is a libpq sslmode, such as disable or verify-full.
+	SSLMode string
+
+	// Password is the password, unless the URL has one.
+	Password string
+	// PasswordFile is a file holding the password, read again for every new connection.
+	// It takes precedence over Password.
+	PasswordFile string
+
+	// SSLRootCert, SSLCert and SSLKey are the files of the CA certificate and of the client
+	// certificate and key, read again for every new connection. Those set in the URL win.
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	// SlowQuery is the duration from which queries are logged as warnings; 0 for
+	// logging.SlowQueryThreshold.
+	SlowQuery time.Duration
+}
+
+// readSecret returns the content of the file at path, without the trailing newline
+// that editors and secret mounts leave.
+func readSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// connString returns the connection URL of opts without its password, and the password
+// the URL had, if any. The URL is built with net/url, so that spaces and quotes in the
+// values are escaped.
+func (o DBOptions) connString() (connString, password string, err error) {
+	raw := o.URL
+	if o.URLFile != "" {
+		if raw, err = readSecret(o.URLFile); err != nil {
+			return "", "", fmt.Errorf("read database url: %w", err)
+		}
+	}
+
+	var u *url.URL
+	if raw != "" {
+		if u, err = url.Parse(raw); err != nil {
+			// The error holds the URL, password included
+			return "", "", errors.New("parse database url: invalid URL")
+		}
+		if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+			return "", "", fmt.Errorf("parse database url: scheme %q, expected postgres", u.Scheme)
+		}
+		if u.User != nil {
+			password, _ = u.User.Password()
+			u.User = url.User(u.User.Username())
+		}
+	} else {
+		u = &url.URL{
+			Scheme: "postgres",
+			User:   url.User(o.User),
+			Host:   net.JoinHostPort(o.Host, strconv.Itoa(o.Port)),
+			Path:   "/" + o.Name,
+		}
+		if o.SSLMode != "" {
+			u.RawQuery = url.Values{"sslmode": {o.SSLMode}}.Encode()
+		}
+	}
+
+	q := u.Query()
+	for param, path := range map[string]string{"sslrootcert": o.SSLRootCert, "sslcert": o.SSLCert, "sslkey": o.SSLKey} {
+		if path != "" && !q.Has(param) {
+			q.Set(param, path)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), password, nil
+}
+
+// connConfig reads the files of opts and returns the configuration of a new connection.
+func (o DBOptions) connConfig() (*pgx.ConnConfig, error) {
+	connString, password, err := o.connString()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("parse connection settings: %w", err)
+	}
+	switch {
+	case o.PasswordFile != "":
+		if cfg.Password, err = readSecret(o.PasswordFile); err != nil {
+			return nil, fmt.Errorf("read database password: %w", err)
+		}
+	case password != "":
+		cfg.Password = password
+	case o.Password != "":
+		cfg.Password = o.Password
+	}
+	return cfg, nil
+}
+
+// NewConnector returns a connector to the database of opts. Every new connection reads
+// the URL, password and certificate files again, so that rotated credentials are picked
+// up without a restart, while the open connections keep going.
+func NewConnector(opts DBOptions) (*sql.DB, error) {
+	initial, err := opts.connConfig()
+	if err != nil {
+		return nil, err
+	}
+	connector := stdlib.GetConnector(*initial, stdlib.OptionBeforeConnect(
+		func(ctx context.Context, cfg *pgx.ConnConfig) error {
+			fresh, err := opts.connConfig()
+			if err != nil {
+				slog.ErrorContext(ctx, "repository.NewConnector: could not reload credentials", "error", err)
+				return err
+			}
+			*cfg = *fresh
+			return nil
+		},
+	))
+	return sql.OpenDB(connector), nil
+}
+
 // NewDB creates a new GORM database connection with PostgreSQL driver.
 //
-// It takes the database host, port, user, password, database name, and SSL mode as parameters.
-// The connection string is built from these parameters.
-// The logger is set to log mode Info.
+// The connections are opened by NewConnector from opts, so credentials given as files
+// may be rotated while the server runs.
+// Queries are logged to slog.Default() with the context they run with, those taking opts.SlowQuery
+// or longer as warnings (0 for logging.SlowQueryThreshold), see logging.GormLogger,
+// and traced as children of the span of that context, see tracing.GormPlugin.
 // The SQL database is set to have a maximum of 10 idle connections and 100 open connections.
 // The connection lifetime is set to 1 hour.
-// The people table is auto-migrated using the Person struct.
+// The schema is not touched here, it is managed by the migrations package.
 // Returns the *gorm.DB and an error, if any.
-func NewDB(
-	host string,
-	port int,
-	user, password, dbname, sslmode string,
-) (*gorm.DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, sslmode,
-	)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+func NewDB(opts DBOptions) (*gorm.DB, error) {
+	sqlDB, err := NewConnector(opts)
 	if err != nil {
 		return nil, fmt.Errorf("connect postgres: %w", err)
 	}
-
-	sqlDB, err := db.DB()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logging.NewGormLogger(slog.Default()).WithSlowThreshold(opts.SlowQuery),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("get sql.DB: %w", err)
+		sqlDB.Close()
+		return nil, fmt.Errorf("connect postgres: %w", err)
 	}
+	if err := db.Use(tracing.NewGormPlugin()); err != nil {
+		return nil, fmt.Errorf("install tracing plugin: %w", err)
+	}
+
 	// Настройка пула соединений
 	sqlDB.SetMaxIdleConns(10)
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// Auto-migration: creates/updates the people table by struct Person
-	if err := db.AutoMigrate(&models.Person{}); err != nil {
-		return nil, fmt.Errorf("auto migrate: %w", err)
-	}
-
 	return db, nil
 
 }
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+
+	"person-enricher/internal/metrics"
+)
+
+// startKey is the key of the start time of a query among the instance values of a *gorm.DB.
+const startKey = "metrics:start"
+
+// SlowQueryPlugin counts the GORM queries taking a threshold or longer in DBSlowQueries.
+type SlowQueryPlugin struct {
+	m         *metrics.Metrics
+	threshold time.Duration
+}
+
+// NewSlowQueryPlugin returns a SlowQueryPlugin counting into m the queries taking
+// threshold or longer, to be installed with (*gorm.DB).Use.
+func NewSlowQueryPlugin(m *metrics.Metrics, threshold time.Duration) *SlowQueryPlugin {
+	return &SlowQueryPlugin{m: m, threshold: threshold}
+}
+
+// Name implements gorm.Plugin.
+func (p *SlowQueryPlugin) Name() string {
+	return "slow_query_metrics"
+}
+
+// Initialize implements gorm.Plugin: it registers the callbacks timing every operation.
+func (p *SlowQueryPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("*").Register("metrics:before_create", p.start),
+		cb.Create().After("*").Register("metrics:after_create", p.end("create")),
+		cb.Query().Before("*").Register("metrics:before_query", p.start),
+		cb.Query().After("*").Register("metrics:after_query", p.end("query")),
+		cb.Update().Before("*").Register("metrics:before_update", p.start),
+		cb.Update().After("*").Register("metrics:after_update", p.end("update")),
+		cb.Delete().Before("*").Register("metrics:before_delete", p.start),
+		cb.Delete().After("*").Register("metrics:after_delete", p.end("delete")),
+		cb.Row().Before("*").Register("metrics:before_row", p.start),
+		cb.Row().After("*").Register("metrics:after_row", p.end("row")),
+		cb.Raw().Before("*").Register("metrics:before_raw", p.start),
+		cb.Raw().After("*").Register("metrics:after_raw", p.end("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *SlowQueryPlugin) start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func (p *SlowQueryPlugin) end(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		if time.Since(v.(time.Time)) >= p.threshold {
+			p.m.DBSlowQueries.WithLabelValues(op, db.Statement.Table).Inc()
+		}
+	}
+}
+
+// tableRowsQuery estimates the rows of the tables of the current schema from the planner
+// statistics, like EstimateCount; tables never analyzed count 0.
+const tableRowsQuery = `SELECT c.relname AS table_name, GREATEST(c.reltuples, 0)::bigint AS row_count
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p') AND n.nspname = current_schema()`
+
+// tableRowsTimeout bounds the query of a scrape.
+const tableRowsTimeout = 5 * time.Second
+
+// tableRowsCollector exports the estimated number of rows of each table when scraped.
+type tableRowsCollector struct {
+	db   *gorm.DB
+	desc *prometheus.Desc
+}
+
+// NewTableRowsCollector returns a collector of the db_table_rows_estimate gauge by table,
+// with the namespace and constant labels of m. A scrape it cannot query the database for
+// fails with the error.
+func NewTableRowsCollector(db *gorm.DB, m *metrics.Metrics) prometheus.Collector {
+	return &tableRowsCollector{
+		db:   db,
+		desc: m.NewDesc("db_table_rows_estimate", "Estimated number of rows by table, from the planner statistics.", "table"),
+	}
+}
+
+func (c *tableRowsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *tableRowsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), tableRowsTimeout)
+	defer cancel()
+
+	var tables []struct {
+		TableName string
+		RowCount  int64
+	}
+	if err := c.db.WithContext(ctx).Raw(tableRowsQuery).Scan(&tables).Error; err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, fmt.Errorf("estimate table rows: %w", err))
+		return
+	}
+	for _, t := range tables {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(t.RowCount), t.TableName)
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"person-enricher/internal/metrics"
+)
+
+func TestSlowQueryPlugin(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		want      float64
+	}{
+		{"slow", 0, 1},
+		{"fast", time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := metrics.New(prometheus.NewRegistry(), metrics.Options{})
+			assert.NoError(t, err)
+			db, mock := NewMockDB()
+			assert.NoError(t, db.Use(NewSlowQueryPlugin(m, tt.threshold)))
+
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "people" WHERE id = $1`)).
+				WithArgs("1").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+
+			var rows []map[string]interface{}
+			assert.NoError(t, db.Table("people").Where("id = ?", "1").Find(&rows).Error)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			assert.Equal(t, tt.want, testutil.ToFloat64(m.DBSlowQueries.WithLabelValues("query", "people")))
+		})
+	}
+}
+
+func TestTableRowsCollector(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry(), metrics.Options{Namespace: "person_enricher"})
+	assert.NoError(t, err)
+	db, mock := NewMockDB()
+	collector := NewTableRowsCollector(db, m)
+
+	mock.ExpectQuery(regexp.QuoteMeta(tableRowsQuery)).
+		WillReturnRows(sqlmock.NewRows([]string{"table_name", "row_count"}).
+			AddRow("people", 1200).
+			AddRow("person_history", 3400))
+
+	expected := `
+# HELP person_enricher_db_table_rows_estimate Estimated number of rows by table, from the planner statistics.
+# TYPE person_enricher_db_table_rows_estimate gauge
+person_enricher_db_table_rows_estimate{table="people"} 1200
+person_enricher_db_table_rows_estimate{table="person_history"} 3400
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+
+	mock.ExpectQuery(regexp.QuoteMeta(tableRowsQuery)).WillReturnError(errors.New("db error"))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collector)
+	_, err = reg.Gather()
+	assert.ErrorContains(t, err, "estimate table rows")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
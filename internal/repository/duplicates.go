@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"person-enricher/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MergeableFields are the fields of a person a merge can take from the duplicate.
+var MergeableFields = []string{"name", "surname", "patronymic", "age", "gender", "nationality"}
+
+// duplicateScore returns the SQL expression of the similarity of the people a and b,
+// from 0 to 1. Values are normalized by immutable_unaccent, and pg_trgm ignores case
+// and punctuation. Names and surnames weigh 0.4 each, patronymics 0.2: two missing
+// patronymics count as equal, a single missing one as half similar.
+func duplicateScore(a, b string) string {
+	sim := func(column string) string {
+		return fmt.Sprintf("similarity(immutable_unaccent(%[1]s.%[3]s), immutable_unaccent(%[2]s.%[3]s))", a, b, column)
+	}
+	patronymic := func(alias string) string {
+		return fmt.Sprintf("COALESCE(%s.patronymic, '') = ''", alias)
+	}
+	return fmt.Sprintf("(0.4 * %s + 0.4 * %s + 0.2 * CASE WHEN %s AND %s THEN 1 WHEN %s OR %s THEN 0.5 ELSE %s END)",
+		sim("name"), sim("surname"),
+		patronymic(a), patronymic(b), patronymic(a), patronymic(b),
+		sim("patronymic"))
+}
+
+// Candidates are pairs whose surnames are similar by the pg_trgm % operator,
+// which can use the trigram index of migration 0002_fuzzy_search.
+var (
+	pairScore = duplicateScore("a", "b")
+	pairsSQL  = "SELECT a.id AS first_id, b.id AS second_id, " + pairScore + " AS score " +
+		"FROM people a JOIN people b ON a.id < b.id " +
+		"AND immutable_unaccent(a.surname) % immutable_unaccent(b.surname) " +
+		"WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL AND " + pairScore + " >= ? " +
+		"ORDER BY score DESC, a.id, b.id LIMIT ? OFFSET ?"
+	similarScore = duplicateScore("people", "p")
+	similarSQL   = "SELECT people.*, " + similarScore + " AS score " +
+		"FROM people, (SELECT ?::text AS name, ?::text AS surname, ?::text AS patronymic) p " +
+		"WHERE people.deleted_at IS NULL " +
+		"AND immutable_unaccent(people.surname) % immutable_unaccent(p.surname) " +
+		"AND " + similarScore + " >= ? " +
+		"ORDER BY score DESC, people.id LIMIT ?"
+)
+
+// FindDuplicates returns one page of the pairs of people whose similarity is at
+// least threshold, most similar first.
+func (r *GormPersonRepository) FindDuplicates(ctx context.Context, threshold float64, page, size int) ([]models.DuplicatePair, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.FindDuplicates: finding duplicates", "threshold", threshold)
+	var rows []struct {
+		FirstID  string
+		SecondID string
+		Score    float64
+	}
+	db := r.db.WithContext(ctx)
+	if err := db.Raw(pairsSQL, threshold, size, (page-1)*size).Scan(&rows).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.FindDuplicates: could not find duplicates", "error", err)
+		return nil, fmt.Errorf("find duplicates: %w", err)
+	}
+	if len(rows) == 0 {
+		return []models.DuplicatePair{}, nil
+	}
+
+	ids := make([]string, 0, 2*len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.FirstID, row.SecondID)
+	}
+	var people []models.Person
+	if err := db.Where("id IN ?", ids).Find(&people).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.FindDuplicates: could not get people", "error", err)
+		return nil, fmt.Errorf("find duplicates: %w", err)
+	}
+	byID := make(map[string]models.Person, len(people))
+	for _, p := range people {
+		byID[p.ID] = p
+	}
+
+	pairs := make([]models.DuplicatePair, 0, len(rows))
+	for _, row := range rows {
+		first, ok1 := byID[row.FirstID]
+		second, ok2 := byID[row.SecondID]
+		// deleted between the two queries
+		if !ok1 || !ok2 {
+			continue
+		}
+		pairs = append(pairs, models.DuplicatePair{First: first, Second: second, Score: row.Score})
+	}
+	return pairs, nil
+}
+
+// FindSimilar returns up to limit people whose similarity to p is at least threshold,
+// most similar first, with the similarity in Person.Score.
+func (r *GormPersonRepository) FindSimilar(ctx context.Context, p models.Person, threshold float64, limit int) ([]models.Person, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.FindSimilar: finding people similar to a person")
+	var people []models.Person
+	if err := r.db.WithContext(ctx).
+		Raw(similarSQL, p.Name, p.Surname, p.Patronymic, threshold, limit).
+		Scan(&people).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.FindSimilar: could not find similar people", "error", err)
+		return nil, fmt.Errorf("find similar people: %w", err)
+	}
+	return people, nil
+}
+
+// Merge merges the person duplicateID into survivorID and returns the survivor.
+// The fields listed in take, and the fields the survivor has no value for, get the
+// value of the duplicate. If version is not 0, the survivor must be at that version,
+// or ErrVersionMismatch is returned.
+//
+// The duplicate is soft-deleted with merged_into set to the survivor, and so are the
+// people merged into the duplicate before, so that GetByID redirects all of them.
+// Both changes are recorded in the history as merges.
+func (r *GormPersonRepository) Merge(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (models.Person, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.Merge: merging person into another")
+	var merged models.Person
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// lock both in id order, so that concurrent merges can not deadlock
+		var people []models.Person
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", []string{survivorID, duplicateID}).
+			Order("id").
+			Find(&people).Error; err != nil {
+			return err
+		}
+		var survivor, duplicate *models.Person
+		for i := range people {
+			switch people[i].ID {
+			case survivorID:
+				survivor = &people[i]
+			case duplicateID:
+				duplicate = &people[i]
+			}
+		}
+		if survivor == nil || duplicate == nil {
+			return models.ErrNotFound
+		}
+		if version != 0 && survivor.Version != version {
+			return models.ErrVersionMismatch
+		}
+
+		values := editableValues(mergePeople(*survivor, *duplicate, take))
+		values["version"] = gorm.Expr("version + 1")
+		if err := tx.Model(&models.Person{}).Where("id = ?", survivorID).Updates(values).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", survivorID).First(&merged).Error; err != nil {
+			return err
+		}
+		if err := recordChange(ctx, tx, models.OperationMerge, survivor, &merged); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Person{}).Where("id = ?", duplicateID).Updates(map[string]interface{}{
+			"merged_into": survivorID,
+			"deleted_at":  time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Person{}).
+			Where("merged_into = ?", duplicateID).
+			Update("merged_into", survivorID).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.OperationMerge, duplicate, nil)
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Merge: could not merge people", "error", err)
+		return models.Person{}, fmt.Errorf("merge people: %w", mapError(err))
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.Merge: people merged")
+	return merged, nil
+}
+
+// mergePeople returns the survivor with the fields listed in take, and its empty
+// fields, set from the duplicate.
+func mergePeople(survivor, duplicate models.Person, take []string) models.Person {
+	taken := make(map[string]bool, len(take))
+	for _, field := range take {
+		taken[field] = true
+	}
+	pick := func(field, s, d string) string {
+		if taken[field] || s == "" {
+			return d
+		}
+		return s
+	}
+
+	merged := survivor
+	merged.Name = pick("name", survivor.Name, duplicate.Name)
+	merged.Surname = pick("surname", survivor.Surname, duplicate.Surname)
+	merged.Patronymic = pick("patronymic", survivor.Patronymic, duplicate.Patronymic)
+	merged.Gender = pick("gender", survivor.Gender, duplicate.Gender)
+	merged.Nationality = pick("nationality", survivor.Nationality, duplicate.Nationality)
+	if taken["age"] || survivor.Age == 0 {
+		merged.Age = duplicate.Age
+	}
+	return merged
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"person-enricher/internal/models"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePeople(t *testing.T) {
+	survivor := models.Person{ID: "1", Name: "Ivan", Surname: "Ivanov", Age: 30, Version: 2}
+	duplicate := models.Person{ID: "2", Name: "Ivan", Surname: "Ivanoff", Patronymic: "Petrovich", Age: 31, Gender: "male", Nationality: "RU", Version: 1}
+
+	tests := []struct {
+		name string
+		take []string
+		want models.Person
+	}{
+		{
+			name: "empty fields filled",
+			want: models.Person{ID: "1", Name: "Ivan", Surname: "Ivanov", Patronymic: "Petrovich", Age: 30, Gender: "male", Nationality: "RU", Version: 2},
+		},
+		{
+			name: "taken fields",
+			take: []string{"surname", "age"},
+			want: models.Person{ID: "1", Name: "Ivan", Surname: "Ivanoff", Patronymic: "Petrovich", Age: 31, Gender: "male", Nationality: "RU", Version: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mergePeople(survivor, duplicate, tt.take))
+		})
+	}
+}
+
+func TestGormPersonRepository_FindDuplicates(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT a.id AS first_id, b.id AS second_id`)).
+		WithArgs(0.7, 10, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"first_id", "second_id", "score"}).
+			AddRow("1", "2", 0.9).
+			AddRow("1", "3", 0.8))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "people" WHERE id IN ($1,$2,$3,$4) AND "people"."deleted_at" IS NULL`)).
+		WithArgs("1", "2", "1", "3").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow("1", "Ivan").
+			AddRow("2", "Ivan"))
+
+	got, err := repo.FindDuplicates(context.Background(), 0.7, 2, 10)
+
+	// 3 was deleted in between
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DuplicatePair{{
+		First:  models.Person{ID: "1", Name: "Ivan"},
+		Second: models.Person{ID: "2", Name: "Ivan"},
+		Score:  0.9,
+	}}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormPersonRepository_FindSimilar(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT people.*,`)).
+		WithArgs("Ivan", "Ivanov", "", 0.7, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "score"}).AddRow("1", "Ivan", 0.8))
+
+	got, err := repo.FindSimilar(context.Background(), models.Person{Name: "Ivan", Surname: "Ivanov"}, 0.7, 5)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Person{{ID: "1", Name: "Ivan", Score: 0.8}}, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormPersonRepository_Merge(t *testing.T) {
+	const lockBothSQL = `SELECT * FROM "people" WHERE id IN ($1,$2) AND "people"."deleted_at" IS NULL ORDER BY id FOR UPDATE`
+	people := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "surname", "version"}).
+			AddRow("1", "Ivan", "Ivanov", 2).
+			AddRow("2", "Ivan", "Ivanoff", 1)
+	}
+
+	tests := []struct {
+		name      string
+		version   int64
+		mock      func(sqlmock.Sqlmock)
+		wantErr   error
+		expectErr bool
+	}{
+		{
+			name:    "success",
+			version: 2,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(lockBothSQL)).
+					WithArgs("1", "2").
+					WillReturnRows(people())
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "people" SET "age"=$1,"gender"=$2,"name"=$3,"nationality"=$4,"patronymic"=$5,"surname"=$6,"version"=version + 1,"updated_at"=$7 WHERE id = $8`)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "people" WHERE id = $1`)).
+					WithArgs("1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 3))
+				expectHistory(mock)
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "people" SET "deleted_at"=$1,"merged_into"=$2,"updated_at"=$3 WHERE id = $4`)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(`UPDATE "people" SET "merged_into"=$1,"updated_at"=$2 WHERE merged_into = $3`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectHistory(mock)
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "version mismatch",
+			version: 1,
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(lockBothSQL)).
+					WithArgs("1", "2").
+					WillReturnRows(people())
+				mock.ExpectRollback()
+			},
+			wantErr:   models.ErrVersionMismatch,
+			expectErr: true,
+		},
+		{
+			name: "duplicate not found",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(lockBothSQL)).
+					WithArgs("1", "2").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 2))
+				mock.ExpectRollback()
+			},
+			wantErr:   models.ErrNotFound,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := NewMockDB()
+			repo := NewPersonRepository(db)
+			tt.mock(mock)
+
+			got, err := repo.Merge(context.Background(), "1", "2", tt.version, []string{"surname"})
+
+			if tt.expectErr {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), got.Version)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
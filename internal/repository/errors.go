@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"person-enricher/internal/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Postgres error codes translated into sentinel errors.
+const (
+	pgInvalidTextRepresentation = "22P02" // e.g. a malformed uuid
+	pgUniqueViolation           = "23505"
+)
+
+// mapError translates GORM and Postgres errors into the sentinel errors of the
+// models package, keeping the original error text. Other errors are returned as is.
+func mapError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgInvalidTextRepresentation:
+			return fmt.Errorf("%w: %v", models.ErrInvalidID, err)
+		case pgUniqueViolation:
+			return fmt.Errorf("%w: %v", models.ErrConflict, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"person-enricher/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// exportFetchSize is the number of rows Export fetches from the cursor at once.
+const exportFetchSize = 1000
+
+// Export calls fn with every person matching the filter, ordered by id. Paging
+// fields of the filter are ignored. The rows are read from a server-side cursor
+// in a read-only REPEATABLE READ transaction, so they come from one snapshot of
+// the table however long the export takes, and only exportFetchSize of them are
+// held in memory at a time. An error returned by fn stops the export and is
+// returned as is.
+func (r *GormPersonRepository) Export(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error {
+	slog.InfoContext(ctx, "GormPersonRepository.Export: exporting people", "filter", filter)
+	exported := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stmt := applyPeopleFilter(tx.Session(&gorm.Session{DryRun: true}), filter).
+			Order("id").
+			Find(&[]models.Person{}).Statement
+		if _, err := tx.Statement.ConnPool.ExecContext(ctx,
+			"DECLARE people_export NO SCROLL CURSOR FOR "+stmt.SQL.String(), stmt.Vars...,
+		); err != nil {
+			return fmt.Errorf("declare cursor: %w", err)
+		}
+
+		fetch := fmt.Sprintf("FETCH %d FROM people_export", exportFetchSize)
+		for {
+			var people []models.Person
+			if err := tx.Raw(fetch).Scan(&people).Error; err != nil {
+				return fmt.Errorf("fetch people: %w", err)
+			}
+			for _, p := range people {
+				if err := fn(p); err != nil {
+					return err
+				}
+			}
+			exported += len(people)
+			if len(people) < exportFetchSize {
+				break
+			}
+		}
+		return tx.Exec("CLOSE people_export").Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		slog.WarnContext(ctx, "GormPersonRepository.Export: export stopped", "exported", exported, "error", err)
+		return fmt.Errorf("export people: %w", err)
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.Export: people exported", "exported", exported)
+	return nil
+}
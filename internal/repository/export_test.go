@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"person-enricher/internal/models"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGormPersonRepository_Export(t *testing.T) {
+	const (
+		declareSQL = `DECLARE people_export NO SCROLL CURSOR FOR SELECT * FROM "people" WHERE (name ILIKE $1 OR surname ILIKE $2 OR patronymic ILIKE $3) AND "people"."deleted_at" IS NULL ORDER BY id`
+		fetchSQL   = `FETCH 1000 FROM people_export`
+	)
+	filter := models.PeopleFilter{Filter: "doe", Page: 3, Size: 10}
+
+	tests := []struct {
+		name      string
+		mock      func(sqlmock.Sqlmock)
+		fnErr     error
+		want      []string
+		expectErr bool
+	}{
+		{
+			name: "success",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(declareSQL)).
+					WithArgs("%doe%", "%doe%", "%doe%").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(fetchSQL)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "John").AddRow("2", "Jane"))
+				mock.ExpectExec(regexp.QuoteMeta(`CLOSE people_export`)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			want: []string{"1", "2"},
+		},
+		{
+			name: "fetch error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(declareSQL)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(fetchSQL)).
+					WillReturnError(errors.New("db error"))
+				mock.ExpectRollback()
+			},
+			expectErr: true,
+		},
+		{
+			name: "callback error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(declareSQL)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(fetchSQL)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+				mock.ExpectRollback()
+			},
+			fnErr:     errors.New("write error"),
+			want:      []string{"1"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := NewMockDB()
+			repo := NewPersonRepository(db)
+			tt.mock(mock)
+
+			var got []string
+			err := repo.Export(context.Background(), filter, func(p models.Person) error {
+				got = append(got, p.ID)
+				return tt.fnErr
+			})
+
+			if tt.expectErr {
+				assert.Error(t, err)
+				if tt.fnErr != nil {
+					assert.ErrorIs(t, err, tt.fnErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
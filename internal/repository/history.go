@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// History returns one page of the change history of a person, oldest change first.
+// ErrNotFound is returned if there is neither history nor a person with the id.
+func (r *GormPersonRepository) History(ctx context.Context, id string, page, size int) ([]models.PersonChange, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.History: listing history of person")
+	var changes []models.PersonChange
+	if err := r.db.WithContext(ctx).
+		Where("person_id = ?", id).
+		Order("id").
+		Limit(size).
+		Offset((page - 1) * size).
+		Find(&changes).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.History: could not list history", "error", err)
+		return nil, fmt.Errorf("list history: %w", mapError(err))
+	}
+
+	if len(changes) == 0 && page == 1 {
+		// people created before the history was introduced have none
+		var n int64
+		if err := r.db.WithContext(ctx).Unscoped().Model(&models.Person{}).Where("id = ?", id).Count(&n).Error; err != nil {
+			return nil, fmt.Errorf("list history: %w", mapError(err))
+		}
+		if n == 0 {
+			slog.InfoContext(ctx, "GormPersonRepository.History: person not found")
+			return nil, fmt.Errorf("list history: %w", models.ErrNotFound)
+		}
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.History: changes listed", "count", len(changes))
+	return changes, nil
+}
+
+// GetAsOf reconstructs a person as it was at the given time from its history.
+// ErrNotFound is returned if the person did not exist or was deleted at that time.
+func (r *GormPersonRepository) GetAsOf(ctx context.Context, id string, at time.Time) (models.Person, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.GetAsOf: getting person as of", "at", at)
+	var change models.PersonChange
+	if err := r.db.WithContext(ctx).
+		Where("person_id = ? AND changed_at <= ?", id, at).
+		Order("changed_at DESC, id DESC").
+		First(&change).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.GetAsOf: could not get change", "error", err)
+		return models.Person{}, fmt.Errorf("get as of: %w", mapError(err))
+	}
+	if change.After == nil {
+		slog.InfoContext(ctx, "GormPersonRepository.GetAsOf: person did not exist at that time", "operation", change.Operation)
+		return models.Person{}, fmt.Errorf("get as of: %w", models.ErrNotFound)
+	}
+	return *change.After, nil
+}
+
+// newChange builds the history entry for a change of a person from its state before
+// and after the change, with the actor, request id and source stored in ctx. The fields
+// ctx marks as enriched get audit.SourceEnrichment in the diff.
+func newChange(ctx context.Context, op string, before, after *models.Person) (models.PersonChange, error) {
+	diff, err := diffPeople(before, after)
+	if err != nil {
+		return models.PersonChange{}, fmt.Errorf("diff person: %w", err)
+	}
+	current := after
+	if current == nil {
+		current = before
+	}
+	meta := audit.FromContext(ctx)
+	for _, field := range meta.Enriched {
+		if c, ok := diff[field]; ok {
+			c.Source = string(audit.SourceEnrichment)
+			diff[field] = c
+		}
+	}
+	return models.PersonChange{
+		PersonID:  current.ID,
+		Version:   current.Version,
+		Operation: op,
+		Before:    before,
+		After:     after,
+		Diff:      diff,
+		Actor:     meta.Actor,
+		RequestID: meta.RequestID,
+		Source:    string(meta.Source),
+		ChangedAt: time.Now(),
+	}, nil
+}
+
+// recordChange appends the history entry for a change of a person within tx.
+func recordChange(ctx context.Context, tx *gorm.DB, op string, before, after *models.Person) error {
+	change, err := newChange(ctx, op, before, after)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return fmt.Errorf("record history: %w", err)
+	}
+	return nil
+}
+
+// diffPeople returns the fields that differ between two states of a person,
+// by their JSON names. updated_at changes with every write and is left out.
+func diffPeople(before, after *models.Person) (map[string]models.FieldChange, error) {
+	from, err := personFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := personFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]models.FieldChange)
+	for k, v := range from {
+		if k != "updated_at" && !reflect.DeepEqual(v, to[k]) {
+			diff[k] = models.FieldChange{From: v, To: to[k]}
+		}
+	}
+	for k, v := range to {
+		if _, ok := from[k]; !ok && k != "updated_at" {
+			diff[k] = models.FieldChange{From: nil, To: v}
+		}
+	}
+	return diff, nil
+}
+
+// personFields returns the JSON fields of p, none for nil.
+func personFields(p *models.Person) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if p == nil {
+		return fields, nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPeople(t *testing.T) {
+	before := &models.Person{ID: "1", Name: "John", Surname: "Doe", Patronymic: "Smith", Version: 1, UpdatedAt: time.Now()}
+	after := &models.Person{ID: "1", Name: "John", Surname: "Doe", Age: 30, Version: 2, UpdatedAt: time.Now().Add(time.Second)}
+
+	diff, err := diffPeople(before, after)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]models.FieldChange{
+		"patronymic": {From: "Smith", To: nil},
+		"age":        {From: nil, To: float64(30)},
+		"version":    {From: float64(1), To: float64(2)},
+	}, diff)
+
+	created, err := diffPeople(nil, after)
+	require.NoError(t, err)
+	assert.Equal(t, models.FieldChange{From: nil, To: "John"}, created["name"])
+	assert.NotContains(t, created, "updated_at")
+}
+
+func TestNewChange(t *testing.T) {
+	ctx := audit.WithMeta(context.Background(), audit.Meta{Actor: "alice", RequestID: "req-1", Source: audit.SourceAPI})
+	before := &models.Person{ID: "1", Name: "John", Version: 3}
+
+	change, err := newChange(ctx, models.OperationDelete, before, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1", change.PersonID)
+	assert.Equal(t, int64(3), change.Version)
+	assert.Equal(t, "alice", change.Actor)
+	assert.Equal(t, "req-1", change.RequestID)
+	assert.Equal(t, "api", change.Source)
+	assert.Nil(t, change.After)
+
+	// changes without metadata come from background jobs
+	change, err = newChange(context.Background(), models.OperationPurge, before, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "system", change.Source)
+
+	// the values of the enrichment APIs are told apart from those of the request
+	ctx = audit.WithEnriched(ctx, "age", "gender", "nationality")
+	after := &models.Person{ID: "2", Name: "Ivan", Age: 42, Gender: "male", Version: 1}
+	change, err = newChange(ctx, models.OperationCreate, nil, after)
+	require.NoError(t, err)
+	assert.Equal(t, "api", change.Source)
+	assert.Equal(t, models.FieldChange{From: nil, To: float64(42), Source: "enrichment"}, change.Diff["age"])
+	assert.Equal(t, "enrichment", change.Diff["gender"].Source)
+	assert.Empty(t, change.Diff["name"].Source)
+	assert.NotContains(t, change.Diff, "nationality", "an empty value is not in the diff")
+}
+
+func TestGormPersonRepository_History(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+
+	historySQL := regexp.QuoteMeta(`SELECT * FROM "person_history" WHERE person_id = $1 ORDER BY id LIMIT $2`)
+	countSQL := regexp.QuoteMeta(`SELECT count(*) FROM "people" WHERE id = $1`)
+	after, _ := json.Marshal(models.Person{ID: "1", Name: "John", Version: 1})
+
+	t.Run("changes", func(t *testing.T) {
+		mock.ExpectQuery(historySQL).
+			WithArgs("1", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "person_id", "version", "operation", "before", "after", "diff", "source"}).
+				AddRow(1, "1", 1, "create", nil, after, `{"name":{"from":null,"to":"John"}}`, "api"))
+
+		changes, err := repo.History(context.Background(), "1", 1, 10)
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Nil(t, changes[0].Before)
+		assert.Equal(t, "John", changes[0].After.Name)
+		assert.Equal(t, "John", changes[0].Diff["name"].To)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("person without history", func(t *testing.T) {
+		mock.ExpectQuery(historySQL).
+			WithArgs("2", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(countSQL).
+			WithArgs("2").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		changes, err := repo.History(context.Background(), "2", 1, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(historySQL).
+			WithArgs("3", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(countSQL).
+			WithArgs("3").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		_, err := repo.History(context.Background(), "3", 1, 10)
+		assert.ErrorIs(t, err, models.ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGormPersonRepository_GetAsOf(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	asOfSQL := regexp.QuoteMeta(
+		`SELECT * FROM "person_history" WHERE person_id = $1 AND changed_at <= $2 ORDER BY changed_at DESC, id DESC,"person_history"."id" LIMIT $3`,
+	)
+	after, _ := json.Marshal(models.Person{ID: "1", Name: "John", Surname: "Doe", Version: 2})
+	before, _ := json.Marshal(models.Person{ID: "1", Name: "John", Version: 2})
+
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows
+		want    string
+		wantErr error
+	}{
+		{
+			name: "updated before",
+			rows: sqlmock.NewRows([]string{"id", "person_id", "operation", "after"}).AddRow(2, "1", "update", after),
+			want: "Doe",
+		},
+		{
+			name:    "deleted before",
+			rows:    sqlmock.NewRows([]string{"id", "person_id", "operation", "before", "after"}).AddRow(3, "1", "delete", before, nil),
+			wantErr: models.ErrNotFound,
+		},
+		{
+			name:    "created after",
+			rows:    sqlmock.NewRows([]string{"id"}),
+			wantErr: models.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectQuery(asOfSQL).
+				WithArgs("1", at, 1).
+				WillReturnRows(tt.rows)
+
+			got, err := repo.GetAsOf(context.Background(), "1", at)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got.Surname)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"person-enricher/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyLockTimeout is how long a request holds its Idempotency-Key. A retry
+// with the same request after that runs again: the first one is assumed lost,
+// e.g. with the replica that served it.
+const IdempotencyLockTimeout = 5 * time.Minute
+
+// reserveSQL reserves a key unless it is held by a live record. An expired record
+// is replaced, and so is an abandoned in-flight record of the same request.
+const reserveSQL = `INSERT INTO idempotency_keys (key, fingerprint, status_code, created_at, expires_at)
+VALUES (?, ?, 0, now(), now() + ? * interval '1 second')
+ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status_code = 0, header = NULL, body = NULL,
+    created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= now()
+    OR (idempotency_keys.status_code = 0 AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+        AND idempotency_keys.created_at < now() - ? * interval '1 second')
+RETURNING key`
+
+// GormIdempotencyRepository stores the Idempotency-Key records of POST requests.
+type GormIdempotencyRepository struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewIdempotencyRepository returns a GormIdempotencyRepository keeping the
+// responses for ttl.
+func NewIdempotencyRepository(db *gorm.DB, ttl time.Duration) *GormIdempotencyRepository {
+	return &GormIdempotencyRepository{db: db, ttl: ttl}
+}
+
+// Reserve reserves key for the request with the given fingerprint and reports
+// whether it did. If the key is held, it returns the record holding it instead:
+// in flight, completed, or made by another request if the fingerprints differ.
+func (r *GormIdempotencyRepository) Reserve(ctx context.Context, key, fingerprint string) (models.IdempotencyRecord, bool, error) {
+	slog.InfoContext(ctx, "GormIdempotencyRepository.Reserve: reserving idempotency key")
+	db := r.db.WithContext(ctx)
+	// a record released between the insert and the select is reserved on the next try
+	for attempt := 0; attempt < 2; attempt++ {
+		var reserved []string
+		if err := db.Raw(reserveSQL, key, fingerprint, r.ttl.Seconds(), IdempotencyLockTimeout.Seconds()).
+			Scan(&reserved).Error; err != nil {
+			slog.ErrorContext(ctx, "GormIdempotencyRepository.Reserve: could not reserve key", "error", err)
+			return models.IdempotencyRecord{}, false, fmt.Errorf("reserve idempotency key: %w", mapError(err))
+		}
+		if len(reserved) > 0 {
+			slog.InfoContext(ctx, "GormIdempotencyRepository.Reserve: key reserved")
+			return models.IdempotencyRecord{}, true, nil
+		}
+
+		var rec models.IdempotencyRecord
+		err := db.Where("key = ?", key).First(&rec).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "GormIdempotencyRepository.Reserve: could not get record", "error", err)
+			return models.IdempotencyRecord{}, false, fmt.Errorf("reserve idempotency key: %w", mapError(err))
+		}
+		slog.InfoContext(ctx, "GormIdempotencyRepository.Reserve: key held", "status", rec.StatusCode)
+		return rec, false, nil
+	}
+	return models.IdempotencyRecord{}, false, fmt.Errorf("reserve idempotency key: %w", models.ErrConflict)
+}
+
+// Complete stores the response of the request that reserved key.
+func (r *GormIdempotencyRepository) Complete(ctx context.Context, key string, status int, header http.Header, body []byte) error {
+	slog.InfoContext(ctx, "GormIdempotencyRepository.Complete: storing response", "status", status)
+	if err := r.db.WithContext(ctx).
+		Where("key = ? AND status_code = 0", key).
+		Updates(&models.IdempotencyRecord{StatusCode: status, Header: header, Body: body}).Error; err != nil {
+		slog.ErrorContext(ctx, "GormIdempotencyRepository.Complete: could not store response", "error", err)
+		return fmt.Errorf("complete idempotency key: %w", mapError(err))
+	}
+	return nil
+}
+
+// Release frees key reserved by a request that failed, so that a retry runs again.
+func (r *GormIdempotencyRepository) Release(ctx context.Context, key string) error {
+	slog.InfoContext(ctx, "GormIdempotencyRepository.Release: releasing idempotency key")
+	if err := r.db.WithContext(ctx).
+		Where("key = ? AND status_code = 0", key).
+		Delete(&models.IdempotencyRecord{}).Error; err != nil {
+		slog.ErrorContext(ctx, "GormIdempotencyRepository.Release: could not release key", "error", err)
+		return fmt.Errorf("release idempotency key: %w", mapError(err))
+	}
+	return nil
+}
+
+// PurgeExpired removes the records whose TTL has passed and returns how many.
+func (r *GormIdempotencyRepository) PurgeExpired(ctx context.Context) (int64, error) {
+	slog.InfoContext(ctx, "GormIdempotencyRepository.PurgeExpired: purging expired idempotency keys")
+	res := r.db.WithContext(ctx).Where("expires_at <= now()").Delete(&models.IdempotencyRecord{})
+	if res.Error != nil {
+		slog.ErrorContext(ctx, "GormIdempotencyRepository.PurgeExpired: could not purge keys", "error", res.Error)
+		return 0, fmt.Errorf("purge idempotency keys: %w", mapError(res.Error))
+	}
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGormIdempotencyRepository_Reserve(t *testing.T) {
+	const selectSQL = `SELECT * FROM "idempotency_keys" WHERE key = $1 ORDER BY "idempotency_keys"."key" LIMIT $2`
+	ttl := 24 * time.Hour
+	expectReserve := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+			WithArgs("k1", "fp", ttl.Seconds(), IdempotencyLockTimeout.Seconds()).
+			WillReturnRows(rows)
+	}
+
+	tests := []struct {
+		name         string
+		mock         func(sqlmock.Sqlmock)
+		wantReserved bool
+		wantStatus   int
+		expectErr    bool
+	}{
+		{
+			name: "reserved",
+			mock: func(mock sqlmock.Sqlmock) {
+				expectReserve(mock, sqlmock.NewRows([]string{"key"}).AddRow("k1"))
+			},
+			wantReserved: true,
+		},
+		{
+			name: "completed",
+			mock: func(mock sqlmock.Sqlmock) {
+				expectReserve(mock, sqlmock.NewRows([]string{"key"}))
+				mock.ExpectQuery(regexp.QuoteMeta(selectSQL)).
+					WithArgs("k1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"key", "fingerprint", "status_code", "header", "body"}).
+						AddRow("k1", "fp", 201, `{"Etag":["\"1\""]}`, []byte(`{}`)))
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name: "released in between",
+			mock: func(mock sqlmock.Sqlmock) {
+				expectReserve(mock, sqlmock.NewRows([]string{"key"}))
+				mock.ExpectQuery(regexp.QuoteMeta(selectSQL)).
+					WithArgs("k1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"key"}))
+				expectReserve(mock, sqlmock.NewRows([]string{"key"}).AddRow("k1"))
+			},
+			wantReserved: true,
+		},
+		{
+			name: "database error",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+					WillReturnError(errors.New("db error"))
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := NewMockDB()
+			repo := NewIdempotencyRepository(db, ttl)
+			tt.mock(mock)
+
+			rec, reserved, err := repo.Reserve(context.Background(), "k1", "fp")
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantReserved, reserved)
+				assert.Equal(t, tt.wantStatus, rec.StatusCode)
+				if tt.wantStatus != 0 {
+					assert.Equal(t, `"1"`, rec.Header.Get("ETag"))
+				}
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGormIdempotencyRepository_CompleteAndRelease(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewIdempotencyRepository(db, time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "idempotency_keys" SET "status_code"=$1,"header"=$2,"body"=$3 WHERE key = $4 AND status_code = 0`)).
+		WithArgs(201, `{"Etag":["\"1\""]}`, []byte(`{}`), "k1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "idempotency_keys" WHERE key = $1 AND status_code = 0`)).
+		WithArgs("k2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.Complete(context.Background(), "k1", http.StatusCreated, http.Header{"Etag": {`"1"`}}, []byte(`{}`)))
+	assert.NoError(t, repo.Release(context.Background(), "k2"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormIdempotencyRepository_PurgeExpired(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewIdempotencyRepository(db, time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "idempotency_keys" WHERE expires_at <= now()`)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	purged, err := repo.PurgeExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
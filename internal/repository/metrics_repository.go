@@ -10,48 +10,171 @@ import (
 
 type metricsRepository struct {
 	repo PersonRepository
+	m    *metrics.Metrics
 }
 
-func NewMetricsRepository(repo PersonRepository) PersonRepository {
-	return &metricsRepository{repo: repo}
+func NewMetricsRepository(repo PersonRepository, m *metrics.Metrics) PersonRepository {
+	return &metricsRepository{repo: repo, m: m}
 }
 
-func (r *metricsRepository) Create(ctx context.Context, p models.Person) (models.Person, error) {
+func (r *metricsRepository) Create(ctx context.Context, p models.Person) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.RepoMethodDuration.WithLabelValues("Create").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Create"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Create", metrics.Outcome(err)).Inc()
 	}()
 	return r.repo.Create(ctx, p)
 }
 
-func (r *metricsRepository) List(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+func (r *metricsRepository) CreateMany(ctx context.Context, people []models.Person, atomic bool) (_ []models.Person, _ []error, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.RepoMethodDuration.WithLabelValues("List").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("CreateMany"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("CreateMany", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.CreateMany(ctx, people, atomic)
+}
+
+func (r *metricsRepository) List(ctx context.Context, filter models.PeopleFilter) (_ []models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("List"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("List", metrics.Outcome(err)).Inc()
 	}()
 	return r.repo.List(ctx, filter)
 }
 
-func (r *metricsRepository) GetByID(ctx context.Context, id string) (models.Person, error) {
+func (r *metricsRepository) Count(ctx context.Context, filter models.PeopleFilter) (_ int64, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.RepoMethodDuration.WithLabelValues("GetByID").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Count"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Count", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.Count(ctx, filter)
+}
+
+func (r *metricsRepository) Export(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Export"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Export", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.Export(ctx, filter, fn)
+}
+
+func (r *metricsRepository) EstimateCount(ctx context.Context) (_ int64, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("EstimateCount"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("EstimateCount", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.EstimateCount(ctx)
+}
+
+func (r *metricsRepository) GetByID(ctx context.Context, id string) (_ models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("GetByID"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("GetByID", metrics.Outcome(err)).Inc()
 	}()
 	return r.repo.GetByID(ctx, id)
 }
 
-func (r *metricsRepository) Update(ctx context.Context, p models.Person) (models.Person, error) {
+func (r *metricsRepository) Update(ctx context.Context, p models.Person) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.RepoMethodDuration.WithLabelValues("Update").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Update"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Update", metrics.Outcome(err)).Inc()
 	}()
 	return r.repo.Update(ctx, p)
 }
 
-func (r *metricsRepository) Delete(ctx context.Context, id string) error {
+func (r *metricsRepository) Delete(ctx context.Context, id string, version int64) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Delete"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Delete", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.Delete(ctx, id, version)
+}
+
+func (r *metricsRepository) ListDeleted(ctx context.Context, filter models.PeopleFilter) (_ []models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("ListDeleted"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("ListDeleted", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.ListDeleted(ctx, filter)
+}
+
+func (r *metricsRepository) Restore(ctx context.Context, id string) (_ models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Restore"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Restore", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.Restore(ctx, id)
+}
+
+func (r *metricsRepository) Purge(ctx context.Context, id string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Purge"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Purge", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.Purge(ctx, id)
+}
+
+func (r *metricsRepository) PurgeDeletedBefore(ctx context.Context, before time.Time) (_ int64, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("PurgeDeletedBefore"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("PurgeDeletedBefore", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.PurgeDeletedBefore(ctx, before)
+}
+
+func (r *metricsRepository) History(ctx context.Context, id string, page, size int) (_ []models.PersonChange, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("History"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("History", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.History(ctx, id, page, size)
+}
+
+func (r *metricsRepository) GetAsOf(ctx context.Context, id string, at time.Time) (_ models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("GetAsOf"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("GetAsOf", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.GetAsOf(ctx, id, at)
+}
+
+func (r *metricsRepository) FindDuplicates(ctx context.Context, threshold float64, page, size int) (_ []models.DuplicatePair, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("FindDuplicates"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("FindDuplicates", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.FindDuplicates(ctx, threshold, page, size)
+}
+
+func (r *metricsRepository) FindSimilar(ctx context.Context, p models.Person, threshold float64, limit int) (_ []models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("FindSimilar"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("FindSimilar", metrics.Outcome(err)).Inc()
+	}()
+	return r.repo.FindSimilar(ctx, p, threshold, limit)
+}
+
+func (r *metricsRepository) Merge(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.RepoMethodDuration.WithLabelValues("Delete").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, r.m.RepoMethodDuration.WithLabelValues("Merge"), time.Since(start).Seconds())
+		r.m.RepoMethodCalls.WithLabelValues("Merge", metrics.Outcome(err)).Inc()
 	}()
-	return r.repo.Delete(ctx, id)
+	return r.repo.Merge(ctx, survivorID, duplicateID, version, take)
 }
@@ -4,19 +4,34 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"person-enricher/internal/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PersonRepository represents a repository for managing person data.
 type PersonRepository interface {
 	Create(ctx context.Context, p models.Person) (models.Person, error)
+	CreateMany(ctx context.Context, people []models.Person, atomic bool) ([]models.Person, []error, error)
 	List(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error)
+	Count(ctx context.Context, filter models.PeopleFilter) (int64, error)
+	Export(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error
+	EstimateCount(ctx context.Context) (int64, error)
 	GetByID(ctx context.Context, id string) (models.Person, error)
 	Update(ctx context.Context, p models.Person) (models.Person, error)
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, version int64) error
+	ListDeleted(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error)
+	Restore(ctx context.Context, id string) (models.Person, error)
+	Purge(ctx context.Context, id string) error
+	PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error)
+	History(ctx context.Context, id string, page, size int) ([]models.PersonChange, error)
+	GetAsOf(ctx context.Context, id string, at time.Time) (models.Person, error)
+	FindDuplicates(ctx context.Context, threshold float64, page, size int) ([]models.DuplicatePair, error)
+	FindSimilar(ctx context.Context, p models.Person, threshold float64, limit int) ([]models.Person, error)
+	Merge(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (models.Person, error)
 }
 
 type GormPersonRepository struct {
@@ -33,102 +48,333 @@ func NewPersonRepository(db *gorm.DB) PersonRepository {
 // Create adds a new person to the repository.
 // It uses the provided context for request scoping and the person model
 // for the data to be stored. It returns the created person and any error
-// encountered during the operation.
+// encountered during the operation, ErrConflict if the person already exists.
+//
+// Create, Update, Delete, Restore, Purge and PurgeDeletedBefore append an entry to
+// the person history in the same transaction as the change.
 func (r *GormPersonRepository) Create(ctx context.Context, p models.Person) (models.Person, error) {
-	log.Printf("GormPersonRepository.Create: creating person")
-	if err := r.db.WithContext(ctx).Create(&p).Error; err != nil {
-		return models.Person{}, err
+	slog.InfoContext(ctx, "GormPersonRepository.Create: creating person")
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&p).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.OperationCreate, nil, &p)
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Create: could not create person", "error", err)
+		return models.Person{}, fmt.Errorf("create person: %w", mapError(err))
 	}
 	return p, nil
 }
 
-// List retrieves a list of people from the repository based on the provided filter criteria.
-// It uses the given context for request scoping and applies filtering, pagination, and sorting.
-// The filter allows searching by name, surname, and patronymic using a case-insensitive match.
-// Pagination is controlled by the Page and Size fields in the filter, and results are ordered by ID.
-// Returns a slice of Person models if successful, otherwise returns an error.
-func (r *GormPersonRepository) List(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
-	log.Printf("GormPersonRepository.List: listing people")
-	var people []models.Person
-	q := r.db.WithContext(ctx)
+// Fuzzy search compares accent-free values by trigram similarity (pg_trgm).
+// The `%` operator can use the GIN indexes created by migration 0002_fuzzy_search.
+const (
+	fuzzyWhere = "immutable_unaccent(name) % immutable_unaccent(?) OR " +
+		"immutable_unaccent(surname) % immutable_unaccent(?) OR " +
+		"immutable_unaccent(patronymic) % immutable_unaccent(?)"
+	fuzzyScore = "GREATEST(" +
+		"similarity(immutable_unaccent(name), immutable_unaccent(?)), " +
+		"similarity(immutable_unaccent(surname), immutable_unaccent(?)), " +
+		"COALESCE(similarity(immutable_unaccent(patronymic), immutable_unaccent(?)), 0))"
+)
 
-	if f := filter.Filter; f != "" {
+// applyPeopleFilter adds the WHERE clause built from the filter to the query.
+// It is shared by List and Count so that the total always matches the listed rows.
+func applyPeopleFilter(q *gorm.DB, filter models.PeopleFilter) *gorm.DB {
+	f := filter.Filter
+	switch {
+	case f == "":
+	case filter.Fuzzy:
+		q = q.Where(fuzzyWhere, f, f, f)
+	default:
 		like := "%" + f + "%"
 		q = q.Where(
 			"name ILIKE ? OR surname ILIKE ? OR patronymic ILIKE ?",
 			like, like, like,
 		)
 	}
-	log.Printf("GormPersonRepository.List: filter: %v", filter)
+	return q
+}
+
+// List retrieves a list of people from the repository based on the provided filter criteria.
+// It uses the given context for request scoping and applies filtering, pagination, and sorting.
+// The filter allows searching by name, surname, and patronymic using a case-insensitive match.
+// With filter.Fuzzy the search uses trigram similarity instead, and results are ranked by
+// the best similarity score of the three fields, which is returned in Person.Score.
+// Pagination is controlled by the Page and Size fields in the filter, and results are ordered by ID.
+// Returns a slice of Person models if successful, otherwise returns an error.
+func (r *GormPersonRepository) List(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.List: listing people")
+	var people []models.Person
+	q := applyPeopleFilter(r.db.WithContext(ctx), filter)
+	slog.DebugContext(ctx, "GormPersonRepository.List: filter", "filter", filter)
 
 	// pagination
 	offset := (filter.Page - 1) * filter.Size
-	log.Printf("GormPersonRepository.List: offset: %d page: %d, size: %d", offset, filter.Page, filter.Size)
+	slog.DebugContext(ctx, "GormPersonRepository.List: page", "offset", offset, "page", filter.Page, "size", filter.Size)
+
+	// ranking
+	if f := filter.Filter; f != "" && filter.Fuzzy {
+		q = q.Select("people.*, "+fuzzyScore+" AS score", f, f, f).Order("score DESC")
+	}
+
 	if err := q.
 		Limit(filter.Size).
 		Offset(offset).
 		Order("id").
 		Find(&people).Error; err != nil {
-		log.Printf("GormPersonRepository.List: could not list people: %v", err)
+		slog.ErrorContext(ctx, "GormPersonRepository.List: could not list people", "error", err)
 		return nil, fmt.Errorf("list people: %w", err)
 	}
 	return people, nil
 }
 
+// Count returns the exact number of people matching the filter.
+// Page and Size of the filter are ignored.
+func (r *GormPersonRepository) Count(ctx context.Context, filter models.PeopleFilter) (int64, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.Count: counting people")
+	var total int64
+	q := applyPeopleFilter(r.db.WithContext(ctx).Model(&models.Person{}), filter)
+	if err := q.Count(&total).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Count: could not count people", "error", err)
+		return 0, fmt.Errorf("count people: %w", err)
+	}
+	return total, nil
+}
+
+// EstimateCount returns the planner estimate of the number of rows in the people table
+// taken from pg_class.reltuples. It is cheap on huge tables, but it is only as fresh as
+// the last VACUUM/ANALYZE and includes soft-deleted rows.
+// It returns -1 if the table has never been analyzed.
+func (r *GormPersonRepository) EstimateCount(ctx context.Context) (int64, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.EstimateCount: estimating people count")
+	var estimate int64
+	if err := r.db.WithContext(ctx).
+		Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = 'people'::regclass").
+		Scan(&estimate).
+		Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.EstimateCount: could not estimate people count", "error", err)
+		return 0, fmt.Errorf("estimate people count: %w", err)
+	}
+	return estimate, nil
+}
+
 // GetByID retrieves a person from the repository by their unique identifier.
 // It uses the provided context for request scoping and queries the database using the given ID.
 // If the person is found, it returns the person model; otherwise, it returns an error.
-// If the record is not found, it returns ErrNotFound, otherwise it returns a wrapped error.
+// If the record is not found, it returns ErrNotFound, for a malformed id ErrInvalidID,
+// for a person merged into another one a *models.MergedError, otherwise it returns a wrapped error.
 func (r *GormPersonRepository) GetByID(ctx context.Context, id string) (models.Person, error) {
-	log.Printf("GormPersonRepository.GetByID: getting person by id")
+	slog.InfoContext(ctx, "GormPersonRepository.GetByID: getting person by id")
 	var p models.Person
 	err := r.db.WithContext(ctx).
 		First(&p, "id = ?", id).
 		Error
-	log.Printf("GormPersonRepository.GetByID: err: %v", err)
+	slog.DebugContext(ctx, "GormPersonRepository.GetByID: query done", "error", err)
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		log.Printf("GormPersonRepository.GetByID: person not found")
-		return models.Person{}, nil
+		var into string
+		if err := r.db.WithContext(ctx).Unscoped().Model(&models.Person{}).
+			Where("id = ? AND merged_into IS NOT NULL", id).
+			Pluck("merged_into", &into).Error; err == nil && into != "" {
+			slog.InfoContext(ctx, "GormPersonRepository.GetByID: person was merged")
+			return models.Person{}, fmt.Errorf("get by id: %w", &models.MergedError{Into: into})
+		}
+		slog.InfoContext(ctx, "GormPersonRepository.GetByID: person not found")
+		return models.Person{}, fmt.Errorf("get by id: %w", models.ErrNotFound)
 	} else if err != nil {
-		log.Printf("GormPersonRepository.GetByID: could not get person by id: %v", err)
-		return models.Person{}, fmt.Errorf("get by id: %w", err)
+		slog.ErrorContext(ctx, "GormPersonRepository.GetByID: could not get person by id", "error", err)
+		return models.Person{}, fmt.Errorf("get by id: %w", mapError(err))
 	}
-	log.Printf("GormPersonRepository.GetByID: person found")
+	slog.InfoContext(ctx, "GormPersonRepository.GetByID: person found")
 
 	return p, nil
 }
 
+// editableValues returns the editable columns of p. They are written by Update
+// even when they hold zero values, so that an update can clear a field.
+func editableValues(p models.Person) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        p.Name,
+		"surname":     p.Surname,
+		"patronymic":  p.Patronymic,
+		"age":         p.Age,
+		"gender":      p.Gender,
+		"nationality": p.Nationality,
+	}
+}
+
+// lockPerson reads the person matching the query and locks its row until tx ends.
+func lockPerson(tx *gorm.DB, query string, args ...interface{}) (models.Person, error) {
+	var p models.Person
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(query, args...).First(&p).Error
+	return p, err
+}
+
 // Update updates a person by their unique identifier.
 // It uses the provided context for request scoping and the person model
-// for the data to be stored. It returns the updated person and any error
-// encountered during the operation.
+// for the data to be stored. All editable columns are written, empty values included,
+// and the version is incremented. p.Version is the version the caller expects the
+// stored person to have, 0 skips the check.
+// It returns the updated person and any error encountered during the operation,
+// ErrNotFound if there is no person with the id and ErrVersionMismatch if its
+// version differs.
 func (r *GormPersonRepository) Update(ctx context.Context, p models.Person) (models.Person, error) {
-	log.Printf("GormPersonRepository.Update: updating person")
-	if err := r.db.WithContext(ctx).
-		Model(&models.Person{}).
-		Where("id = ?", p.ID).
-		Updates(p).
-		Error; err != nil {
-		log.Printf("GormPersonRepository.Update: could not update person: %v", err)
-		return models.Person{}, fmt.Errorf("update person: %w", err)
+	slog.InfoContext(ctx, "GormPersonRepository.Update: updating person")
+	var updated models.Person
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := lockPerson(tx, "id = ?", p.ID)
+		if err != nil {
+			return err
+		}
+		if p.Version != 0 && before.Version != p.Version {
+			return models.ErrVersionMismatch
+		}
+
+		values := editableValues(p)
+		values["version"] = gorm.Expr("version + 1")
+		if err := tx.Model(&models.Person{}).Where("id = ?", p.ID).Updates(values).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", p.ID).First(&updated).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.OperationUpdate, &before, &updated)
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Update: could not update person", "error", err)
+		return models.Person{}, fmt.Errorf("update person: %w", mapError(err))
 	}
-	log.Printf("GormPersonRepository.Update: person updated")
-	return r.GetByID(ctx, p.ID) // Возвращаем обновлённую запись
+	slog.InfoContext(ctx, "GormPersonRepository.Update: person updated")
+	return updated, nil
 }
 
 // Delete removes a person from the repository by their unique identifier.
 // It uses the provided context for request scoping and deletes the person
-// record from the database using the given ID. If the deletion is successful,
-// it returns nil; otherwise, it returns a wrapped error indicating the failure.
-func (r *GormPersonRepository) Delete(ctx context.Context, id string) error {
-	log.Printf("GormPersonRepository.Delete: deleting person")
-	if err := r.db.WithContext(ctx).
-		Delete(&models.Person{}, "id = ?", id).
-		Error; err != nil {
-			log.Printf("GormPersonRepository.Delete: could not delete person: %v", err)
-		return fmt.Errorf("delete person: %w", err)
+// record from the database using the given ID, if it has the expected version
+// (0 skips the check). If the deletion is successful, it returns nil;
+// ErrNotFound if there is no person with the id; ErrVersionMismatch if its
+// version differs; otherwise, it returns a wrapped error indicating the failure.
+func (r *GormPersonRepository) Delete(ctx context.Context, id string, version int64) error {
+	slog.InfoContext(ctx, "GormPersonRepository.Delete: deleting person")
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := lockPerson(tx, "id = ?", id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && before.Version != version {
+			return models.ErrVersionMismatch
+		}
+
+		if err := tx.Delete(&models.Person{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.OperationDelete, &before, nil)
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Delete: could not delete person", "error", err)
+		return fmt.Errorf("delete person: %w", mapError(err))
 	}
-	log.Printf("GormPersonRepository.Delete: person deleted")
+	slog.InfoContext(ctx, "GormPersonRepository.Delete: person deleted")
 	return nil
 }
+
+// ListDeleted retrieves soft-deleted people (the trash) based on the provided filter criteria.
+// Filtering and pagination work like in List, the most recently deleted people come first.
+// People merged into another one are not in the trash: they are kept to redirect their ids.
+func (r *GormPersonRepository) ListDeleted(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.ListDeleted: listing deleted people")
+	var people []models.Person
+	q := applyPeopleFilter(r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL AND merged_into IS NULL"), filter)
+
+	offset := (filter.Page - 1) * filter.Size
+	slog.DebugContext(ctx, "GormPersonRepository.ListDeleted: page", "offset", offset, "page", filter.Page, "size", filter.Size)
+	if err := q.
+		Limit(filter.Size).
+		Offset(offset).
+		Order("deleted_at DESC, id").
+		Find(&people).Error; err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.ListDeleted: could not list deleted people", "error", err)
+		return nil, fmt.Errorf("list deleted people: %w", err)
+	}
+	return people, nil
+}
+
+// Restore brings a soft-deleted person back by clearing deleted_at.
+// It returns the restored person, or ErrNotFound if there is no deleted person with the id.
+func (r *GormPersonRepository) Restore(ctx context.Context, id string) (models.Person, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.Restore: restoring person")
+	var restored models.Person
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockPerson(tx.Unscoped(), "id = ? AND deleted_at IS NOT NULL AND merged_into IS NULL", id); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Person{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", id).First(&restored).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.OperationRestore, nil, &restored)
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Restore: could not restore person", "error", err)
+		return models.Person{}, fmt.Errorf("restore person: %w", mapError(err))
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.Restore: person restored")
+	return restored, nil
+}
+
+// Purge permanently removes a soft-deleted person.
+// People that are not in the trash are left untouched and ErrNotFound is returned.
+func (r *GormPersonRepository) Purge(ctx context.Context, id string) error {
+	slog.InfoContext(ctx, "GormPersonRepository.Purge: purging person")
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := lockPerson(tx.Unscoped(), "id = ? AND deleted_at IS NOT NULL AND merged_into IS NULL", id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.Person{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.OperationPurge, &before, nil)
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.Purge: could not purge person", "error", err)
+		return fmt.Errorf("purge person: %w", mapError(err))
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.Purge: person purged")
+	return nil
+}
+
+// PurgeDeletedBefore permanently removes all people soft-deleted before the given time.
+// It returns the number of removed rows. People merged into another one are kept.
+func (r *GormPersonRepository) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	slog.InfoContext(ctx, "GormPersonRepository.PurgeDeletedBefore: purging people deleted before", "before", before)
+	var purged []models.Person
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Clauses(clause.Returning{}).
+			Where("deleted_at < ? AND merged_into IS NULL", before).
+			Delete(&purged).Error; err != nil {
+			return err
+		}
+		if len(purged) == 0 {
+			return nil
+		}
+
+		changes := make([]models.PersonChange, 0, len(purged))
+		for i := range purged {
+			change, err := newChange(ctx, models.OperationPurge, &purged[i], nil)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		if err := tx.Create(&changes).Error; err != nil {
+			return fmt.Errorf("record history: %w", err)
+		}
+		return nil
+	}); err != nil {
+		slog.ErrorContext(ctx, "GormPersonRepository.PurgeDeletedBefore: could not purge people", "error", err)
+		return 0, fmt.Errorf("purge deleted people: %w", err)
+	}
+	slog.InfoContext(ctx, "GormPersonRepository.PurgeDeletedBefore: people purged", "count", len(purged))
+	return int64(len(purged)), nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -28,6 +29,21 @@ func NewMockDB() (*gorm.DB, sqlmock.Sqlmock) {
 	return gormDB, mock
 }
 
+// lockSQL and lockDeletedSQL read a person, and a person in the trash, for update.
+const (
+	lockSQL        = `SELECT * FROM "people" WHERE id = $1 AND "people"."deleted_at" IS NULL ORDER BY "people"."id" LIMIT $2 FOR UPDATE`
+	lockDeletedSQL = `SELECT * FROM "people" WHERE id = $1 AND deleted_at IS NOT NULL AND merged_into IS NULL ORDER BY "people"."id" LIMIT $2 FOR UPDATE`
+)
+
+// mergedIntoSQL reads the person a missing person was merged into.
+const mergedIntoSQL = `SELECT "merged_into" FROM "people" WHERE id = $1 AND merged_into IS NOT NULL`
+
+// expectHistory expects the insert of one person history entry.
+func expectHistory(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "person_history"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+}
+
 func TestGormPersonRepository_Create(t *testing.T) {
 	db, mock := NewMockDB()
 	repo := NewPersonRepository(db)
@@ -49,7 +65,8 @@ func TestGormPersonRepository_Create(t *testing.T) {
 				mock.ExpectBegin()
 				mock.ExpectQuery(regexp.QuoteMeta(
 					`INSERT INTO "people"`)).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 1))
+				expectHistory(mock)
 				mock.ExpectCommit()
 			},
 			want: models.Person{
@@ -143,6 +160,38 @@ func TestGormPersonRepository_List(t *testing.T) {
             },
             want: wantPeople,
         },
+        {
+            name: "fuzzy search ranked by score",
+            filter: models.PeopleFilter{
+                Filter: "Ushakof",
+                Fuzzy:  true,
+                Page:   1,
+                Size:   10,
+            },
+            mockSetup: func() {
+                sql := regexp.QuoteMeta(
+                    `SELECT people.*, GREATEST(` +
+                        `similarity(immutable_unaccent(name), immutable_unaccent($1)), ` +
+                        `similarity(immutable_unaccent(surname), immutable_unaccent($2)), ` +
+                        `COALESCE(similarity(immutable_unaccent(patronymic), immutable_unaccent($3)), 0)) AS score ` +
+                        `FROM "people" WHERE ` +
+                        `(immutable_unaccent(name) % immutable_unaccent($4) OR ` +
+                        `immutable_unaccent(surname) % immutable_unaccent($5) OR ` +
+                        `immutable_unaccent(patronymic) % immutable_unaccent($6)) ` +
+                        `AND "people"."deleted_at" IS NULL ORDER BY score DESC,id LIMIT $7`,
+                )
+                mock.ExpectQuery(sql).
+                    WithArgs("Ushakof", "Ushakof", "Ushakof", "Ushakof", "Ushakof", "Ushakof", 10).
+                    WillReturnRows(sqlmock.NewRows([]string{
+                        "id", "name", "surname", "created_at", "updated_at", "score",
+                    }).
+                        AddRow("3", "Dmitry", "Ushakov", now, now, 0.6),
+                    )
+            },
+            want: []models.Person{
+                {ID: "3", Name: "Dmitry", Surname: "Ushakov", CreatedAt: now, UpdatedAt: now, Score: 0.6},
+            },
+        },
         {
             name: "database error",
             filter: models.PeopleFilter{
@@ -179,6 +228,75 @@ func TestGormPersonRepository_List(t *testing.T) {
 
 
 
+func TestGormPersonRepository_Count(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+
+	tests := []struct {
+		name      string
+		filter    models.PeopleFilter
+		mockSetup func()
+		want      int64
+		expectErr bool
+	}{
+		{
+			name:   "success with filter",
+			filter: models.PeopleFilter{Filter: "John", Page: 2, Size: 10},
+			mockSetup: func() {
+				sql := regexp.QuoteMeta(
+					`SELECT count(*) FROM "people" WHERE ` +
+						`(name ILIKE $1 OR surname ILIKE $2 OR patronymic ILIKE $3) ` +
+						`AND "people"."deleted_at" IS NULL`,
+				)
+				mock.ExpectQuery(sql).
+					WithArgs("%John%", "%John%", "%John%").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+			},
+			want: 42,
+		},
+		{
+			name:   "database error",
+			filter: models.PeopleFilter{Page: 1, Size: 10},
+			mockSetup: func() {
+				sql := regexp.QuoteMeta(
+					`SELECT count(*) FROM "people" WHERE "people"."deleted_at" IS NULL`,
+				)
+				mock.ExpectQuery(sql).WillReturnError(errors.New("db error"))
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			got, err := repo.Count(context.Background(), tt.filter)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGormPersonRepository_EstimateCount(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+
+	sql := regexp.QuoteMeta(`SELECT reltuples::bigint FROM pg_class WHERE oid = 'people'::regclass`)
+	mock.ExpectQuery(sql).
+		WillReturnRows(sqlmock.NewRows([]string{"reltuples"}).AddRow(1000000))
+
+	got, err := repo.EstimateCount(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000000), got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGormPersonRepository_GetByID(t *testing.T) {
     db, mock := NewMockDB()
     repo := NewPersonRepository(db)
@@ -190,6 +308,7 @@ func TestGormPersonRepository_GetByID(t *testing.T) {
         mockSetup func()
         wantID    string
         expectErr bool
+        wantErr   error
     }{
         {
             name: "success",
@@ -220,8 +339,43 @@ func TestGormPersonRepository_GetByID(t *testing.T) {
                 mock.ExpectQuery(sql).
                     WithArgs("2", 1).
                     WillReturnError(gorm.ErrRecordNotFound)
+                mock.ExpectQuery(regexp.QuoteMeta(mergedIntoSQL)).
+                    WithArgs("2").
+                    WillReturnRows(sqlmock.NewRows([]string{"merged_into"}))
+            },
+            expectErr: true,
+            wantErr:   models.ErrNotFound,
+        },
+        {
+            name: "merged",
+            id:   "4",
+            mockSetup: func() {
+                sql := regexp.QuoteMeta(
+                    `SELECT * FROM "people" WHERE id = $1 AND "people"."deleted_at" IS NULL ORDER BY "people"."id" LIMIT $2`,
+                )
+                mock.ExpectQuery(sql).
+                    WithArgs("4", 1).
+                    WillReturnError(gorm.ErrRecordNotFound)
+                mock.ExpectQuery(regexp.QuoteMeta(mergedIntoSQL)).
+                    WithArgs("4").
+                    WillReturnRows(sqlmock.NewRows([]string{"merged_into"}).AddRow("1"))
+            },
+            expectErr: true,
+            wantErr:   models.ErrMerged,
+        },
+        {
+            name: "malformed id",
+            id:   "not-a-uuid",
+            mockSetup: func() {
+                sql := regexp.QuoteMeta(
+                    `SELECT * FROM "people" WHERE id = $1 AND "people"."deleted_at" IS NULL ORDER BY "people"."id" LIMIT $2`,
+                )
+                mock.ExpectQuery(sql).
+                    WithArgs("not-a-uuid", 1).
+                    WillReturnError(&pgconn.PgError{Code: "22P02", Message: "invalid input syntax for type uuid"})
             },
-            expectErr: false,
+            expectErr: true,
+            wantErr:   models.ErrInvalidID,
         },
         {
             name: "database error",
@@ -245,6 +399,9 @@ func TestGormPersonRepository_GetByID(t *testing.T) {
 
             if tt.expectErr {
                 assert.Error(t, err)
+                if tt.wantErr != nil {
+                    assert.ErrorIs(t, err, tt.wantErr)
+                }
             } else {
                 assert.NoError(t, err)
                 assert.Equal(t, tt.wantID, got.ID)
@@ -262,11 +419,20 @@ func TestGormPersonRepository_Update(t *testing.T) {
     repo := NewPersonRepository(db)
     now := time.Now()
 
+    // all editable columns are written, so that empty values clear them
+    updateSQL := regexp.QuoteMeta(
+        `UPDATE "people" SET "age"=$1,"gender"=$2,"name"=$3,"nationality"=$4,"patronymic"=$5,"surname"=$6,"version"=version + 1,"updated_at"=$7 WHERE id = $8 AND "people"."deleted_at" IS NULL`,
+    )
+    selectSQL := regexp.QuoteMeta(
+        `SELECT * FROM "people" WHERE id = $1 AND "people"."deleted_at" IS NULL ORDER BY "people"."id" LIMIT $2`,
+    )
+
     tests := []struct {
         name      string
         input     models.Person
         mockSetup func()
         expectErr bool
+        wantErr   error
     }{
         {
             name: "success",
@@ -275,28 +441,80 @@ func TestGormPersonRepository_Update(t *testing.T) {
                 Name: "John Updated",
             },
             mockSetup: func() {
-
                 mock.ExpectBegin()
-                mock.ExpectExec(regexp.QuoteMeta(
-                    `UPDATE "people" SET "id"=$1,"name"=$2,"updated_at"=$3 WHERE id = $4 AND "people"."deleted_at" IS NULL`,
-                )).
-                    WithArgs("1", "John Updated", sqlmock.AnyArg(), "1").
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("1", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "name", "version"}).AddRow("1", "John", 1))
+                mock.ExpectExec(updateSQL).
+                    WithArgs(0, "", "John Updated", "", "", "", sqlmock.AnyArg(), "1").
                     WillReturnResult(sqlmock.NewResult(0, 1))
-                mock.ExpectCommit()
-
-                query := regexp.QuoteMeta(
-                    `SELECT * FROM "people" WHERE id = $1 AND "people"."deleted_at" IS NULL ORDER BY "people"."id" LIMIT $2`,
-                )
-                mock.ExpectQuery(query).
+                mock.ExpectQuery(selectSQL).
                     WithArgs("1", 1).
                     WillReturnRows(sqlmock.NewRows([]string{
                         "id", "name", "surname", "patronymic",
                         "age", "gender", "nationality",
-                        "created_at", "updated_at", "deleted_at",
+                        "created_at", "updated_at", "deleted_at", "version",
                     }).
-                        AddRow("1", "John Updated", "", "", 0, "", "", now, now, nil),
+                        AddRow("1", "John Updated", "", "", 0, "", "", now, now, nil, 2),
                     )
+                expectHistory(mock)
+                mock.ExpectCommit()
+            },
+        },
+        {
+            name: "success with expected version",
+            input: models.Person{
+                ID:      "5",
+                Name:    "John Updated",
+                Version: 2,
+            },
+            mockSetup: func() {
+                mock.ExpectBegin()
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("5", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "name", "version"}).AddRow("5", "John", 2))
+                mock.ExpectExec(updateSQL).
+                    WithArgs(0, "", "John Updated", "", "", "", sqlmock.AnyArg(), "5").
+                    WillReturnResult(sqlmock.NewResult(0, 1))
+                mock.ExpectQuery(selectSQL).
+                    WithArgs("5", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "name", "version"}).AddRow("5", "John Updated", 3))
+                expectHistory(mock)
+                mock.ExpectCommit()
+            },
+        },
+        {
+            name: "version mismatch",
+            input: models.Person{
+                ID:      "6",
+                Name:    "Stale",
+                Version: 1,
+            },
+            mockSetup: func() {
+                mock.ExpectBegin()
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("6", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "name", "version"}).AddRow("6", "John", 2))
+                mock.ExpectRollback()
             },
+            expectErr: true,
+            wantErr:   models.ErrVersionMismatch,
+        },
+        {
+            name: "not found",
+            input: models.Person{
+                ID:   "4",
+                Name: "Nobody",
+            },
+            mockSetup: func() {
+                mock.ExpectBegin()
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("4", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id"}))
+                mock.ExpectRollback()
+            },
+            expectErr: true,
+            wantErr:   models.ErrNotFound,
         },
         {
             name: "database error",
@@ -306,10 +524,11 @@ func TestGormPersonRepository_Update(t *testing.T) {
             },
             mockSetup: func() {
                 mock.ExpectBegin()
-                mock.ExpectExec(regexp.QuoteMeta(
-                    `UPDATE "people" SET "id"=$1,"name"=$2,"updated_at"=$3 WHERE id = $4 AND "people"."deleted_at" IS NULL`,
-                )).
-                    WithArgs("2", "Invalid", sqlmock.AnyArg(), "2").
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("2", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("2", 1))
+                mock.ExpectExec(updateSQL).
+                    WithArgs(0, "", "Invalid", "", "", "", sqlmock.AnyArg(), "2").
                     WillReturnError(errors.New("db error"))
                 mock.ExpectRollback()
             },
@@ -324,9 +543,13 @@ func TestGormPersonRepository_Update(t *testing.T) {
 
             if tt.expectErr {
                 assert.Error(t, err)
+                if tt.wantErr != nil {
+                    assert.ErrorIs(t, err, tt.wantErr)
+                }
             } else {
                 assert.NoError(t, err)
                 assert.Equal(t, tt.input.Name, result.Name)
+                assert.Greater(t, result.Version, tt.input.Version)
             }
             assert.NoError(t, mock.ExpectationsWereMet())
         })
@@ -338,22 +561,30 @@ func TestGormPersonRepository_Delete(t *testing.T) {
     db, mock := NewMockDB()
     repo := NewPersonRepository(db)
 
+    deleteSQL := regexp.QuoteMeta(
+        `UPDATE "people" SET "deleted_at"=$1 WHERE id = $2 AND "people"."deleted_at" IS NULL`,
+    )
+
     tests := []struct {
         name      string
         id        string
+        version   int64
         mockSetup func()
         expectErr bool
+        wantErr   error
     }{
         {
             name: "success",
             id:   "1",
             mockSetup: func() {
                 mock.ExpectBegin()
-                mock.ExpectExec(regexp.QuoteMeta(
-                    `UPDATE "people" SET "deleted_at"=$1 WHERE id = $2 AND "people"."deleted_at" IS NULL`,
-                )).
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("1", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("1", 1))
+                mock.ExpectExec(deleteSQL).
                     WithArgs(sqlmock.AnyArg(), "1").
                     WillReturnResult(sqlmock.NewResult(0, 1))
+                expectHistory(mock)
                 mock.ExpectCommit()
             },
         },
@@ -362,24 +593,37 @@ func TestGormPersonRepository_Delete(t *testing.T) {
             id:   "2",
             mockSetup: func() {
                 mock.ExpectBegin()
-                mock.ExpectExec(regexp.QuoteMeta(
-                    `UPDATE "people" SET "deleted_at"=$1 WHERE id = $2 AND "people"."deleted_at" IS NULL`,
-                )).
-                    WithArgs(sqlmock.AnyArg(), "2").
-                    WillReturnResult(sqlmock.NewResult(0, 0))
-                mock.ExpectCommit()
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("2", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id"}))
+                mock.ExpectRollback()
+            },
+            expectErr: true,
+            wantErr:   models.ErrNotFound,
+        },
+        {
+            name:    "version mismatch",
+            id:      "4",
+            version: 1,
+            mockSetup: func() {
+                mock.ExpectBegin()
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("4", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("4", 2))
+                mock.ExpectRollback()
             },
-            // при RowsAffected = 0 ошибок не будет
-            expectErr: false,
+            expectErr: true,
+            wantErr:   models.ErrVersionMismatch,
         },
         {
             name: "database error",
             id:   "3",
             mockSetup: func() {
                 mock.ExpectBegin()
-                mock.ExpectExec(regexp.QuoteMeta(
-                    `UPDATE "people" SET "deleted_at"=$1 WHERE id = $2 AND "people"."deleted_at" IS NULL`,
-                )).
+                mock.ExpectQuery(regexp.QuoteMeta(lockSQL)).
+                    WithArgs("3", 1).
+                    WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("3", 1))
+                mock.ExpectExec(deleteSQL).
                     WithArgs(sqlmock.AnyArg(), "3").
                     WillReturnError(errors.New("db error"))
                 mock.ExpectRollback()
@@ -391,10 +635,13 @@ func TestGormPersonRepository_Delete(t *testing.T) {
     for _, tt := range tests {
         t.Run(tt.name, func(t *testing.T) {
             tt.mockSetup()
-            err := repo.Delete(context.Background(), tt.id)
+            err := repo.Delete(context.Background(), tt.id, tt.version)
 
             if tt.expectErr {
                 assert.Error(t, err)
+                if tt.wantErr != nil {
+                    assert.ErrorIs(t, err, tt.wantErr)
+                }
             } else {
                 assert.NoError(t, err)
             }
@@ -403,3 +650,152 @@ func TestGormPersonRepository_Delete(t *testing.T) {
     }
 }
 
+func TestGormPersonRepository_ListDeleted(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT * FROM "people" WHERE deleted_at IS NOT NULL AND merged_into IS NULL ORDER BY deleted_at DESC, id LIMIT $1`,
+	)).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "deleted_at"}).
+			AddRow("1", "John", now))
+
+	got, err := repo.ListDeleted(context.Background(), models.PeopleFilter{Page: 1, Size: 10})
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.True(t, got[0].DeletedAt.Valid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+
+func TestGormPersonRepository_Restore(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+	now := time.Now()
+
+	restoreSQL := regexp.QuoteMeta(
+		`UPDATE "people" SET "deleted_at"=$1,"updated_at"=$2 WHERE id = $3`,
+	)
+
+	tests := []struct {
+		name      string
+		id        string
+		mockSetup func()
+		wantID    string
+		expectErr bool
+		wantErr   error
+	}{
+		{
+			name: "success",
+			id:   "1",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(lockDeletedSQL)).
+					WithArgs("1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow("1", now))
+				mock.ExpectExec(restoreSQL).
+					WithArgs(nil, sqlmock.AnyArg(), "1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(
+					`SELECT * FROM "people" WHERE id = $1 AND "people"."deleted_at" IS NULL ORDER BY "people"."id" LIMIT $2`,
+				)).
+					WithArgs("1", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at", "updated_at"}).
+						AddRow("1", "John", now, now))
+				expectHistory(mock)
+				mock.ExpectCommit()
+			},
+			wantID: "1",
+		},
+		{
+			name: "not in trash",
+			id:   "2",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(lockDeletedSQL)).
+					WithArgs("2", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+			expectErr: true,
+			wantErr:   models.ErrNotFound,
+		},
+		{
+			name: "database error",
+			id:   "3",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(lockDeletedSQL)).
+					WithArgs("3", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow("3", now))
+				mock.ExpectExec(restoreSQL).
+					WithArgs(nil, sqlmock.AnyArg(), "3").
+					WillReturnError(errors.New("db error"))
+				mock.ExpectRollback()
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			got, err := repo.Restore(context.Background(), tt.id)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantID, got.ID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGormPersonRepository_Purge(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(lockDeletedSQL)).
+		WithArgs("1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow("1", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(
+		`DELETE FROM "people" WHERE id = $1`,
+	)).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectHistory(mock)
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.Purge(context.Background(), "1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGormPersonRepository_PurgeDeletedBefore(t *testing.T) {
+	db, mock := NewMockDB()
+	repo := NewPersonRepository(db)
+	before := time.Now().Add(-30 * 24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`DELETE FROM "people" WHERE deleted_at < $1 AND merged_into IS NULL RETURNING *`,
+	)).
+		WithArgs(before).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).
+			AddRow("1", 1).AddRow("2", 3).AddRow("3", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "person_history"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectCommit()
+
+	purged, err := repo.PurgeDeletedBefore(context.Background(), before)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
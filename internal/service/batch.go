@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"person-enricher/internal/audit"
+	"person-enricher/internal/models"
+	"strings"
+	"sync"
+)
+
+// MaxBatchSize is the largest number of people CreatePeople accepts at once.
+const MaxBatchSize = 1000
+
+// enrichWorkers is the number of names CreatePeople enriches concurrently.
+const enrichWorkers = 8
+
+// enrichment is the data the external APIs returned for a name.
+type enrichment struct {
+	age         int
+	gender      string
+	nationality string
+	err         error
+}
+
+// CreatePeople creates people from reqs and returns the outcome of every request in
+// the same order. Each request is validated, every distinct name is enriched once,
+// and the people are saved with one CreateMany call.
+//
+// In BatchAtomic mode either all people are created or none: if any request fails,
+// the others are reported as skipped. In BatchPartial mode every person that can be
+// created is. The error is only returned when the batch itself is invalid or the
+// repository fails as a whole.
+func (s *personService) CreatePeople(ctx context.Context, reqs []models.CreatePersonRequest, mode models.BatchMode) ([]models.BatchItem, error) {
+	slog.InfoContext(ctx, "service.CreatePeople: creating people", "count", len(reqs), "mode", mode)
+	if mode == "" {
+		mode = models.BatchAtomic
+	}
+	if mode != models.BatchAtomic && mode != models.BatchPartial {
+		return nil, &models.ValidationError{Message: "mode must be atomic or partial"}
+	}
+	if len(reqs) == 0 || len(reqs) > MaxBatchSize {
+		return nil, &models.ValidationError{
+			Message: fmt.Sprintf("items must contain from 1 to %d people", MaxBatchSize),
+		}
+	}
+	atomic := mode == models.BatchAtomic
+
+	items := make([]models.BatchItem, len(reqs))
+	names := make(map[string]string)
+	for i, req := range reqs {
+		if err := req.Validate(); err != nil {
+			items[i] = models.BatchItem{Status: models.BatchFailed, Err: err}
+			continue
+		}
+		if _, ok := names[nameKey(req.Name)]; !ok {
+			names[nameKey(req.Name)] = req.Name
+		}
+	}
+	if atomic && skipRest(items) {
+		slog.InfoContext(ctx, "service.CreatePeople: invalid people in atomic batch, nothing created")
+		return items, nil
+	}
+
+	slog.InfoContext(ctx, "service.CreatePeople: enriching distinct names", "count", len(names))
+	enriched := s.enrichNames(ctx, names)
+
+	people := make([]models.Person, 0, len(reqs))
+	index := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		if items[i].Status == models.BatchFailed {
+			continue
+		}
+		e := enriched[nameKey(req.Name)]
+		if e.err != nil {
+			items[i] = models.BatchItem{Status: models.BatchFailed, Err: e.err}
+			continue
+		}
+		people = append(people, models.Person{
+			Name:        req.Name,
+			Surname:     req.Surname,
+			Patronymic:  req.Patronymic,
+			Age:         e.age,
+			Gender:      e.gender,
+			Nationality: e.nationality,
+		})
+		index = append(index, i)
+	}
+	if len(people) == 0 || atomic && skipRest(items) {
+		slog.InfoContext(ctx, "service.CreatePeople: nothing to create")
+		return items, nil
+	}
+
+	slog.InfoContext(ctx, "service.CreatePeople: saving people in repository", "count", len(people))
+	created, errs, err := s.repo.CreateMany(audit.WithEnriched(ctx, enrichedFields...), people, atomic)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.CreatePeople: could not create people", "error", err)
+		return nil, fmt.Errorf("could not create people: %w", err)
+	}
+	for j, i := range index {
+		if errs[j] != nil {
+			items[i] = models.BatchItem{Status: models.BatchFailed, Err: fmt.Errorf("could not create person: %w", errs[j])}
+			continue
+		}
+		items[i] = models.BatchItem{Status: models.BatchCreated, Person: created[j]}
+	}
+	if atomic {
+		skipRest(items)
+	}
+
+	slog.InfoContext(ctx, "service.CreatePeople: batch processed")
+	return items, nil
+}
+
+// enrichNames enriches every name of names, keyed by nameKey, with at most
+// enrichWorkers requests to the external APIs in flight.
+func (s *personService) enrichNames(ctx context.Context, names map[string]string) map[string]enrichment {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, enrichWorkers)
+		enriched = make(map[string]enrichment, len(names))
+	)
+	for key, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var e enrichment
+			e.age, e.gender, e.nationality, e.err = s.enrich(ctx, name)
+			mu.Lock()
+			enriched[key] = e
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return enriched
+}
+
+// skipRest marks every item that did not fail as skipped if any item failed,
+// and reports whether one did.
+func skipRest(items []models.BatchItem) bool {
+	failed := false
+	for _, item := range items {
+		if item.Status == models.BatchFailed {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+	for i := range items {
+		if items[i].Status != models.BatchFailed {
+			items[i] = models.BatchItem{Status: models.BatchSkipped}
+		}
+	}
+	return true
+}
+
+// nameKey is the key under which names that differ only in case or surrounding
+// spaces are enriched once.
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"person-enricher/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreatePeople(t *testing.T) {
+	john := models.Person{Name: "John", Surname: "Doe", Age: 30, Gender: "male", Nationality: "US"}
+	jane := models.Person{Name: "Jane", Surname: "Doe", Age: 25, Gender: "female", Nationality: "GB"}
+	enrichJohn := func(e *MockEnricher) {
+		e.On("GetPersonAge", mock.Anything, "John").Return(30, nil).Once()
+		e.On("GetPersonGender", mock.Anything, "John").Return("male", nil).Once()
+		e.On("GetPersonNationality", mock.Anything, "John").Return("US", nil).Once()
+	}
+	enrichJane := func(e *MockEnricher) {
+		e.On("GetPersonAge", mock.Anything, "Jane").Return(25, nil).Once()
+		e.On("GetPersonGender", mock.Anything, "Jane").Return("female", nil).Once()
+		e.On("GetPersonNationality", mock.Anything, "Jane").Return("GB", nil).Once()
+	}
+
+	tests := []struct {
+		name        string
+		reqs        []models.CreatePersonRequest
+		mode        models.BatchMode
+		mockSetup   func(*MockEnricher, *MockRepository)
+		want        []models.BatchStatus
+		expectedErr error
+	}{
+		{
+			name: "names enriched once",
+			reqs: []models.CreatePersonRequest{
+				{Name: "John", Surname: "Doe"},
+				{Name: " john ", Surname: "Doe"},
+				{Name: "Jane", Surname: "Doe"},
+			},
+			mode: models.BatchAtomic,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {
+				enrichJohn(e)
+				enrichJane(e)
+				johnAgain := john
+				johnAgain.Name = " john "
+				r.On("CreateMany", mock.Anything, []models.Person{john, johnAgain, jane}, true).
+					Return([]models.Person{{ID: "1"}, {ID: "2"}, {ID: "3"}}, make([]error, 3), nil)
+			},
+			want: []models.BatchStatus{models.BatchCreated, models.BatchCreated, models.BatchCreated},
+		},
+		{
+			name: "invalid item in atomic batch",
+			reqs: []models.CreatePersonRequest{
+				{Name: "John", Surname: "Doe"},
+				{Name: "Jane"},
+			},
+			mode:      models.BatchAtomic,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {},
+			want:      []models.BatchStatus{models.BatchSkipped, models.BatchFailed},
+		},
+		{
+			name: "invalid item in partial batch",
+			reqs: []models.CreatePersonRequest{
+				{Name: "John", Surname: "Doe"},
+				{Name: "Jane"},
+			},
+			mode: models.BatchPartial,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {
+				enrichJohn(e)
+				r.On("CreateMany", mock.Anything, []models.Person{john}, false).
+					Return([]models.Person{{ID: "1"}}, make([]error, 1), nil)
+			},
+			want: []models.BatchStatus{models.BatchCreated, models.BatchFailed},
+		},
+		{
+			name: "enrichment error in partial batch",
+			reqs: []models.CreatePersonRequest{
+				{Name: "John", Surname: "Doe"},
+				{Name: "Jane", Surname: "Doe"},
+			},
+			mode: models.BatchPartial,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {
+				enrichJohn(e)
+				e.On("GetPersonAge", mock.Anything, "Jane").Return(0, errors.New("api error"))
+				r.On("CreateMany", mock.Anything, []models.Person{john}, false).
+					Return([]models.Person{{ID: "1"}}, make([]error, 1), nil)
+			},
+			want: []models.BatchStatus{models.BatchCreated, models.BatchFailed},
+		},
+		{
+			name: "enrichment error in atomic batch",
+			reqs: []models.CreatePersonRequest{
+				{Name: "John", Surname: "Doe"},
+				{Name: "Jane", Surname: "Doe"},
+			},
+			mode: models.BatchAtomic,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {
+				enrichJohn(e)
+				e.On("GetPersonAge", mock.Anything, "Jane").Return(0, errors.New("api error"))
+			},
+			want: []models.BatchStatus{models.BatchSkipped, models.BatchFailed},
+		},
+		{
+			name: "conflict in atomic batch",
+			reqs: []models.CreatePersonRequest{
+				{Name: "John", Surname: "Doe"},
+				{Name: "Jane", Surname: "Doe"},
+			},
+			mode: models.BatchAtomic,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {
+				enrichJohn(e)
+				enrichJane(e)
+				r.On("CreateMany", mock.Anything, []models.Person{john, jane}, true).
+					Return(make([]models.Person, 2), []error{nil, models.ErrConflict}, nil)
+			},
+			want: []models.BatchStatus{models.BatchSkipped, models.BatchFailed},
+		},
+		{
+			name: "repository error",
+			reqs: []models.CreatePersonRequest{{Name: "John", Surname: "Doe"}},
+			mode: models.BatchPartial,
+			mockSetup: func(e *MockEnricher, r *MockRepository) {
+				enrichJohn(e)
+				r.On("CreateMany", mock.Anything, []models.Person{john}, false).
+					Return(nil, nil, errors.New("db error"))
+			},
+			expectedErr: errors.New("could not create people: db error"),
+		},
+		{
+			name:        "unknown mode",
+			reqs:        []models.CreatePersonRequest{{Name: "John", Surname: "Doe"}},
+			mode:        "some",
+			mockSetup:   func(e *MockEnricher, r *MockRepository) {},
+			expectedErr: models.ErrValidation,
+		},
+		{
+			name:        "no items",
+			mode:        models.BatchPartial,
+			mockSetup:   func(e *MockEnricher, r *MockRepository) {},
+			expectedErr: models.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enricher := new(MockEnricher)
+			repo := new(MockRepository)
+			tt.mockSetup(enricher, repo)
+
+			service := NewPersonService(repo, enricher)
+			items, err := service.CreatePeople(context.Background(), tt.reqs, tt.mode)
+
+			if tt.expectedErr != nil {
+				assert.Error(t, err)
+				if errors.Is(tt.expectedErr, models.ErrValidation) {
+					assert.ErrorIs(t, err, models.ErrValidation)
+				} else {
+					assert.EqualError(t, err, tt.expectedErr.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+				statuses := make([]models.BatchStatus, len(items))
+				for i, item := range items {
+					statuses[i] = item.Status
+					assert.Equal(t, item.Status == models.BatchFailed, item.Err != nil)
+				}
+				assert.Equal(t, tt.want, statuses)
+			}
+
+			enricher.AssertExpectations(t)
+			repo.AssertExpectations(t)
+		})
+	}
+}
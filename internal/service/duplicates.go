@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"person-enricher/internal/models"
+	"person-enricher/internal/repository"
+	"slices"
+	"strings"
+)
+
+// DefaultDuplicateThreshold is the similarity from which two people are considered
+// duplicates, unless a threshold is given.
+const DefaultDuplicateThreshold = 0.7
+
+// maxDuplicateMatches is the number of similar people CheckDuplicates reports at most.
+const maxDuplicateMatches = 5
+
+// GetDuplicates returns one page of the pairs of people whose similarity is at least
+// threshold, most similar first.
+func (s *personService) GetDuplicates(ctx context.Context, threshold float64, page, size int) ([]models.DuplicatePair, error) {
+	slog.InfoContext(ctx, "service.GetDuplicates: getting duplicates")
+	pairs, err := s.repo.FindDuplicates(ctx, threshold, page, size)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.GetDuplicates: could not find duplicates", "error", err)
+		return nil, fmt.Errorf("could not find duplicates: %w", err)
+	}
+	slog.InfoContext(ctx, "service.GetDuplicates: pairs found", "count", len(pairs))
+	return pairs, nil
+}
+
+// CheckDuplicates looks for existing people similar to the person to create, before
+// any enrichment is paid for. It returns a *models.DuplicateError with them, which
+// matches models.ErrConflict, if there are any.
+func (s *personService) CheckDuplicates(ctx context.Context, req models.CreatePersonRequest) error {
+	slog.InfoContext(ctx, "service.CheckDuplicates: checking duplicates")
+	similar, err := s.repo.FindSimilar(ctx, models.Person{
+		Name:       strings.TrimSpace(req.Name),
+		Surname:    strings.TrimSpace(req.Surname),
+		Patronymic: strings.TrimSpace(req.Patronymic),
+	}, DefaultDuplicateThreshold, maxDuplicateMatches)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.CheckDuplicates: could not find similar people", "error", err)
+		return fmt.Errorf("could not check duplicates: %w", err)
+	}
+	if len(similar) > 0 {
+		slog.InfoContext(ctx, "service.CheckDuplicates: possible duplicates", "count", len(similar))
+		return &models.DuplicateError{People: similar}
+	}
+	return nil
+}
+
+// MergePeople merges the person duplicateID into survivorID and returns the survivor.
+// The fields listed in take get the value of the duplicate, like the fields the
+// survivor has no value for. If version is not 0, the survivor must be at that version.
+func (s *personService) MergePeople(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (models.Person, error) {
+	slog.InfoContext(ctx, "service.MergePeople: merging people")
+	if strings.TrimSpace(duplicateID) == "" {
+		return models.Person{}, &models.ValidationError{Message: "duplicate_id is required"}
+	}
+	if duplicateID == survivorID {
+		return models.Person{}, &models.ValidationError{Message: "a person can not be merged into itself"}
+	}
+	for _, field := range take {
+		if !slices.Contains(repository.MergeableFields, field) {
+			return models.Person{}, &models.ValidationError{
+				Message: fmt.Sprintf("can not take %q, expected one of %s", field, strings.Join(repository.MergeableFields, ", ")),
+			}
+		}
+	}
+
+	merged, err := s.repo.Merge(ctx, survivorID, duplicateID, version, take)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.MergePeople: could not merge people", "error", err)
+		return models.Person{}, fmt.Errorf("could not merge people: %w", err)
+	}
+	slog.InfoContext(ctx, "service.MergePeople: people merged")
+	return merged, nil
+}
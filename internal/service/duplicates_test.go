@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"person-enricher/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckDuplicates(t *testing.T) {
+	ivan := models.Person{Name: "Ivan", Surname: "Ivanov"}
+	tests := []struct {
+		name      string
+		similar   []models.Person
+		repoErr   error
+		wantErr   error
+		duplicate bool
+	}{
+		{name: "no duplicates", similar: []models.Person{}},
+		{name: "duplicates", similar: []models.Person{{ID: "1", Name: "Ivan", Surname: "Ivanoff", Score: 0.9}}, wantErr: models.ErrConflict, duplicate: true},
+		{name: "repository error", similar: []models.Person{}, repoErr: errors.New("db error"), wantErr: errors.New("could not check duplicates: db error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			repo.On("FindSimilar", mock.Anything, ivan, DefaultDuplicateThreshold, maxDuplicateMatches).
+				Return(tt.similar, tt.repoErr)
+
+			service := NewPersonService(repo, new(MockEnricher))
+			err := service.CheckDuplicates(context.Background(), models.CreatePersonRequest{Name: " Ivan ", Surname: "Ivanov"})
+
+			switch {
+			case tt.wantErr == nil:
+				assert.NoError(t, err)
+			case tt.duplicate:
+				assert.ErrorIs(t, err, tt.wantErr)
+				var derr *models.DuplicateError
+				assert.ErrorAs(t, err, &derr)
+				assert.Equal(t, tt.similar, derr.People)
+			default:
+				assert.EqualError(t, err, tt.wantErr.Error())
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMergePeople(t *testing.T) {
+	tests := []struct {
+		name        string
+		duplicateID string
+		take        []string
+		mockSetup   func(*MockRepository)
+		expectedErr error
+	}{
+		{
+			name:        "success",
+			duplicateID: "2",
+			take:        []string{"surname"},
+			mockSetup: func(r *MockRepository) {
+				r.On("Merge", mock.Anything, "1", "2", int64(3), []string{"surname"}).
+					Return(models.Person{ID: "1", Version: 4}, nil)
+			},
+		},
+		{
+			name:        "no duplicate",
+			mockSetup:   func(r *MockRepository) {},
+			expectedErr: models.ErrValidation,
+		},
+		{
+			name:        "merged into itself",
+			duplicateID: "1",
+			mockSetup:   func(r *MockRepository) {},
+			expectedErr: models.ErrValidation,
+		},
+		{
+			name:        "unknown field",
+			duplicateID: "2",
+			take:        []string{"version"},
+			mockSetup:   func(r *MockRepository) {},
+			expectedErr: models.ErrValidation,
+		},
+		{
+			name:        "repository error",
+			duplicateID: "2",
+			mockSetup: func(r *MockRepository) {
+				r.On("Merge", mock.Anything, "1", "2", int64(3), []string(nil)).
+					Return(models.Person{}, models.ErrVersionMismatch)
+			},
+			expectedErr: models.ErrVersionMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			tt.mockSetup(repo)
+
+			service := NewPersonService(repo, new(MockEnricher))
+			got, err := service.MergePeople(context.Background(), "1", tt.duplicateID, 3, tt.take)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, int64(4), got.Version)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
@@ -11,61 +11,228 @@ import (
 // instrumentedService wraps a PersonService and instruments its methods
 type instrumentedService struct {
 	service PersonService
+	m       *metrics.Metrics
 }
 
 // NewInstrumentedService creates a new instance of instrumentedService,
 // which wraps an existing PersonService and instruments its methods to
-// collect execution metrics such as method duration.
-func NewInstrumentedService(s PersonService) PersonService {
-	return &instrumentedService{service: s}
+// collect execution metrics such as method duration and call outcomes into m.
+func NewInstrumentedService(s PersonService, m *metrics.Metrics) PersonService {
+	return &instrumentedService{service: s, m: m}
 }
 
 // GetPeople instruments the GetPeople method of the underlying PersonService
-// and adds execution time metrics to the ServiceMethodDuration metric.
-func (s *instrumentedService) GetPeople(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetPeople(ctx context.Context, filter models.PeopleFilter) (_ []models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.ServiceMethodDuration.WithLabelValues("GetPeople").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetPeople"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetPeople", metrics.Outcome(err)).Inc()
 	}()
 	return s.service.GetPeople(ctx, filter)
 }
 
+// GetPeoplePage instruments the GetPeoplePage method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetPeoplePage(ctx context.Context, filter models.PeopleFilter) (_ models.PeoplePage, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetPeoplePage"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetPeoplePage", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.GetPeoplePage(ctx, filter)
+}
+
+// ExportPeople instruments the ExportPeople method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) ExportPeople(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("ExportPeople"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("ExportPeople", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.ExportPeople(ctx, filter, fn)
+}
+
 // GetPersonByID instruments the GetPersonByID method of the underlying PersonService
-// and adds execution time metrics to the ServiceMethodDuration metric.
-func (s *instrumentedService) GetPersonByID(ctx context.Context, id string) (models.Person, error) {
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetPersonByID(ctx context.Context, id string) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.ServiceMethodDuration.WithLabelValues("GetPersonByID").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetPersonByID"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetPersonByID", metrics.Outcome(err)).Inc()
 	}()
 	return s.service.GetPersonByID(ctx, id)
 }
 
 // CreatePerson instruments the CreatePerson method of the underlying PersonService
-// and adds execution time metrics to the ServiceMethodDuration metric.
-func (s *instrumentedService) CreatePerson(ctx context.Context, req models.CreatePersonRequest) (models.Person, error) {
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) CreatePerson(ctx context.Context, req models.CreatePersonRequest) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.ServiceMethodDuration.WithLabelValues("CreatePerson").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("CreatePerson"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("CreatePerson", metrics.Outcome(err)).Inc()
 	}()
 	return s.service.CreatePerson(ctx, req)
 }
 
+// CreatePeople instruments the CreatePeople method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) CreatePeople(ctx context.Context, reqs []models.CreatePersonRequest, mode models.BatchMode) (_ []models.BatchItem, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("CreatePeople"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("CreatePeople", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.CreatePeople(ctx, reqs, mode)
+}
+
 // UpdatePerson instruments the UpdatePerson method of the underlying PersonService
-// and adds execution time metrics to the ServiceMethodDuration metric.
-func (s *instrumentedService) UpdatePerson(ctx context.Context, id string, req models.UpdatePersonRequest) (models.Person, error) {
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) UpdatePerson(ctx context.Context, id string, version int64, req models.UpdatePersonRequest) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.ServiceMethodDuration.WithLabelValues("UpdatePerson").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("UpdatePerson"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("UpdatePerson", metrics.Outcome(err)).Inc()
 	}()
-	return s.service.UpdatePerson(ctx, id, req)
+	return s.service.UpdatePerson(ctx, id, version, req)
+}
+
+// PatchPerson instruments the PatchPerson method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) PatchPerson(ctx context.Context, id string, version int64, patchType models.PatchType, patch []byte) (_ models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("PatchPerson"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("PatchPerson", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.PatchPerson(ctx, id, version, patchType, patch)
 }
 
 // DeletePerson instruments the DeletePerson method of the underlying PersonService
-// and adds execution time metrics to the ServiceMethodDuration metric.
-func (s *instrumentedService) DeletePerson(ctx context.Context, id string) error {
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) DeletePerson(ctx context.Context, id string, version int64) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("DeletePerson"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("DeletePerson", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.DeletePerson(ctx, id, version)
+}
+
+// GetDeletedPeople instruments the GetDeletedPeople method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetDeletedPeople(ctx context.Context, filter models.PeopleFilter) (_ []models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetDeletedPeople"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetDeletedPeople", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.GetDeletedPeople(ctx, filter)
+}
+
+// RestorePerson instruments the RestorePerson method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) RestorePerson(ctx context.Context, id string) (_ models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("RestorePerson"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("RestorePerson", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.RestorePerson(ctx, id)
+}
+
+// PurgePerson instruments the PurgePerson method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) PurgePerson(ctx context.Context, id string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("PurgePerson"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("PurgePerson", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.PurgePerson(ctx, id)
+}
+
+// PurgeDeletedBefore instruments the PurgeDeletedBefore method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) PurgeDeletedBefore(ctx context.Context, before time.Time) (_ int64, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("PurgeDeletedBefore"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("PurgeDeletedBefore", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.PurgeDeletedBefore(ctx, before)
+}
+
+// GetPersonHistory instruments the GetPersonHistory method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetPersonHistory(ctx context.Context, id string, page, size int) (_ []models.PersonChange, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetPersonHistory"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetPersonHistory", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.GetPersonHistory(ctx, id, page, size)
+}
+
+// GetPersonAsOf instruments the GetPersonAsOf method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetPersonAsOf(ctx context.Context, id string, at time.Time) (_ models.Person, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetPersonAsOf"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetPersonAsOf", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.GetPersonAsOf(ctx, id, at)
+}
+
+// GetDuplicates instruments the GetDuplicates method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) GetDuplicates(ctx context.Context, threshold float64, page, size int) (_ []models.DuplicatePair, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("GetDuplicates"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("GetDuplicates", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.GetDuplicates(ctx, threshold, page, size)
+}
+
+// CheckDuplicates instruments the CheckDuplicates method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) CheckDuplicates(ctx context.Context, req models.CreatePersonRequest) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("CheckDuplicates"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("CheckDuplicates", metrics.Outcome(err)).Inc()
+	}()
+	return s.service.CheckDuplicates(ctx, req)
+}
+
+// MergePeople instruments the MergePeople method of the underlying PersonService
+// and adds execution time metrics to the ServiceMethodDuration metric
+// and counts the call by outcome in the ServiceMethodCalls metric.
+func (s *instrumentedService) MergePeople(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (_ models.Person, err error) {
 	start := time.Now()
 	defer func() {
-		metrics.ServiceMethodDuration.WithLabelValues("DeletePerson").Observe(time.Since(start).Seconds())
+		metrics.Observe(ctx, s.m.ServiceMethodDuration.WithLabelValues("MergePeople"), time.Since(start).Seconds())
+		s.m.ServiceMethodCalls.WithLabelValues("MergePeople", metrics.Outcome(err)).Inc()
 	}()
-	return s.service.DeletePerson(ctx, id)
+	return s.service.MergePeople(ctx, survivorID, duplicateID, version, take)
 }
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"person-enricher/internal/metrics"
+	"person-enricher/internal/models"
+)
+
+func TestInstrumentedService(t *testing.T) {
+	m, err := metrics.New(prometheus.NewRegistry(), metrics.Options{})
+	assert.NoError(t, err)
+	repo := new(MockRepository)
+	repo.On("GetByID", mock.Anything, "1").Return(models.Person{ID: "1"}, nil)
+	repo.On("GetByID", mock.Anything, "2").Return(models.Person{}, fmt.Errorf("get by id: %w", models.ErrNotFound))
+	svc := NewInstrumentedService(NewPersonService(repo, new(MockEnricher)), m)
+
+	svc.GetPersonByID(context.Background(), "1")
+	svc.GetPersonByID(context.Background(), "2")
+	svc.GetPersonByID(context.Background(), "2")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.ServiceMethodCalls.WithLabelValues("GetPersonByID", metrics.OutcomeOK)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.ServiceMethodCalls.WithLabelValues("GetPersonByID", metrics.OutcomeNotFound)))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.ServiceMethodDuration))
+}
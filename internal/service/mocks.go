@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"person-enricher/internal/models"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -16,11 +17,33 @@ func (m *MockRepository) Create(ctx context.Context, p models.Person) (models.Pe
 	return args.Get(0).(models.Person), args.Error(1)
 }
 
+func (m *MockRepository) CreateMany(ctx context.Context, people []models.Person, atomic bool) ([]models.Person, []error, error) {
+	args := m.Called(ctx, people, atomic)
+	created, _ := args.Get(0).([]models.Person)
+	errs, _ := args.Get(1).([]error)
+	return created, errs, args.Error(2)
+}
+
 func (m *MockRepository) List(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
 	args := m.Called(ctx, filter)
 	return args.Get(0).([]models.Person), args.Error(1)
 }
 
+func (m *MockRepository) Count(ctx context.Context, filter models.PeopleFilter) (int64, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) Export(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error {
+	args := m.Called(ctx, filter, fn)
+	return args.Error(0)
+}
+
+func (m *MockRepository) EstimateCount(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func (m *MockRepository) GetByID(ctx context.Context, id string) (models.Person, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(models.Person), args.Error(1)
@@ -31,11 +54,56 @@ func (m *MockRepository) Update(ctx context.Context, p models.Person) (models.Pe
 	return args.Get(0).(models.Person), args.Error(1)
 }
 
-func (m *MockRepository) Delete(ctx context.Context, id string) error {
+func (m *MockRepository) Delete(ctx context.Context, id string, version int64) error {
+	args := m.Called(ctx, id, version)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListDeleted(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]models.Person), args.Error(1)
+}
+
+func (m *MockRepository) Restore(ctx context.Context, id string) (models.Person, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(models.Person), args.Error(1)
+}
+
+func (m *MockRepository) Purge(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockRepository) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) History(ctx context.Context, id string, page, size int) ([]models.PersonChange, error) {
+	args := m.Called(ctx, id, page, size)
+	return args.Get(0).([]models.PersonChange), args.Error(1)
+}
+
+func (m *MockRepository) GetAsOf(ctx context.Context, id string, at time.Time) (models.Person, error) {
+	args := m.Called(ctx, id, at)
+	return args.Get(0).(models.Person), args.Error(1)
+}
+
+func (m *MockRepository) FindDuplicates(ctx context.Context, threshold float64, page, size int) ([]models.DuplicatePair, error) {
+	args := m.Called(ctx, threshold, page, size)
+	return args.Get(0).([]models.DuplicatePair), args.Error(1)
+}
+
+func (m *MockRepository) FindSimilar(ctx context.Context, p models.Person, threshold float64, limit int) ([]models.Person, error) {
+	args := m.Called(ctx, p, threshold, limit)
+	return args.Get(0).([]models.Person), args.Error(1)
+}
+
+func (m *MockRepository) Merge(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (models.Person, error) {
+	args := m.Called(ctx, survivorID, duplicateID, version, take)
+	return args.Get(0).(models.Person), args.Error(1)
+}
+
 type MockEnricher struct {
 	mock.Mock
 }
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+
+	"person-enricher/internal/models"
+)
+
+// applyPatch applies a merge patch or a JSON patch to the editable fields of p
+// and decodes the result strictly: fields that are not editable are rejected.
+func applyPatch(p models.Person, patchType models.PatchType, patch []byte) (models.UpdatePersonRequest, error) {
+	doc, err := json.Marshal(toUpdateRequest(p))
+	if err != nil {
+		return models.UpdatePersonRequest{}, fmt.Errorf("encode person: %w", err)
+	}
+
+	var patched []byte
+	switch patchType {
+	case models.MergePatch:
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	case models.JSONPatch:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			patched, err = ops.Apply(doc)
+		}
+	default:
+		return models.UpdatePersonRequest{}, fmt.Errorf("%w: unsupported patch type %q", models.ErrInvalidPatch, patchType)
+	}
+	if err != nil {
+		return models.UpdatePersonRequest{}, fmt.Errorf("%w: %v", models.ErrInvalidPatch, err)
+	}
+
+	var req models.UpdatePersonRequest
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return models.UpdatePersonRequest{}, fmt.Errorf("%w: %v", models.ErrInvalidPatch, err)
+	}
+	return req, nil
+}
+
+// toUpdateRequest returns the editable fields of p. Patronymic is omitted when empty,
+// so a merge patch can add it and a JSON patch has to use "add" for it.
+func toUpdateRequest(p models.Person) models.UpdatePersonRequest {
+	return models.UpdatePersonRequest{
+		Name:        p.Name,
+		Surname:     p.Surname,
+		Patronymic:  p.Patronymic,
+		Age:         p.Age,
+		Gender:      p.Gender,
+		Nationality: p.Nationality,
+	}
+}
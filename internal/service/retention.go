@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RetentionJob periodically hard-deletes people that have been in the trash
+// (soft-deleted) for longer than the retention period.
+type RetentionJob struct {
+	service   PersonService
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewRetentionJob creates a RetentionJob that purges people soft-deleted more than
+// retention ago, checking every interval.
+func NewRetentionJob(s PersonService, retention, interval time.Duration) *RetentionJob {
+	return &RetentionJob{
+		service:   s,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges expired people once immediately and then every interval,
+// until the context is canceled.
+func (j *RetentionJob) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "RetentionJob.Run: purging deleted people", "retention", j.retention, "interval", j.interval)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.PurgeOnce(ctx)
+		select {
+		case <-ctx.Done():
+			slog.InfoContext(ctx, "RetentionJob.Run: stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce purges people soft-deleted more than the retention period ago.
+// Errors are logged, the next run will try again.
+func (j *RetentionJob) PurgeOnce(ctx context.Context) {
+	purged, err := j.service.PurgeDeletedBefore(ctx, time.Now().Add(-j.retention))
+	if err != nil {
+		slog.ErrorContext(ctx, "RetentionJob.PurgeOnce: could not purge deleted people", "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "RetentionJob.PurgeOnce: people purged", "purged", purged)
+}
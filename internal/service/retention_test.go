@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRetentionJob_PurgeOnce(t *testing.T) {
+	repo := new(MockRepository)
+	retention := 30 * 24 * time.Hour
+
+	var before time.Time
+	repo.On("PurgeDeletedBefore", mock.Anything, mock.AnythingOfType("time.Time")).
+		Run(func(args mock.Arguments) { before = args.Get(1).(time.Time) }).
+		Return(int64(2), nil)
+
+	job := NewRetentionJob(NewPersonService(repo, new(MockEnricher)), retention, time.Hour)
+	job.PurgeOnce(context.Background())
+
+	assert.WithinDuration(t, time.Now().Add(-retention), before, time.Minute)
+	repo.AssertExpectations(t)
+}
+
+func TestRetentionJob_RunStopsOnCancel(t *testing.T) {
+	repo := new(MockRepository)
+	repo.On("PurgeDeletedBefore", mock.Anything, mock.Anything).Return(int64(0), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	job := NewRetentionJob(NewPersonService(repo, new(MockEnricher)), time.Hour, time.Hour)
+	go func() {
+		job.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after the context was canceled")
+	}
+}
@@ -3,19 +3,34 @@ package service
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"person-enricher/internal/audit"
 	"person-enricher/internal/externalapi"
 	"person-enricher/internal/models"
 	"person-enricher/internal/repository"
+	"time"
 )
 
 // PersonService represents a person service.
 type PersonService interface {
 	CreatePerson(ctx context.Context, req models.CreatePersonRequest) (models.Person, error)
+	CreatePeople(ctx context.Context, reqs []models.CreatePersonRequest, mode models.BatchMode) ([]models.BatchItem, error)
 	GetPeople(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error)
+	GetPeoplePage(ctx context.Context, filter models.PeopleFilter) (models.PeoplePage, error)
+	ExportPeople(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error
 	GetPersonByID(ctx context.Context, id string) (models.Person, error)
-	UpdatePerson(ctx context.Context, id string, req models.UpdatePersonRequest) (models.Person, error)
-	DeletePerson(ctx context.Context, id string) error
+	UpdatePerson(ctx context.Context, id string, version int64, req models.UpdatePersonRequest) (models.Person, error)
+	PatchPerson(ctx context.Context, id string, version int64, patchType models.PatchType, patch []byte) (models.Person, error)
+	DeletePerson(ctx context.Context, id string, version int64) error
+	GetDeletedPeople(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error)
+	RestorePerson(ctx context.Context, id string) (models.Person, error)
+	PurgePerson(ctx context.Context, id string) error
+	PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error)
+	GetPersonHistory(ctx context.Context, id string, page, size int) ([]models.PersonChange, error)
+	GetPersonAsOf(ctx context.Context, id string, at time.Time) (models.Person, error)
+	GetDuplicates(ctx context.Context, threshold float64, page, size int) ([]models.DuplicatePair, error)
+	CheckDuplicates(ctx context.Context, req models.CreatePersonRequest) error
+	MergePeople(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (models.Person, error)
 }
 
 // personService struct represents a person service
@@ -41,25 +56,14 @@ func NewPersonService(
 // attempts to enrich the person data with age, gender, and nationality using
 // the external APIs. It returns the created person and an error, if any.
 func (s *personService) CreatePerson(ctx context.Context, req models.CreatePersonRequest) (models.Person, error) {
-	log.Printf("service.CreatePerson: creating person")
+	slog.InfoContext(ctx, "service.CreatePerson: creating person")
 	// Get person age, gender, nationality
-	age, err := s.enricher.GetPersonAge(ctx, req.Name)
+	age, gender, nationality, err := s.enrich(ctx, req.Name)
 	if err != nil {
-		log.Printf("service.CreatePerson: could not get person age: %v", err)
-		return models.Person{}, fmt.Errorf("could not get person age: %w", err)
-	}
-	gender, err := s.enricher.GetPersonGender(ctx, req.Name)
-	if err != nil {
-		log.Printf("service.CreatePerson: could not get person gender: %v", err)
-		return models.Person{}, fmt.Errorf("could not get person gender: %w", err)
-	}
-	nationality, err := s.enricher.GetPersonNationality(ctx, req.Name)
-	if err != nil {
-		log.Printf("service.CreatePerson: could not get person nationality: %v", err)
-		return models.Person{}, fmt.Errorf("could not get person nationality: %w", err)
+		return models.Person{}, err
 	}
 	// Build a model to save
-	log.Printf("service.CreatePerson: building person model")
+	slog.InfoContext(ctx, "service.CreatePerson: building person model")
 	person := models.Person{
 		Name:        req.Name,
 		Surname:     req.Surname,
@@ -70,55 +74,144 @@ func (s *personService) CreatePerson(ctx context.Context, req models.CreatePerso
 	}
 
 	// Save the person in the repository
-	log.Printf("service.CreatePerson: saving person in repository")
-	createdPerson, err := s.repo.Create(ctx, person)
+	slog.InfoContext(ctx, "service.CreatePerson: saving person in repository")
+	createdPerson, err := s.repo.Create(audit.WithEnriched(ctx, enrichedFields...), person)
 	if err != nil {
-		log.Printf("service.CreatePerson: could not create person: %v", err)
+		slog.ErrorContext(ctx, "service.CreatePerson: could not create person", "error", err)
 		return models.Person{}, fmt.Errorf("could not create person: %w", err)
 	}
 
-	log.Printf("service.CreatePerson: person created")
+	slog.InfoContext(ctx, "service.CreatePerson: person created")
 	return createdPerson, nil
 
 }
 
+// enrichedFields are the JSON fields of a person filled in by enrich, recorded in the
+// history with audit.SourceEnrichment.
+var enrichedFields = []string{"age", "gender", "nationality"}
+
+// enrich gets the age, gender and nationality for a name from the external APIs.
+func (s *personService) enrich(ctx context.Context, name string) (int, string, string, error) {
+	age, err := s.enricher.GetPersonAge(ctx, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.enrich: could not get person age", "error", err)
+		return 0, "", "", fmt.Errorf("could not get person age: %w", err)
+	}
+	gender, err := s.enricher.GetPersonGender(ctx, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.enrich: could not get person gender", "error", err)
+		return 0, "", "", fmt.Errorf("could not get person gender: %w", err)
+	}
+	nationality, err := s.enricher.GetPersonNationality(ctx, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.enrich: could not get person nationality", "error", err)
+		return 0, "", "", fmt.Errorf("could not get person nationality: %w", err)
+	}
+	return age, gender, nationality, nil
+}
+
 // GetPeople retrieves a list of people based on the provided filter criteria.
 // It calls the repository List method with the given context and filter.
 // Returns a slice of Person models if successful, otherwise returns an error.
 func (s *personService) GetPeople(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
-	log.Printf("service.GetPeople: getting people")
+	slog.InfoContext(ctx, "service.GetPeople: getting people")
 	people, err := s.repo.List(ctx, filter)
 	if err != nil {
-		log.Printf("service.GetPeople: could not list people: %v", err)
+		slog.ErrorContext(ctx, "service.GetPeople: could not list people", "error", err)
 		return nil, fmt.Errorf("could not list people: %w", err)
 	}
-	log.Printf("service.GetPeople: people listed")
+	slog.InfoContext(ctx, "service.GetPeople: people listed")
 	return people, nil
 }
 
+// ExportPeople calls fn with every person matching the filter, ordered by id and read
+// from one consistent snapshot. The paging fields of the filter are ignored.
+// An error returned by fn stops the export.
+func (s *personService) ExportPeople(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) error {
+	slog.InfoContext(ctx, "service.ExportPeople: exporting people")
+	if err := s.repo.Export(ctx, filter, fn); err != nil {
+		slog.ErrorContext(ctx, "service.ExportPeople: could not export people", "error", err)
+		return fmt.Errorf("could not export people: %w", err)
+	}
+	slog.InfoContext(ctx, "service.ExportPeople: people exported")
+	return nil
+}
+
+// GetPeoplePage retrieves one page of people together with the total number of matching
+// records. If filter.EstimateTotal is set and there is no text filter, the total is taken
+// from the Postgres statistics, falling back to an exact count when they are unavailable.
+// HasNext is exact for exact totals; for estimated totals it is derived from the page being full.
+func (s *personService) GetPeoplePage(ctx context.Context, filter models.PeopleFilter) (models.PeoplePage, error) {
+	slog.InfoContext(ctx, "service.GetPeoplePage: getting people page")
+	people, err := s.repo.List(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.GetPeoplePage: could not list people", "error", err)
+		return models.PeoplePage{}, fmt.Errorf("could not list people: %w", err)
+	}
+
+	page := models.PeoplePage{
+		People: people,
+		Page:   filter.Page,
+		Size:   filter.Size,
+	}
+
+	if filter.EstimateTotal && filter.Filter == "" {
+		estimate, err := s.repo.EstimateCount(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "service.GetPeoplePage: could not estimate people count", "error", err)
+			return models.PeoplePage{}, fmt.Errorf("could not estimate people count: %w", err)
+		}
+		if estimate >= 0 {
+			page.Total = estimate
+			page.TotalEstimated = true
+			page.HasNext = len(people) == filter.Size
+			slog.InfoContext(ctx, "service.GetPeoplePage: estimated total", "estimate", estimate)
+			return page, nil
+		}
+		slog.InfoContext(ctx, "service.GetPeoplePage: no statistics yet, falling back to exact count")
+	}
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.GetPeoplePage: could not count people", "error", err)
+		return models.PeoplePage{}, fmt.Errorf("could not count people: %w", err)
+	}
+	page.Total = total
+	page.HasNext = int64((filter.Page-1)*filter.Size+len(people)) < total
+	slog.InfoContext(ctx, "service.GetPeoplePage: counted", "total", total)
+	return page, nil
+}
+
 // GetPersonByID retrieves a person by their unique identifier.
 // It calls the repository GetByID method with the provided context and id.
 // Returns the person if found, otherwise returns an error.
 func (s *personService) GetPersonByID(ctx context.Context, id string) (models.Person, error) {
 	// Save the person in the repository
-	log.Printf("service.GetPersonByID: getting person by id")
+	slog.InfoContext(ctx, "service.GetPersonByID: getting person by id")
 	gotPerson, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		log.Printf("service.GetPersonByID: could not get person: %v", err)
+		slog.ErrorContext(ctx, "service.GetPersonByID: could not get person", "error", err)
 		return models.Person{}, fmt.Errorf("could not got person: %w", err)
 	}
 
-	log.Printf("service.GetPersonByID: person got %v", gotPerson)
+	slog.DebugContext(ctx, "service.GetPersonByID: person got", "person", gotPerson)
 	return gotPerson, nil
 }
 
 // UpdatePerson updates a person by their unique identifier.
 // It calls the repository Update method with the provided context and the updated person.
+// version is the version the caller has read, 0 updates regardless of the version;
+// models.ErrVersionMismatch is returned if the person was changed in the meantime.
 // Returns the updated person if the update was successful, otherwise returns an error.
-func (s *personService) UpdatePerson(ctx context.Context, id string, req models.UpdatePersonRequest) (models.Person, error) {
-	log.Printf("service.UpdatePerson: updating person")
+func (s *personService) UpdatePerson(ctx context.Context, id string, version int64, req models.UpdatePersonRequest) (models.Person, error) {
+	slog.InfoContext(ctx, "service.UpdatePerson: updating person")
+	if err := req.Validate(); err != nil {
+		slog.InfoContext(ctx, "service.UpdatePerson: invalid person", "error", err)
+		return models.Person{}, fmt.Errorf("could not update person: %w", err)
+	}
 	updatedPerson := models.Person{
 		ID:          id,
+		Version:     version,
 		Name:        req.Name,
 		Surname:     req.Surname,
 		Patronymic:  req.Patronymic,
@@ -126,25 +219,134 @@ func (s *personService) UpdatePerson(ctx context.Context, id string, req models.
 		Gender:      req.Gender,
 		Nationality: req.Nationality,
 	}
-	log.Printf("service.UpdatePerson: updating person in repository")
+	slog.InfoContext(ctx, "service.UpdatePerson: updating person in repository")
 	updatedPerson, err := s.repo.Update(ctx, updatedPerson)
 	if err != nil {
-		log.Printf("service.UpdatePerson: could not update person: %v", err)
+		slog.ErrorContext(ctx, "service.UpdatePerson: could not update person", "error", err)
 		return models.Person{}, fmt.Errorf("could not update person: %w", err)
 	}
-	log.Printf("service.UpdatePerson: person updated")
+	slog.InfoContext(ctx, "service.UpdatePerson: person updated")
 	return updatedPerson, nil
 }
 
+// PatchPerson applies a merge patch or a JSON patch to the person with the given id.
+// The patched person is validated as a whole and then saved with UpdatePerson, so
+// a field removed by the patch is cleared. Returns models.ErrInvalidPatch if the patch
+// cannot be applied and models.ErrValidation if the result is not a valid person.
+// The person is saved only if it still has the version it was patched from, which must
+// match version unless version is 0; otherwise models.ErrVersionMismatch is returned.
+func (s *personService) PatchPerson(ctx context.Context, id string, version int64, patchType models.PatchType, patch []byte) (models.Person, error) {
+	slog.InfoContext(ctx, "service.PatchPerson: patching person")
+	current, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.PatchPerson: could not get person", "error", err)
+		return models.Person{}, fmt.Errorf("could not patch person: %w", err)
+	}
+	if version != 0 && current.Version != version {
+		slog.InfoContext(ctx, "service.PatchPerson: version mismatch", "version", current.Version, "expected", version)
+		return models.Person{}, fmt.Errorf("could not patch person: %w", models.ErrVersionMismatch)
+	}
+
+	req, err := applyPatch(current, patchType, patch)
+	if err != nil {
+		slog.InfoContext(ctx, "service.PatchPerson: could not apply patch", "error", err)
+		return models.Person{}, fmt.Errorf("could not patch person: %w", err)
+	}
+	if err := req.Validate(); err != nil {
+		slog.InfoContext(ctx, "service.PatchPerson: patched person is invalid", "error", err)
+		return models.Person{}, fmt.Errorf("could not patch person: %w", err)
+	}
+
+	slog.InfoContext(ctx, "service.PatchPerson: saving patched person")
+	return s.UpdatePerson(ctx, id, current.Version, req)
+}
+
 // DeletePerson deletes a person by their unique identifier.
 // It calls the repository Delete method with the provided context and id.
+// version is the version the caller has read, 0 deletes regardless of the version.
 // Returns an error if the deletion fails.
-func (s *personService) DeletePerson(ctx context.Context, id string) error {
-	log.Printf("service.DeletePerson: deleting person")
-	if err := s.repo.Delete(ctx, id); err != nil {
-		log.Printf("service.DeletePerson: could not delete person: %v", err)
+func (s *personService) DeletePerson(ctx context.Context, id string, version int64) error {
+	slog.InfoContext(ctx, "service.DeletePerson: deleting person")
+	if err := s.repo.Delete(ctx, id, version); err != nil {
+		slog.ErrorContext(ctx, "service.DeletePerson: could not delete person", "error", err)
 		return fmt.Errorf("could not delete person: %w", err)
 	}
-	log.Printf("service.DeletePerson: person deleted")
+	slog.InfoContext(ctx, "service.DeletePerson: person deleted")
 	return nil
 }
+
+// GetDeletedPeople retrieves soft-deleted people based on the provided filter criteria.
+// It calls the repository ListDeleted method with the given context and filter.
+func (s *personService) GetDeletedPeople(ctx context.Context, filter models.PeopleFilter) ([]models.Person, error) {
+	slog.InfoContext(ctx, "service.GetDeletedPeople: getting deleted people")
+	people, err := s.repo.ListDeleted(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.GetDeletedPeople: could not list deleted people", "error", err)
+		return nil, fmt.Errorf("could not list deleted people: %w", err)
+	}
+	slog.InfoContext(ctx, "service.GetDeletedPeople: deleted people listed")
+	return people, nil
+}
+
+// RestorePerson restores a soft-deleted person by their unique identifier.
+// It calls the repository Restore method and returns the restored person.
+func (s *personService) RestorePerson(ctx context.Context, id string) (models.Person, error) {
+	slog.InfoContext(ctx, "service.RestorePerson: restoring person")
+	restored, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.RestorePerson: could not restore person", "error", err)
+		return models.Person{}, fmt.Errorf("could not restore person: %w", err)
+	}
+	slog.InfoContext(ctx, "service.RestorePerson: person restored")
+	return restored, nil
+}
+
+// PurgePerson permanently deletes a soft-deleted person by their unique identifier.
+// It calls the repository Purge method with the provided context and id.
+func (s *personService) PurgePerson(ctx context.Context, id string) error {
+	slog.InfoContext(ctx, "service.PurgePerson: purging person")
+	if err := s.repo.Purge(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "service.PurgePerson: could not purge person", "error", err)
+		return fmt.Errorf("could not purge person: %w", err)
+	}
+	slog.InfoContext(ctx, "service.PurgePerson: person purged")
+	return nil
+}
+
+// PurgeDeletedBefore permanently deletes all people soft-deleted before the given time.
+// It returns the number of purged people.
+func (s *personService) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	slog.InfoContext(ctx, "service.PurgeDeletedBefore: purging people deleted before", "before", before)
+	purged, err := s.repo.PurgeDeletedBefore(ctx, before)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.PurgeDeletedBefore: could not purge deleted people", "error", err)
+		return 0, fmt.Errorf("could not purge deleted people: %w", err)
+	}
+	slog.InfoContext(ctx, "service.PurgeDeletedBefore: people purged", "purged", purged)
+	return purged, nil
+}
+
+// GetPersonHistory returns one page of the change history of a person, oldest change first.
+func (s *personService) GetPersonHistory(ctx context.Context, id string, page, size int) ([]models.PersonChange, error) {
+	slog.InfoContext(ctx, "service.GetPersonHistory: getting history of person")
+	changes, err := s.repo.History(ctx, id, page, size)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.GetPersonHistory: could not get history", "error", err)
+		return nil, fmt.Errorf("could not get person history: %w", err)
+	}
+	slog.InfoContext(ctx, "service.GetPersonHistory: changes got", "count", len(changes))
+	return changes, nil
+}
+
+// GetPersonAsOf returns a person as it was at the given time, reconstructed from its history.
+// models.ErrNotFound is returned if the person did not exist or was deleted at that time.
+func (s *personService) GetPersonAsOf(ctx context.Context, id string, at time.Time) (models.Person, error) {
+	slog.InfoContext(ctx, "service.GetPersonAsOf: getting person as of", "at", at)
+	person, err := s.repo.GetAsOf(ctx, id, at)
+	if err != nil {
+		slog.ErrorContext(ctx, "service.GetPersonAsOf: could not get person", "error", err)
+		return models.Person{}, fmt.Errorf("could not get person as of %s: %w", at.Format(time.RFC3339), err)
+	}
+	slog.DebugContext(ctx, "service.GetPersonAsOf: person got", "person", person)
+	return person, nil
+}
@@ -3,8 +3,11 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"person-enricher/internal/audit"
 	"person-enricher/internal/models"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -30,7 +33,10 @@ func TestCreatePerson(t *testing.T) {
 				e.On("GetPersonAge", mock.Anything, "John").Return(30, nil)
 				e.On("GetPersonGender", mock.Anything, "John").Return("male", nil)
 				e.On("GetPersonNationality", mock.Anything, "John").Return("US", nil)
-				r.On("Create", mock.Anything, models.Person{
+				enriched := mock.MatchedBy(func(ctx context.Context) bool {
+					return assert.ObjectsAreEqual([]string{"age", "gender", "nationality"}, audit.FromContext(ctx).Enriched)
+				})
+				r.On("Create", enriched, models.Person{
 					Name:        "John",
 					Surname:     "Doe",
 					Patronymic:  "Smith",
@@ -174,6 +180,106 @@ func TestGetPeople(t *testing.T) {
     }
 }
 
+func TestGetPeoplePage(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      models.PeopleFilter
+		mockSetup   func(*MockRepository)
+		expected    models.PeoplePage
+		expectedErr string
+	}{
+		{
+			name:   "exact total with next page",
+			filter: models.PeopleFilter{Page: 1, Size: 1},
+			mockSetup: func(r *MockRepository) {
+				f := models.PeopleFilter{Page: 1, Size: 1}
+				r.On("List", mock.Anything, f).Return([]models.Person{{ID: "1"}}, nil)
+				r.On("Count", mock.Anything, f).Return(int64(2), nil)
+			},
+			expected: models.PeoplePage{
+				People: []models.Person{{ID: "1"}}, Page: 1, Size: 1, Total: 2, HasNext: true,
+			},
+		},
+		{
+			name:   "exact total on last page",
+			filter: models.PeopleFilter{Page: 2, Size: 1},
+			mockSetup: func(r *MockRepository) {
+				f := models.PeopleFilter{Page: 2, Size: 1}
+				r.On("List", mock.Anything, f).Return([]models.Person{{ID: "2"}}, nil)
+				r.On("Count", mock.Anything, f).Return(int64(2), nil)
+			},
+			expected: models.PeoplePage{
+				People: []models.Person{{ID: "2"}}, Page: 2, Size: 1, Total: 2,
+			},
+		},
+		{
+			name:   "estimated total",
+			filter: models.PeopleFilter{Page: 1, Size: 1, EstimateTotal: true},
+			mockSetup: func(r *MockRepository) {
+				f := models.PeopleFilter{Page: 1, Size: 1, EstimateTotal: true}
+				r.On("List", mock.Anything, f).Return([]models.Person{{ID: "1"}}, nil)
+				r.On("EstimateCount", mock.Anything).Return(int64(1000), nil)
+			},
+			expected: models.PeoplePage{
+				People: []models.Person{{ID: "1"}}, Page: 1, Size: 1, Total: 1000, TotalEstimated: true, HasNext: true,
+			},
+		},
+		{
+			name:   "estimate unavailable falls back to exact count",
+			filter: models.PeopleFilter{Page: 1, Size: 10, EstimateTotal: true},
+			mockSetup: func(r *MockRepository) {
+				f := models.PeopleFilter{Page: 1, Size: 10, EstimateTotal: true}
+				r.On("List", mock.Anything, f).Return([]models.Person{{ID: "1"}}, nil)
+				r.On("EstimateCount", mock.Anything).Return(int64(-1), nil)
+				r.On("Count", mock.Anything, f).Return(int64(1), nil)
+			},
+			expected: models.PeoplePage{
+				People: []models.Person{{ID: "1"}}, Page: 1, Size: 10, Total: 1,
+			},
+		},
+		{
+			name:   "estimate is ignored with a text filter",
+			filter: models.PeopleFilter{Filter: "John", Page: 1, Size: 10, EstimateTotal: true},
+			mockSetup: func(r *MockRepository) {
+				f := models.PeopleFilter{Filter: "John", Page: 1, Size: 10, EstimateTotal: true}
+				r.On("List", mock.Anything, f).Return([]models.Person{}, nil)
+				r.On("Count", mock.Anything, f).Return(int64(0), nil)
+			},
+			expected: models.PeoplePage{
+				People: []models.Person{}, Page: 1, Size: 10,
+			},
+		},
+		{
+			name:   "repository count error",
+			filter: models.PeopleFilter{Page: 1, Size: 10},
+			mockSetup: func(r *MockRepository) {
+				f := models.PeopleFilter{Page: 1, Size: 10}
+				r.On("List", mock.Anything, f).Return([]models.Person{}, nil)
+				r.On("Count", mock.Anything, f).Return(int64(0), errors.New("db error"))
+			},
+			expectedErr: "could not count people: db error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			tt.mockSetup(repo)
+
+			service := NewPersonService(repo, new(MockEnricher))
+			result, err := service.GetPeoplePage(context.Background(), tt.filter)
+
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestGetPersonByID(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -194,9 +300,9 @@ func TestGetPersonByID(t *testing.T) {
 			name: "not found",
 			id:   "2",
 			mockSetup: func(r *MockRepository) {
-				r.On("GetByID", mock.Anything, "2").Return(models.Person{}, nil)
+				r.On("GetByID", mock.Anything, "2").Return(models.Person{}, fmt.Errorf("get by id: %w", models.ErrNotFound))
 			},
-			expected: models.Person{},
+			expectedErr: "not found",
 		},
 		{
 			name: "repository error",
@@ -216,7 +322,9 @@ func TestGetPersonByID(t *testing.T) {
 			service := NewPersonService(repo, new(MockEnricher))
 			result, err := service.GetPersonByID(context.Background(), tt.id)
 
-			if tt.expectedErr != "" {
+			if tt.expectedErr == "not found" {
+				assert.ErrorIs(t, err, models.ErrNotFound)
+			} else if tt.expectedErr != "" {
 				assert.ErrorContains(t, err, tt.expectedErr)
 			} else {
 				assert.NoError(t, err)
@@ -231,6 +339,7 @@ func TestUpdatePerson(t *testing.T) {
     tests := []struct {
         name        string
         id          string
+        version     int64
         req         models.UpdatePersonRequest
         mockSetup   func(*MockRepository)
         expected    models.Person
@@ -294,6 +403,42 @@ func TestUpdatePerson(t *testing.T) {
             },
             expectedErr: "could not update person: db error",
         },
+        {
+            name:    "stale version",
+            id:      "1",
+            version: 2,
+            req: models.UpdatePersonRequest{
+                Name:        "John",
+                Surname:     "Doe",
+                Age:         30,
+                Gender:      "male",
+                Nationality: "US",
+            },
+            mockSetup: func(r *MockRepository) {
+                expectedPerson := models.Person{
+                    ID:          "1",
+                    Version:     2,
+                    Name:        "John",
+                    Surname:     "Doe",
+                    Age:         30,
+                    Gender:      "male",
+                    Nationality: "US",
+                }
+                r.On("Update", mock.Anything, expectedPerson).
+                    Return(models.Person{}, fmt.Errorf("update person: %w", models.ErrVersionMismatch))
+            },
+            expectedErr: "version mismatch",
+        },
+        {
+            name: "invalid person",
+            id:   "1",
+            req: models.UpdatePersonRequest{
+                Name:    "John",
+                Surname: "Doe",
+            },
+            mockSetup:   func(r *MockRepository) {},
+            expectedErr: "age is required; gender is required; nationality is required",
+        },
     }
 
     for _, tt := range tests {
@@ -303,7 +448,7 @@ func TestUpdatePerson(t *testing.T) {
             tt.mockSetup(repo)
 
             service := NewPersonService(repo, enricher)
-            result, err := service.UpdatePerson(context.Background(), tt.id, tt.req)
+            result, err := service.UpdatePerson(context.Background(), tt.id, tt.version, tt.req)
 
             if tt.expectedErr != "" {
                 assert.ErrorContains(t, err, tt.expectedErr)
@@ -316,6 +461,120 @@ func TestUpdatePerson(t *testing.T) {
     }
 }
 
+func TestPatchPerson(t *testing.T) {
+	current := models.Person{
+		ID:          "1",
+		Name:        "John",
+		Surname:     "Doe",
+		Patronymic:  "Smith",
+		Age:         30,
+		Gender:      "male",
+		Nationality: "US",
+		Version:     4,
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		version   int64
+		patchType models.PatchType
+		patch     string
+		// saved is the person expected to be passed to the repository Update
+		saved   *models.Person
+		getErr  error
+		wantErr error
+	}{
+		{
+			name:      "merge patch clears patronymic",
+			id:        "1",
+			version:   4,
+			patchType: models.MergePatch,
+			patch:     `{"patronymic": null, "age": 31}`,
+			saved: &models.Person{
+				ID: "1", Name: "John", Surname: "Doe", Age: 31, Gender: "male", Nationality: "US", Version: 4,
+			},
+		},
+		{
+			name:      "json patch replaces a field",
+			id:        "1",
+			patchType: models.JSONPatch,
+			patch:     `[{"op": "test", "path": "/name", "value": "John"}, {"op": "replace", "path": "/nationality", "value": "GB"}]`,
+			saved: &models.Person{
+				ID: "1", Name: "John", Surname: "Doe", Patronymic: "Smith", Age: 30, Gender: "male", Nationality: "GB", Version: 4,
+			},
+		},
+		{
+			name:      "stale version",
+			id:        "1",
+			version:   3,
+			patchType: models.MergePatch,
+			patch:     `{"age": 31}`,
+			wantErr:   models.ErrVersionMismatch,
+		},
+		{
+			name:      "merge patch removes a required field",
+			id:        "1",
+			patchType: models.MergePatch,
+			patch:     `{"name": null}`,
+			wantErr:   models.ErrValidation,
+		},
+		{
+			name:      "merge patch sets an unknown field",
+			id:        "1",
+			patchType: models.MergePatch,
+			patch:     `{"id": "2"}`,
+			wantErr:   models.ErrInvalidPatch,
+		},
+		{
+			name:      "merge patch is not json",
+			id:        "1",
+			patchType: models.MergePatch,
+			patch:     `{"name":`,
+			wantErr:   models.ErrInvalidPatch,
+		},
+		{
+			name:      "json patch test fails",
+			id:        "1",
+			patchType: models.JSONPatch,
+			patch:     `[{"op": "test", "path": "/name", "value": "Jane"}]`,
+			wantErr:   models.ErrInvalidPatch,
+		},
+		{
+			name:      "person not found",
+			id:        "2",
+			patchType: models.MergePatch,
+			patch:     `{"age": 31}`,
+			getErr:    fmt.Errorf("get by id: %w", models.ErrNotFound),
+			wantErr:   models.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			if tt.getErr != nil {
+				repo.On("GetByID", mock.Anything, tt.id).Return(models.Person{}, tt.getErr)
+			} else {
+				repo.On("GetByID", mock.Anything, tt.id).Return(current, nil)
+			}
+			if tt.saved != nil {
+				repo.On("Update", mock.Anything, *tt.saved).Return(*tt.saved, nil)
+			}
+
+			service := NewPersonService(repo, new(MockEnricher))
+			result, err := service.PatchPerson(context.Background(), tt.id, tt.version, tt.patchType, []byte(tt.patch))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, *tt.saved, result)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestDeletePerson(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -327,14 +586,14 @@ func TestDeletePerson(t *testing.T) {
 			name: "success",
 			id:   "1",
 			mockSetup: func(r *MockRepository) {
-				r.On("Delete", mock.Anything, "1").Return(nil)
+				r.On("Delete", mock.Anything, "1", int64(0)).Return(nil)
 			},
 		},
 		{
 			name: "error",
 			id:   "2",
 			mockSetup: func(r *MockRepository) {
-				r.On("Delete", mock.Anything, "2").Return(errors.New("db error"))
+				r.On("Delete", mock.Anything, "2", int64(0)).Return(errors.New("db error"))
 			},
 			expectedErr: "could not delete person: db error",
 		},
@@ -346,7 +605,7 @@ func TestDeletePerson(t *testing.T) {
 			tt.mockSetup(repo)
 
 			service := NewPersonService(repo, new(MockEnricher))
-			err := service.DeletePerson(context.Background(), tt.id)
+			err := service.DeletePerson(context.Background(), tt.id, 0)
 
 			if tt.expectedErr != "" {
 				assert.ErrorContains(t, err, tt.expectedErr)
@@ -356,4 +615,151 @@ func TestDeletePerson(t *testing.T) {
 			repo.AssertExpectations(t)
 		})
 	}
-}
\ No newline at end of file
+}
+func TestRestorePerson(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		mockSetup   func(*MockRepository)
+		expected    models.Person
+		expectedErr string
+	}{
+		{
+			name: "success",
+			id:   "1",
+			mockSetup: func(r *MockRepository) {
+				r.On("Restore", mock.Anything, "1").Return(models.Person{ID: "1"}, nil)
+			},
+			expected: models.Person{ID: "1"},
+		},
+		{
+			name: "error",
+			id:   "2",
+			mockSetup: func(r *MockRepository) {
+				r.On("Restore", mock.Anything, "2").Return(models.Person{}, errors.New("db error"))
+			},
+			expectedErr: "could not restore person: db error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			tt.mockSetup(repo)
+
+			service := NewPersonService(repo, new(MockEnricher))
+			result, err := service.RestorePerson(context.Background(), tt.id)
+
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPurgePerson(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		mockSetup   func(*MockRepository)
+		expectedErr string
+	}{
+		{
+			name: "success",
+			id:   "1",
+			mockSetup: func(r *MockRepository) {
+				r.On("Purge", mock.Anything, "1").Return(nil)
+			},
+		},
+		{
+			name: "error",
+			id:   "2",
+			mockSetup: func(r *MockRepository) {
+				r.On("Purge", mock.Anything, "2").Return(errors.New("db error"))
+			},
+			expectedErr: "could not purge person: db error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockRepository)
+			tt.mockSetup(repo)
+
+			service := NewPersonService(repo, new(MockEnricher))
+			err := service.PurgePerson(context.Background(), tt.id)
+
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestExportPeople(t *testing.T) {
+	repo := new(MockRepository)
+	people := []models.Person{{ID: "1"}, {ID: "2"}}
+	repo.On("Export", mock.Anything, models.PeopleFilter{Filter: "doe"}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(2).(func(models.Person) error)
+			for _, p := range people {
+				fn(p)
+			}
+		}).
+		Return(nil)
+	repo.On("Export", mock.Anything, models.PeopleFilter{Filter: "error"}, mock.Anything).
+		Return(errors.New("db error"))
+
+	service := NewPersonService(repo, new(MockEnricher))
+	var got []models.Person
+	err := service.ExportPeople(context.Background(), models.PeopleFilter{Filter: "doe"}, func(p models.Person) error {
+		got = append(got, p)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, people, got)
+
+	err = service.ExportPeople(context.Background(), models.PeopleFilter{Filter: "error"}, func(models.Person) error { return nil })
+	assert.EqualError(t, err, "could not export people: db error")
+	repo.AssertExpectations(t)
+}
+
+func TestGetPersonHistory(t *testing.T) {
+	repo := new(MockRepository)
+	changes := []models.PersonChange{{ID: 1, PersonID: "1", Operation: models.OperationCreate}}
+	repo.On("History", mock.Anything, "1", 1, 10).Return(changes, nil)
+	repo.On("History", mock.Anything, "2", 1, 10).Return([]models.PersonChange(nil), fmt.Errorf("list history: %w", models.ErrNotFound))
+
+	service := NewPersonService(repo, new(MockEnricher))
+	got, err := service.GetPersonHistory(context.Background(), "1", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, changes, got)
+
+	_, err = service.GetPersonHistory(context.Background(), "2", 1, 10)
+	assert.ErrorIs(t, err, models.ErrNotFound)
+	repo.AssertExpectations(t)
+}
+
+func TestGetPersonAsOf(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := new(MockRepository)
+	repo.On("GetAsOf", mock.Anything, "1", at).Return(models.Person{ID: "1", Name: "John"}, nil)
+	repo.On("GetAsOf", mock.Anything, "2", at).Return(models.Person{}, fmt.Errorf("get as of: %w", models.ErrNotFound))
+
+	service := NewPersonService(repo, new(MockEnricher))
+	got, err := service.GetPersonAsOf(context.Background(), "1", at)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", got.Name)
+
+	_, err = service.GetPersonAsOf(context.Background(), "2", at)
+	assert.ErrorIs(t, err, models.ErrNotFound)
+	assert.ErrorContains(t, err, "2024-05-01T12:00:00Z")
+	repo.AssertExpectations(t)
+}
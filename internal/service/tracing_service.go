@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"person-enricher/internal/models"
+	"person-enricher/internal/tracing"
+)
+
+// tracedService wraps a PersonService and starts a span for each of its methods
+type tracedService struct {
+	service PersonService
+}
+
+// NewTracedService creates a new instance of tracedService, which wraps an existing
+// PersonService and starts a span named after the method, e.g. "PersonService.CreatePerson",
+// for each call. Errors are recorded on the span. Person ids are set as the person.id
+// attribute; personal data is not recorded.
+func NewTracedService(s PersonService) PersonService {
+	return &tracedService{service: s}
+}
+
+// start starts the span of a PersonService method.
+func (s *tracedService) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "PersonService."+method, trace.WithAttributes(attrs...))
+}
+
+// GetPeople traces the GetPeople method of the underlying PersonService.
+func (s *tracedService) GetPeople(ctx context.Context, filter models.PeopleFilter) (people []models.Person, err error) {
+	ctx, span := s.start(ctx, "GetPeople")
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetPeople(ctx, filter)
+}
+
+// GetPeoplePage traces the GetPeoplePage method of the underlying PersonService.
+func (s *tracedService) GetPeoplePage(ctx context.Context, filter models.PeopleFilter) (page models.PeoplePage, err error) {
+	ctx, span := s.start(ctx, "GetPeoplePage")
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetPeoplePage(ctx, filter)
+}
+
+// ExportPeople traces the ExportPeople method of the underlying PersonService.
+func (s *tracedService) ExportPeople(ctx context.Context, filter models.PeopleFilter, fn func(models.Person) error) (err error) {
+	ctx, span := s.start(ctx, "ExportPeople")
+	defer func() { tracing.End(span, err) }()
+	return s.service.ExportPeople(ctx, filter, fn)
+}
+
+// GetPersonByID traces the GetPersonByID method of the underlying PersonService.
+func (s *tracedService) GetPersonByID(ctx context.Context, id string) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "GetPersonByID", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetPersonByID(ctx, id)
+}
+
+// CreatePerson traces the CreatePerson method of the underlying PersonService.
+func (s *tracedService) CreatePerson(ctx context.Context, req models.CreatePersonRequest) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "CreatePerson")
+	defer func() { tracing.End(span, err) }()
+	return s.service.CreatePerson(ctx, req)
+}
+
+// CreatePeople traces the CreatePeople method of the underlying PersonService.
+func (s *tracedService) CreatePeople(ctx context.Context, reqs []models.CreatePersonRequest, mode models.BatchMode) (items []models.BatchItem, err error) {
+	ctx, span := s.start(ctx, "CreatePeople", attribute.Int("batch.size", len(reqs)), attribute.String("batch.mode", string(mode)))
+	defer func() { tracing.End(span, err) }()
+	return s.service.CreatePeople(ctx, reqs, mode)
+}
+
+// UpdatePerson traces the UpdatePerson method of the underlying PersonService.
+func (s *tracedService) UpdatePerson(ctx context.Context, id string, version int64, req models.UpdatePersonRequest) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "UpdatePerson", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.UpdatePerson(ctx, id, version, req)
+}
+
+// PatchPerson traces the PatchPerson method of the underlying PersonService.
+func (s *tracedService) PatchPerson(ctx context.Context, id string, version int64, patchType models.PatchType, patch []byte) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "PatchPerson", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.PatchPerson(ctx, id, version, patchType, patch)
+}
+
+// DeletePerson traces the DeletePerson method of the underlying PersonService.
+func (s *tracedService) DeletePerson(ctx context.Context, id string, version int64) (err error) {
+	ctx, span := s.start(ctx, "DeletePerson", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.DeletePerson(ctx, id, version)
+}
+
+// GetDeletedPeople traces the GetDeletedPeople method of the underlying PersonService.
+func (s *tracedService) GetDeletedPeople(ctx context.Context, filter models.PeopleFilter) (people []models.Person, err error) {
+	ctx, span := s.start(ctx, "GetDeletedPeople")
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetDeletedPeople(ctx, filter)
+}
+
+// RestorePerson traces the RestorePerson method of the underlying PersonService.
+func (s *tracedService) RestorePerson(ctx context.Context, id string) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "RestorePerson", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.RestorePerson(ctx, id)
+}
+
+// PurgePerson traces the PurgePerson method of the underlying PersonService.
+func (s *tracedService) PurgePerson(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "PurgePerson", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.PurgePerson(ctx, id)
+}
+
+// PurgeDeletedBefore traces the PurgeDeletedBefore method of the underlying PersonService.
+func (s *tracedService) PurgeDeletedBefore(ctx context.Context, before time.Time) (purged int64, err error) {
+	ctx, span := s.start(ctx, "PurgeDeletedBefore")
+	defer func() { tracing.End(span, err) }()
+	return s.service.PurgeDeletedBefore(ctx, before)
+}
+
+// GetPersonHistory traces the GetPersonHistory method of the underlying PersonService.
+func (s *tracedService) GetPersonHistory(ctx context.Context, id string, page, size int) (changes []models.PersonChange, err error) {
+	ctx, span := s.start(ctx, "GetPersonHistory", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetPersonHistory(ctx, id, page, size)
+}
+
+// GetPersonAsOf traces the GetPersonAsOf method of the underlying PersonService.
+func (s *tracedService) GetPersonAsOf(ctx context.Context, id string, at time.Time) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "GetPersonAsOf", attribute.String("person.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetPersonAsOf(ctx, id, at)
+}
+
+// GetDuplicates traces the GetDuplicates method of the underlying PersonService.
+func (s *tracedService) GetDuplicates(ctx context.Context, threshold float64, page, size int) (pairs []models.DuplicatePair, err error) {
+	ctx, span := s.start(ctx, "GetDuplicates")
+	defer func() { tracing.End(span, err) }()
+	return s.service.GetDuplicates(ctx, threshold, page, size)
+}
+
+// CheckDuplicates traces the CheckDuplicates method of the underlying PersonService.
+func (s *tracedService) CheckDuplicates(ctx context.Context, req models.CreatePersonRequest) (err error) {
+	ctx, span := s.start(ctx, "CheckDuplicates")
+	defer func() { tracing.End(span, err) }()
+	return s.service.CheckDuplicates(ctx, req)
+}
+
+// MergePeople traces the MergePeople method of the underlying PersonService.
+func (s *tracedService) MergePeople(ctx context.Context, survivorID, duplicateID string, version int64, take []string) (person models.Person, err error) {
+	ctx, span := s.start(ctx, "MergePeople", attribute.String("person.id", survivorID), attribute.String("person.duplicate_id", duplicateID))
+	defer func() { tracing.End(span, err) }()
+	return s.service.MergePeople(ctx, survivorID, duplicateID, version, take)
+}
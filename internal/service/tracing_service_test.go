@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"person-enricher/internal/models"
+)
+
+func TestTracedService(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(prev)
+
+	repo := new(MockRepository)
+	repo.On("GetByID", mock.Anything, "1").Return(models.Person{ID: "1"}, nil)
+	repo.On("GetByID", mock.Anything, "2").Return(models.Person{}, errors.New("db error"))
+	svc := NewTracedService(NewPersonService(repo, new(MockEnricher)))
+
+	_, err := svc.GetPersonByID(context.Background(), "1")
+	assert.NoError(t, err)
+	_, err = svc.GetPersonByID(context.Background(), "2")
+	assert.Error(t, err)
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "PersonService.GetPersonByID", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("person.id", "1"))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Len(t, spans[1].Events(), 1, "the error is recorded")
+}
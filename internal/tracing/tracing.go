@@ -0,0 +1,111 @@
+// Package tracing sets up OpenTelemetry tracing: the tracer provider with its exporter,
+// the W3C trace context propagation, and the spans of the GORM queries and outbound HTTP calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name of the exported spans, unless OTEL_SERVICE_NAME is set.
+const ServiceName = "person-enricher"
+
+// InstrumentationName is the name of the tracers of the application.
+const InstrumentationName = "person-enricher"
+
+// Exporter is where the spans are sent.
+type Exporter string
+
+const (
+	// ExporterNone records no spans; trace context is still propagated.
+	ExporterNone Exporter = "none"
+	// ExporterStdout writes the spans as JSON, for local development. They go to stderr,
+	// so that they do not mix with the JSON logs on stdout.
+	ExporterStdout Exporter = "stdout"
+	// ExporterOTLP sends the spans over OTLP/HTTP, to the endpoint set by the
+	// standard OTEL_EXPORTER_OTLP_ENDPOINT variables (http://localhost:4318 by default).
+	ExporterOTLP Exporter = "otlp"
+)
+
+// ParseExporter parses an exporter name: none, stdout or otlp, in any case.
+// An empty name is none.
+func ParseExporter(s string) (Exporter, error) {
+	switch e := Exporter(strings.ToLower(strings.TrimSpace(s))); e {
+	case "":
+		return ExporterNone, nil
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+		return e, nil
+	default:
+		return "", fmt.Errorf("invalid tracing exporter %q, expected none, stdout or otlp", s)
+	}
+}
+
+// Setup installs the global tracer provider exporting to e and the W3C trace context
+// and baggage propagators. The returned function flushes and stops the provider.
+func Setup(ctx context.Context, e Exporter) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if e == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, e, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("create %s exporter: %w", e, err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporter returns the exporter e; ExporterStdout writes to w.
+func newExporter(ctx context.Context, e Exporter, w io.Writer) (sdktrace.SpanExporter, error) {
+	switch e {
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case ExporterOTLP:
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", e)
+	}
+}
+
+// Tracer returns the tracer of the application from the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordSpans installs a tracer provider recording the ended spans for the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return sr
+}
+
+// attrs returns the attributes of span by key.
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	out := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		out[kv.Key] = kv.Value
+	}
+	return out
+}
+
+func TestParseExporter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Exporter
+		wantErr bool
+	}{
+		{"", ExporterNone, false},
+		{"none", ExporterNone, false},
+		{"STDOUT", ExporterStdout, false},
+		{" otlp ", ExporterOTLP, false},
+		{"jaeger", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseExporter(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	for _, e := range []Exporter{ExporterNone, ExporterStdout, ExporterOTLP} {
+		t.Run(string(e), func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), e)
+			assert.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+	assert.ElementsMatch(t, []string{"traceparent", "tracestate", "baggage"}, otel.GetTextMapPropagator().Fields())
+
+	_, err := newExporter(context.Background(), ExporterNone, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestGormPlugin(t *testing.T) {
+	sr := recordSpans(t)
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Use(NewGormPlugin()))
+
+	mock.ExpectQuery(`SELECT \* FROM "people" WHERE name = \$1`).
+		WithArgs("Ivan").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	mock.ExpectQuery(`SELECT \* FROM "people" WHERE name = \$1`).
+		WithArgs("Petr").
+		WillReturnError(errors.New("boom"))
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	var rows []map[string]interface{}
+	assert.NoError(t, db.WithContext(ctx).Table("people").Where("name = ?", "Ivan").Find(&rows).Error)
+	assert.Error(t, db.WithContext(ctx).Table("people").Where("name = ?", "Petr").Find(&rows).Error)
+	parent.End()
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 3)
+	ok, failed := spans[0], spans[1]
+
+	assert.Equal(t, "gorm.query", ok.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), ok.Parent().SpanID())
+	a := attrs(ok)
+	assert.Equal(t, `SELECT * FROM "people" WHERE name = $1`, a["db.query.text"].AsString())
+	assert.Equal(t, "people", a["db.collection.name"].AsString())
+	assert.Equal(t, "postgresql", a["db.system"].AsString())
+	assert.Equal(t, int64(1), a["db.rows_affected"].AsInt64())
+	assert.Equal(t, codes.Unset, ok.Status().Code)
+
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.NotContains(t, attrs(failed)["db.query.text"].AsString(), "Petr")
+}
+
+func TestTransport(t *testing.T) {
+	sr := recordSpans(t)
+	Setup(context.Background(), ExporterNone)
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		if r.URL.Query().Get("name") == "fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: NewTransport(nil)}
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/?name=Ivan", nil)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, req.Header.Get("traceparent"), "the request of the caller is not modified")
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/?name=fail", nil)
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 3)
+	span := spans[0]
+	assert.Equal(t, "GET 127.0.0.1", span.Name())
+	assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+	a := attrs(span)
+	assert.Equal(t, int64(http.StatusOK), a["http.response.status_code"].AsInt64())
+	assert.NotContains(t, a["url.full"].AsString(), "Ivan")
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
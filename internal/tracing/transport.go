@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"person-enricher/internal/logging"
+)
+
+// Transport is an http.RoundTripper starting a client span for each request, e.g.
+// "GET api.agify.io", and sending its trace context in the traceparent header.
+// The URL is recorded as logging.URL redacts it, since the query may hold personal data.
+type Transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport returns a Transport sending the requests with base,
+// or with http.DefaultTransport if base is nil.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), req.Method+" "+req.URL.Hostname(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLFull(logging.URL(req.URL)),
+		),
+	)
+
+	// RoundTrip must not modify the request, so the header goes to a copy
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		End(span, &statusError{resp.Status})
+		return resp, nil
+	}
+	span.End()
+	return resp, nil
+}
+
+// statusError records a server error response on a span.
+type statusError struct {
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server responded " + e.status
+}
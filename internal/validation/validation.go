@@ -0,0 +1,151 @@
+// Package validation checks request structs against the rules declared in their
+// validate struct tags and reports every field that breaks one.
+//
+// Rules are separated by commas:
+//
+//	required   the field must not be empty (0 for numbers, blank for strings)
+//	min=N      numbers must be at least N
+//	max=N      numbers must be at most N, strings at most N characters long
+//	name       letters, separated by single spaces, hyphens or apostrophes
+//	oneof=a b  the value must be one of the listed values
+//	iso3166    an ISO 3166-1 alpha-2 country code in upper case, e.g. RU
+//
+// Fields are reported by their JSON name. Rules other than required are not
+// checked on empty fields.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error codes of a FieldError
+const (
+	CodeRequired     = "required"
+	CodeTooLong      = "too_long"
+	CodeOutOfRange   = "out_of_range"
+	CodeInvalidChars = "invalid_characters"
+	CodeInvalidValue = "invalid_value"
+	CodeUnknownField = "unknown_field"
+)
+
+// FieldError — one field that does not pass validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// namePattern matches names like "Anna", "Jean-Luc", "O'Neil" or "Mary Ann"
+// in any script.
+var namePattern = regexp.MustCompile(`^[\p{L}\p{M}]+(?:[ '’-][\p{L}\p{M}]+)*$`)
+
+// Struct checks the fields of v, a struct or a pointer to one, and returns the
+// errors in field order, at most one per field. It panics on a malformed tag.
+func Struct(v interface{}) []FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	var errs []FieldError
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		if err := checkField(jsonName(rt.Field(i)), rv.Field(i), strings.Split(tag, ",")); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+	return errs
+}
+
+// UnknownField returns the error for a JSON field the request does not have.
+func UnknownField(field string) FieldError {
+	return FieldError{Field: field, Code: CodeUnknownField, Message: fmt.Sprintf("%s is not a known field", field)}
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func checkField(field string, v reflect.Value, rules []string) *FieldError {
+	fail := func(code, format string, args ...interface{}) *FieldError {
+		return &FieldError{Field: field, Code: code, Message: field + " " + fmt.Sprintf(format, args...)}
+	}
+
+	if v.IsZero() || (v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "") {
+		for _, rule := range rules {
+			if rule == "required" {
+				return fail(CodeRequired, "is required")
+			}
+		}
+		return nil
+	}
+
+	var min, max *int64
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+		case "min", "max":
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validation: bad %s rule of %s: %q", name, field, rule))
+			}
+			if name == "min" {
+				min = &n
+			} else {
+				max = &n
+			}
+		case "name":
+			if !namePattern.MatchString(strings.TrimSpace(v.String())) {
+				return fail(CodeInvalidChars, "may only contain letters, spaces, hyphens and apostrophes")
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !contains(allowed, fmt.Sprint(v.Interface())) {
+				return fail(CodeInvalidValue, "must be one of %s", strings.Join(allowed, ", "))
+			}
+		case "iso3166":
+			if !countries[v.String()] {
+				return fail(CodeInvalidValue, "must be an ISO 3166-1 alpha-2 country code, e.g. RU")
+			}
+		default:
+			panic(fmt.Sprintf("validation: unknown rule of %s: %q", field, rule))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if max != nil && int64(utf8.RuneCountInString(v.String())) > *max {
+			return fail(CodeTooLong, "must be at most %d characters long", *max)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		switch {
+		case min != nil && max != nil && (n < *min || n > *max):
+			return fail(CodeOutOfRange, "must be between %d and %d", *min, *max)
+		case min != nil && n < *min:
+			return fail(CodeOutOfRange, "must be at least %d", *min)
+		case max != nil && n > *max:
+			return fail(CodeOutOfRange, "must be at most %d", *max)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
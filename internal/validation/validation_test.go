@@ -0,0 +1,72 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type person struct {
+	Name        string `json:"name" validate:"required,max=5,name"`
+	Patronymic  string `json:"patronymic,omitempty" validate:"max=5,name"`
+	Age         int    `json:"age" validate:"required,min=1,max=150"`
+	Gender      string `json:"gender" validate:"oneof=male female"`
+	Nationality string `json:"nationality" validate:"iso3166"`
+	Note        string `json:"note"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := person{Name: "Anna", Age: 30, Gender: "female", Nationality: "RU", Note: "<anything>"}
+
+	tests := []struct {
+		name   string
+		modify func(*person)
+		want   []FieldError
+	}{
+		{"valid", func(p *person) {}, nil},
+		{"optional fields empty", func(p *person) { p.Gender, p.Nationality = "", "" }, nil},
+		{"names in other scripts", func(p *person) { p.Name, p.Patronymic = "Иван", "O'Ne" }, nil},
+		{"required", func(p *person) { p.Name, p.Age = "  ", 0 }, []FieldError{
+			{Field: "name", Code: CodeRequired, Message: "name is required"},
+			{Field: "age", Code: CodeRequired, Message: "age is required"},
+		}},
+		{"too long in characters", func(p *person) { p.Name = "Ивановa" }, []FieldError{
+			{Field: "name", Code: CodeTooLong, Message: "name must be at most 5 characters long"},
+		}},
+		{"invalid characters", func(p *person) { p.Patronymic = "A1" }, []FieldError{
+			{Field: "patronymic", Code: CodeInvalidChars, Message: "patronymic may only contain letters, spaces, hyphens and apostrophes"},
+		}},
+		{"double separator", func(p *person) { p.Name = "A--b" }, []FieldError{
+			{Field: "name", Code: CodeInvalidChars, Message: "name may only contain letters, spaces, hyphens and apostrophes"},
+		}},
+		{"out of range", func(p *person) { p.Age = 151 }, []FieldError{
+			{Field: "age", Code: CodeOutOfRange, Message: "age must be between 1 and 150"},
+		}},
+		{"not one of", func(p *person) { p.Gender = "other" }, []FieldError{
+			{Field: "gender", Code: CodeInvalidValue, Message: "gender must be one of male, female"},
+		}},
+		{"unknown country", func(p *person) { p.Nationality = "XX" }, []FieldError{
+			{Field: "nationality", Code: CodeInvalidValue, Message: "nationality must be an ISO 3166-1 alpha-2 country code, e.g. RU"},
+		}},
+		{"lower case country", func(p *person) { p.Nationality = "ru" }, []FieldError{
+			{Field: "nationality", Code: CodeInvalidValue, Message: "nationality must be an ISO 3166-1 alpha-2 country code, e.g. RU"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+			assert.Equal(t, tt.want, Struct(&p))
+		})
+	}
+}
+
+func TestCountries(t *testing.T) {
+	assert.Len(t, countries, 249)
+	for code := range countries {
+		assert.Len(t, code, 2)
+		assert.Equal(t, strings.ToUpper(code), code)
+	}
+}